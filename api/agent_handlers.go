@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"mondash-backend/domain"
+	"mondash-backend/services"
+)
+
+// AgentsHandler lists the issued agent credentials.
+func AgentsHandler(s *services.AgentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := s.List(r.Context())
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Agents []domain.AgentToken `json:"agents"`
+		}{Agents: data})
+	}
+}
+
+// IssueAgentHandler creates a credential bound to the given nodes. The token
+// is only included in this response.
+func IssueAgentHandler(s *services.AgentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name  string   `json:"name"`
+			Nodes []string `json:"nodes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token, agent, err := s.Issue(r.Context(), req.Name, req.Nodes)
+		if unavailable(err) {
+			serverError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			Token string            `json:"token"`
+			Agent domain.AgentToken `json:"agent"`
+		}{Token: token, Agent: agent})
+	}
+}
+
+// RevokeAgentHandler revokes the credential named in the URL.
+func RevokeAgentHandler(s *services.AgentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.Revoke(r.Context(), chi.URLParam(r, "id"))
+		if unavailable(err) {
+			serverError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
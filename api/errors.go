@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"mondash-backend/logger"
+)
+
+// labeledError is implemented by storage errors carrying driver labels, such
+// as the MongoDB driver's "NetworkError".
+type labeledError interface {
+	HasErrorLabel(label string) bool
+}
+
+// StatusFor maps a failure that is not the client's fault to a status code:
+// operations that ran out of time give 504, an unreachable backend or a
+// cancelled request 503 and anything else 500.
+func StatusFor(err error) int {
+	var labeled labeledError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &labeled) && labeled.HasErrorLabel("NetworkError"):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// serverError writes err with the status given by StatusFor.
+func serverError(w http.ResponseWriter, err error) {
+	status := StatusFor(err)
+	if status != http.StatusInternalServerError {
+		logger.Log.Warnw("storage operation failed", "status", status, "error", err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// unavailable reports whether err comes from storage being slow or
+// unreachable rather than from the request itself.
+func unavailable(err error) bool {
+	return StatusFor(err) != http.StatusInternalServerError
+}
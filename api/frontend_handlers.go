@@ -2,20 +2,25 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+
+	"mondash-backend/config"
 	"mondash-backend/domain"
+	"mondash-backend/notifier"
 	"mondash-backend/services"
 )
 
 // AppsHandler returns app information via the service.
 func AppsHandler(s *services.AppService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data, err := s.List()
+		data, err := s.List(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
 		json.NewEncoder(w).Encode(data)
@@ -23,13 +28,22 @@ func AppsHandler(s *services.AppService) http.HandlerFunc {
 }
 
 // AppsTimelineHandler returns app keyrate information within a time range via the service.
+// startTimestamp and endTimestamp are RFC3339 timestamps and the optional step
+// is a duration such as "1h" or a number of seconds.
 func AppsTimelineHandler(s *services.AppService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		start := r.URL.Query().Get("startTimestamp")
-		end := r.URL.Query().Get("endTimestamp")
-		data, err := s.Timeline(start, end)
+		start, end, step, err := parseRange(r.URL.Query(), "startTimestamp", "endTimestamp")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := s.Timeline(r.Context(), start, end, step)
+		switch {
+		case errors.Is(err, services.ErrInvalidRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			serverError(w, err)
 			return
 		}
 		json.NewEncoder(w).Encode(data)
@@ -43,14 +57,14 @@ func AppsTimelineHandler(s *services.AppService) http.HandlerFunc {
 // registered alerts are provided by the alert service.
 func AlertsHandler(d *services.DeviceService, a *services.AlertService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		devices, err := d.List()
+		devices, err := d.List(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
-		alertData, err := a.List()
+		alertData, err := a.List(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
 
@@ -66,25 +80,62 @@ func AlertsHandler(d *services.DeviceService, a *services.AlertService) http.Han
 		json.NewEncoder(w).Encode(domain.AlertsResponse{
 			Devices:     names,
 			AlertLevels: alertData.AlertLevels,
+			Escalations: a.Escalations(r.Context()),
+			Metrics:     services.AlertMetrics,
+			Operators:   services.AlertOperators,
+			Channels:    notifier.Channels,
 			Alerts:      alertData.Alerts,
 		})
 	}
 }
 
-// RegisterAlertHandler accepts an alert registration and stores it.
+// alertRequest is the body accepted when registering or updating an alert.
+type alertRequest struct {
+	Device    string  `json:"device"`
+	Level     string  `json:"level"`
+	Email     string  `json:"email"`
+	Channel   string  `json:"channel"`
+	Webhook   string  `json:"webhook"`
+	Metric    string  `json:"metric"`
+	Target    string  `json:"target"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+	Duration  string  `json:"duration"`
+}
+
+func (req alertRequest) alert() domain.Alert {
+	return domain.Alert{
+		Device:    req.Device,
+		Level:     req.Level,
+		Email:     req.Email,
+		Channel:   req.Channel,
+		Webhook:   req.Webhook,
+		Metric:    req.Metric,
+		Target:    req.Target,
+		Operator:  req.Operator,
+		Threshold: req.Threshold,
+		Duration:  req.Duration,
+	}
+}
+
+// RegisterAlertHandler accepts an alert registration and stores it. Setting
+// metric, target, operator, threshold and optionally duration registers a
+// threshold rule instead of a device down alert. Channel and webhook select
+// how notifications are delivered.
 func RegisterAlertHandler(s *services.AlertService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			Device string `json:"device"`
-			Level  string `json:"level"`
-			Email  string `json:"email"`
-		}
+		var req alertRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err := s.Register(domain.Alert{Device: req.Device, Level: req.Level, Email: req.Email}); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		err := s.Register(r.Context(), req.alert())
+		if errors.Is(err, services.ErrInvalidAlert) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			serverError(w, err)
 			return
 		}
 		w.WriteHeader(http.StatusCreated)
@@ -92,12 +143,79 @@ func RegisterAlertHandler(s *services.AlertService) http.HandlerFunc {
 	}
 }
 
+// UpdateAlertHandler replaces the alert named in the URL with the request
+// body and returns the stored alert.
+func UpdateAlertHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req alertRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a, err := s.Update(r.Context(), chi.URLParam(r, "id"), req.alert())
+		switch {
+		case errors.Is(err, services.ErrAlertNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, services.ErrInvalidAlert):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(a)
+	}
+}
+
+// DeleteAlertHandler removes the alert named in the URL.
+func DeleteAlertHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.Delete(r.Context(), chi.URLParam(r, "id"))
+		if errors.Is(err, services.ErrAlertNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+// UpdateEscalationsHandler replaces the escalation policies with those of
+// the request body and returns the policies in effect.
+func UpdateEscalationsHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Escalations []domain.EscalationPolicy `json:"escalations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		policies, err := s.SetEscalations(r.Context(), req.Escalations)
+		if errors.Is(err, services.ErrInvalidEscalation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Escalations []domain.EscalationPolicy `json:"escalations"`
+		}{Escalations: policies})
+	}
+}
+
 // ActiveAlertsHandler returns the list of currently active alerts.
 func ActiveAlertsHandler(s *services.AlertService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data, err := s.ActiveAlerts()
+		data, err := s.ActiveAlerts(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
 		json.NewEncoder(w).Encode(struct {
@@ -106,32 +224,115 @@ func ActiveAlertsHandler(s *services.AlertService) http.HandlerFunc {
 	}
 }
 
-// NodesHandler returns node information via the service.
-func NodesHandler(s *services.NodeService) http.HandlerFunc {
+// AlertDeliveriesHandler returns the recorded notification deliveries,
+// newest first. The optional `limit` query parameter bounds the result and
+// `failed=true` returns only failed deliveries.
+func AlertDeliveriesHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		failed := r.URL.Query().Get("failed") == "true"
+		data, err := s.Deliveries(r.Context(), limit, failed)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Deliveries []domain.AlertDelivery `json:"deliveries"`
+		}{Deliveries: data})
+	}
+}
+
+// NodesHandler returns node information via the service. Users holding only
+// view_specific_node see the nodes tied to their affiliation.
+func NodesHandler(s *services.NodeService, authz *services.AuthzService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data, err := s.List()
+		data, err := s.List(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
-		json.NewEncoder(w).Encode(data)
+		user, _ := services.UserFromContext(r.Context())
+		scope := authz.NodeScope(user, config.PermViewNodes)
+		visible := []domain.NodeInfo{}
+		for _, n := range data {
+			if services.InScope(scope, n.ID) {
+				visible = append(visible, n)
+			}
+		}
+		json.NewEncoder(w).Encode(visible)
 	}
 }
 
-// MapHandler returns network map information via the service.
-func MapHandler(s *services.MapService) http.HandlerFunc {
+// NodeHistoryHandler returns the downsampled status timeline of the node
+// named in the URL. The optional start and end query parameters are RFC3339
+// timestamps and step is a duration such as "5m" or a number of seconds.
+func NodeHistoryHandler(s *services.NodeService, authz *services.AuthzService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data, err := s.Get()
+		id := chi.URLParam(r, "id")
+		user, _ := services.UserFromContext(r.Context())
+		if !services.InScope(authz.NodeScope(user, config.PermViewNodes), id) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		start, end, step, err := parseRange(r.URL.Query(), "start", "end")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := s.History(r.Context(), id, start, end, step)
+		switch {
+		case errors.Is(err, services.ErrNodeNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, services.ErrInvalidRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			serverError(w, err)
 			return
 		}
 		json.NewEncoder(w).Encode(data)
 	}
 }
 
-// DevicesHandler returns device information via the service.
-func DevicesHandler(s *services.DeviceService) http.HandlerFunc {
+// MapHandler returns network map information via the service. Users holding
+// only view_specific_node see their affiliated node and the links between
+// visible nodes.
+func MapHandler(s *services.MapService, authz *services.AuthzService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := s.Get(r.Context())
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		user, _ := services.UserFromContext(r.Context())
+		scope := authz.NodeScope(user, config.PermViewNodes)
+		visible := domain.MapData{Nodes: []domain.MapNode{}, Connections: []domain.MapConnection{}}
+		for _, n := range data.Nodes {
+			if services.InScope(scope, n.ID) {
+				visible.Nodes = append(visible.Nodes, n)
+			}
+		}
+		for _, c := range data.Connections {
+			if services.InScope(scope, c.From) && services.InScope(scope, c.To) {
+				visible.Connections = append(visible.Connections, c)
+			}
+		}
+		json.NewEncoder(w).Encode(visible)
+	}
+}
+
+// DevicesHandler returns device information via the service. Users holding
+// only scoped device permissions see the devices of their affiliated nodes.
+func DevicesHandler(s *services.DeviceService, authz *services.AuthzService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		limit := 0
 		if v := r.URL.Query().Get("numEntries"); v != "" {
@@ -139,28 +340,37 @@ func DevicesHandler(s *services.DeviceService) http.HandlerFunc {
 				limit = n
 			}
 		}
-		data, err := s.ListWithHistory(limit)
+		data, err := s.ListWithHistory(r.Context(), limit)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
-		json.NewEncoder(w).Encode(data)
+		user, _ := services.UserFromContext(r.Context())
+		scope := authz.NodeScope(user, config.PermViewDevices)
+		visible := []domain.Device{}
+		for _, d := range data {
+			if services.InScope(scope, d.NodeID) {
+				visible = append(visible, d)
+			}
+		}
+		json.NewEncoder(w).Encode(visible)
 	}
 }
 
 // UsersHandler returns user information via the service.
 func UsersHandler(s *services.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data, err := s.List()
+		data, err := s.List(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serverError(w, err)
 			return
 		}
 		json.NewEncoder(w).Encode(data)
 	}
 }
 
-// LoginHandler accepts credentials and returns a token via the service.
+// LoginHandler accepts credentials and opens a session via the service. The
+// session token is returned both in the body and as the auth_token cookie.
 func LoginHandler(s *services.AuthService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
@@ -171,28 +381,62 @@ func LoginHandler(s *services.AuthService) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		token, err := s.Login(req.Username, req.Password)
+		token, expires, err := s.Login(r.Context(), req.Username, req.Password)
+		if unavailable(err) {
+			serverError(w, err)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if token == "" {
-			token = os.Getenv("AUTH_TOKEN")
-			if token == "" {
-				token = "abc"
-			}
-		}
 		http.SetCookie(w, &http.Cookie{
 			Name:     "auth_token",
 			Value:    token,
 			Path:     "/",
+			Expires:  expires,
 			HttpOnly: true,
 			Secure:   true,
 			SameSite: http.SameSiteNoneMode,
 		})
 		json.NewEncoder(w).Encode(struct {
-			Token string `json:"token"`
-		}{Token: token})
+			Token     string    `json:"token"`
+			ExpiresAt time.Time `json:"expiresAt"`
+		}{Token: token, ExpiresAt: expires})
+	}
+}
+
+// LogoutHandler ends the current session and clears the auth_token cookie.
+func LogoutHandler(s *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("auth_token"); err == nil {
+			if err := s.Logout(r.Context(), cookie.Value); err != nil {
+				serverError(w, err)
+				return
+			}
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     "auth_token",
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		})
+		w.Write([]byte("ok"))
+	}
+}
+
+// MeHandler returns the user owning the current session.
+func MeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := services.UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "invalid auth token", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
 	}
 }
 
@@ -200,16 +444,17 @@ func LoginHandler(s *services.AuthService) http.HandlerFunc {
 func RegisterHandler(s *services.AuthService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			Username string `json:"username"`
-			Email    string `json:"email"`
-			Password string `json:"password"`
-			Role     string `json:"role"`
+			Username    string `json:"username"`
+			Email       string `json:"email"`
+			Password    string `json:"password"`
+			Role        string `json:"role"`
+			Affiliation string `json:"affiliation"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err := s.Register(req.Username, req.Email, req.Password, req.Role); err != nil {
+		if err := s.Register(r.Context(), req.Username, req.Email, req.Password, req.Role, req.Affiliation); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"mondash-backend/domain"
 	"mondash-backend/logger"
@@ -28,14 +29,27 @@ type UpdateNodeRequest struct {
 	Nodes []NodePayload `json:"nodes"`
 }
 
-// UpdateNodeHandler handles node update requests.
-func UpdateNodeHandler(s *services.NodeService) http.HandlerFunc {
+// UpdateNodeHandler handles node update requests. Payloads naming nodes
+// outside the calling agent's scope are rejected as a whole.
+func UpdateNodeHandler(s *services.NodeService, agents *services.AgentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req UpdateNodeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		agent, _ := services.AgentFromContext(r.Context())
+		var denied []string
+		for _, n := range req.Nodes {
+			if !agents.Allowed(agent, n.Name) {
+				denied = append(denied, n.Name)
+			}
+		}
+		if len(denied) > 0 {
+			logger.Log.Warnw("agent reported for nodes outside its scope", "agent", agent.ID, "nodes", denied)
+			http.Error(w, "not allowed to report for nodes: "+strings.Join(denied, ", "), http.StatusForbidden)
+			return
+		}
 		var nodes []domain.Node
 		for _, n := range req.Nodes {
 			nodes = append(nodes, domain.Node{
@@ -45,7 +59,12 @@ func UpdateNodeHandler(s *services.NodeService) http.HandlerFunc {
 				CurrentKeyRate: n.CurrentKeyRate,
 			})
 		}
-		_ = s.Update(nodes)
+		// Invalid reports are dropped silently; storage outages are reported
+		// so that the agent retries.
+		if err := s.Update(r.Context(), nodes); unavailable(err) {
+			serverError(w, err)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
@@ -58,21 +77,32 @@ type UpdateAppRequest struct {
 	KeySize      int    `json:"keySize"`
 }
 
-// UpdateAppHandler handles app update requests.
-func UpdateAppHandler(s *services.AppService) http.HandlerFunc {
+// UpdateAppHandler handles app update requests. The app's node must be within
+// the calling agent's scope.
+func UpdateAppHandler(s *services.AppService, agents *services.AgentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req UpdateAppRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		agent, _ := services.AgentFromContext(r.Context())
+		if !agents.Allowed(agent, req.NodeID) {
+			logger.Log.Warnw("agent reported for an app outside its scope", "agent", agent.ID, "nodeId", req.NodeID)
+			http.Error(w, "not allowed to report for node: "+req.NodeID, http.StatusForbidden)
+			return
+		}
 		logger.Log.Infow("app update", "nodeId", req.NodeID, "name", req.Name, "numberOfKeys", req.NumberOfKeys, "keySize", req.KeySize)
-		_ = s.Update(&domain.App{
+		err := s.Update(r.Context(), &domain.App{
 			NodeID:       req.NodeID,
 			Name:         req.Name,
 			NumberOfKeys: req.NumberOfKeys,
 			KeySize:      req.KeySize,
 		})
+		if unavailable(err) {
+			serverError(w, err)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
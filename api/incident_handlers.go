@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"mondash-backend/domain"
+	"mondash-backend/services"
+)
+
+// AckAlertHandler acknowledges the open incident of the alert named in the
+// URL on behalf of the logged in user.
+func AckAlertHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := services.UserFromContext(r.Context())
+		inc, err := s.Acknowledge(r.Context(), chi.URLParam(r, "id"), user.Email)
+		if errors.Is(err, services.ErrIncidentNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(inc)
+	}
+}
+
+// AlertHistoryHandler returns recorded incidents, newest first. The optional
+// query parameters device, level, start and end (RFC3339) and limit narrow
+// the result.
+func AlertHistoryHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f := domain.IncidentFilter{Device: q.Get("device"), Level: q.Get("level"), Limit: 100}
+		var err error
+		if v := q.Get("start"); v != "" {
+			if f.Start, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid start: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("end"); v != "" {
+			if f.End, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid end: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("limit"); v != "" {
+			if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		data, err := s.History(r.Context(), f)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Incidents []domain.Incident `json:"incidents"`
+		}{Incidents: data})
+	}
+}
+
+// SilencesHandler lists the silences that have not yet expired.
+func SilencesHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := s.Silences(r.Context())
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Silences []domain.Silence `json:"silences"`
+		}{Silences: data})
+	}
+}
+
+// CreateSilenceHandler silences an alert or a device either for `duration`
+// or until the RFC3339 time `until`.
+func CreateSilenceHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AlertID  string `json:"alertId"`
+			Device   string `json:"device"`
+			Reason   string `json:"reason"`
+			Duration string `json:"duration"`
+			Until    string `json:"until"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var until time.Time
+		switch {
+		case req.Until != "":
+			t, err := time.Parse(time.RFC3339, req.Until)
+			if err != nil {
+				http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			until = t
+		case req.Duration != "":
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				http.Error(w, "invalid duration: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			until = time.Now().Add(d)
+		default:
+			http.Error(w, "duration or until is required", http.StatusBadRequest)
+			return
+		}
+		user, _ := services.UserFromContext(r.Context())
+		sl, err := s.Silence(r.Context(), domain.Silence{
+			AlertID:   req.AlertID,
+			Device:    req.Device,
+			Reason:    req.Reason,
+			CreatedBy: user.Email,
+			Until:     until,
+		})
+		if errors.Is(err, services.ErrInvalidSilence) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sl)
+	}
+}
+
+// DeleteSilenceHandler lifts the silence named in the URL.
+func DeleteSilenceHandler(s *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.Unsilence(r.Context(), chi.URLParam(r, "id"))
+		if unavailable(err) {
+			serverError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"mondash-backend/config"
+	"mondash-backend/services"
+)
+
+// streamKeepAlive is how often a comment is sent on idle streams so that
+// proxies do not close them.
+const streamKeepAlive = 15 * time.Second
+
+// StreamHandler pushes node, app and alert events as server-sent events. The
+// optional query parameters types, nodes and apps take comma separated lists
+// to filter the stream. Users only receive events they may see through the
+// REST endpoints.
+func StreamHandler(hub *services.EventHub, authz *services.AuthzService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		user, _ := services.UserFromContext(r.Context())
+		q := r.URL.Query()
+		filter := services.EventFilter{
+			Types: splitList(q.Get("types")),
+			Nodes: topicSet(q.Get("nodes")),
+			Apps:  topicSet(q.Get("apps")),
+			Scope: unionScope(
+				authz.NodeScope(user, config.PermViewNodes),
+				authz.NodeScope(user, config.PermViewDevices),
+			),
+		}
+		apps := authz.Allowed(user, config.PermViewApplication)
+		alerts := authz.Allowed(user, config.PermViewDevices)
+
+		sub := hub.Subscribe(filter)
+		defer hub.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if (e.App != "" && !apps) || (strings.HasPrefix(e.Type, "alert.") && !alerts) {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func splitList(v string) []string {
+	var res []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// topicSet returns the lowercase entries of a comma separated list, or nil
+// when it is empty.
+func topicSet(v string) map[string]struct{} {
+	list := splitList(v)
+	if len(list) == 0 {
+		return nil
+	}
+	res := map[string]struct{}{}
+	for _, s := range list {
+		res[strings.ToLower(s)] = struct{}{}
+	}
+	return res
+}
+
+// unionScope merges node scopes; nil means unrestricted.
+func unionScope(scopes ...map[string]struct{}) map[string]struct{} {
+	res := map[string]struct{}{}
+	for _, s := range scopes {
+		if s == nil {
+			return nil
+		}
+		for k := range s {
+			res[k] = struct{}{}
+		}
+	}
+	return res
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+	"mondash-backend/services"
+)
+
+// parseRange reads an RFC3339 range from the query parameters named
+// startKey and endKey, and a step given as a duration such as "5m" or a
+// number of seconds. Missing values are returned as zero.
+func parseRange(q url.Values, startKey, endKey string) (start, end time.Time, step time.Duration, err error) {
+	if v := q.Get(startKey); v != "" {
+		if start, err = time.Parse(time.RFC3339, v); err != nil {
+			return start, end, step, fmt.Errorf("invalid %s: %w", startKey, err)
+		}
+	}
+	if v := q.Get(endKey); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			return start, end, step, fmt.Errorf("invalid %s: %w", endKey, err)
+		}
+	}
+	if v := q.Get("step"); v != "" {
+		if secs, errInt := strconv.Atoi(v); errInt == nil {
+			step = time.Duration(secs) * time.Second
+		} else if step, err = time.ParseDuration(v); err != nil {
+			return start, end, step, fmt.Errorf("invalid step: %w", err)
+		}
+	}
+	return start, end, step, nil
+}
+
+// TimelineHandler returns the rollup timeline of the series named in the URL
+// (app_consumption, device_key_rate or node_key_count). The optional keys
+// parameter is a comma separated list of apps or reporting nodes and devices;
+// start, end and step are read as by NodeHistoryHandler. Apps require
+// view_application, while devices and nodes are narrowed to the user's device
+// or node scope through the node they belong to.
+func TimelineHandler(s *services.RollupService, authz *services.AuthzService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		series := chi.URLParam(r, "series")
+		user, _ := services.UserFromContext(r.Context())
+		var visible func(key string) bool
+		switch series {
+		case domain.SeriesAppConsumption:
+			if !authz.Allowed(user, config.PermViewApplication) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			visible = func(string) bool { return true }
+		case domain.SeriesDeviceKeyRate:
+			scope := authz.NodeScope(user, config.PermViewDevices)
+			visible = func(key string) bool { return services.InScope(scope, authz.Network.NodeOf(key)) }
+		case domain.SeriesNodeKeyCount:
+			scope := authz.NodeScope(user, config.PermViewNodes)
+			visible = func(key string) bool { return services.InScope(scope, authz.Network.NodeOf(key)) }
+		default:
+			http.Error(w, "unknown series: "+series, http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		start, end, step, err := parseRange(q, "start", "end")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := s.Timeline(r.Context(), series, splitList(q.Get("keys")), start, end, step)
+		switch {
+		case errors.Is(err, services.ErrInvalidRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			serverError(w, err)
+			return
+		}
+		for key := range data.Data {
+			if !visible(key) {
+				delete(data.Data, key)
+			}
+		}
+		json.NewEncoder(w).Encode(data)
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+	"mondash-backend/services"
+)
+
+// topologyError writes err with the status matching the topology service
+// error it wraps.
+func topologyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTopology):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrTopologyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrTopologyConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		serverError(w, err)
+	}
+}
+
+// TopologyHandler returns the network topology.
+func TopologyHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := s.Get(r.Context())
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// ExportTopologyHandler returns the network topology in the config.yaml
+// format.
+func ExportTopologyHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, err := s.Export(r.Context())
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		b, err := yaml.Marshal(cfg)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(b)
+	}
+}
+
+// ImportTopologyHandler replaces the network topology with the one defined by
+// a config.yaml document in the request body.
+func ImportTopologyHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cfg, err := config.Parse(b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t, err := s.Import(r.Context(), cfg)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// AddTopologyNodeHandler adds a node to the topology.
+func AddTopologyNodeHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var n domain.TopologyNode
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, err := s.AddNode(r.Context(), n)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(n)
+	}
+}
+
+// UpdateTopologyNodeHandler replaces the coordinates, KME URL and type of
+// the node named in the URL.
+func UpdateTopologyNodeHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var n domain.TopologyNode
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, err := s.UpdateNode(r.Context(), chi.URLParam(r, "name"), n)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(n)
+	}
+}
+
+// DeleteTopologyNodeHandler removes the node named in the URL.
+func DeleteTopologyNodeHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeleteNode(r.Context(), chi.URLParam(r, "name")); err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AddTopologyDeviceHandler adds a device to the topology.
+func AddTopologyDeviceHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var d domain.TopologyDevice
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := s.AddDevice(r.Context(), d)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// UpdateTopologyDeviceHandler replaces the node and KME URL of the device
+// named in the URL.
+func UpdateTopologyDeviceHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var d domain.TopologyDevice
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := s.UpdateDevice(r.Context(), chi.URLParam(r, "id"), d)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// DeleteTopologyDeviceHandler removes the device named in the URL.
+func DeleteTopologyDeviceHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeleteDevice(r.Context(), chi.URLParam(r, "id")); err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AddTopologyLinkHandler adds a link between two devices.
+func AddTopologyLinkHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var l domain.TopologyLink
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l, err := s.AddLink(r.Context(), l)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(l)
+	}
+}
+
+// UpdateTopologyLinkHandler replaces the length of the link between the
+// devices named in the URL.
+func UpdateTopologyLinkHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var l domain.TopologyLink
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l, err := s.UpdateLink(r.Context(), chi.URLParam(r, "from"), chi.URLParam(r, "to"), l)
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(l)
+	}
+}
+
+// DeleteTopologyLinkHandler removes the link between the devices named in the
+// URL.
+func DeleteTopologyLinkHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeleteLink(r.Context(), chi.URLParam(r, "from"), chi.URLParam(r, "to")); err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AddTopologyConsumerHandler declares a consumer.
+func AddTopologyConsumerHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.AddConsumer(r.Context(), req.Name); err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+	}
+}
+
+// DeleteTopologyConsumerHandler removes the consumer named in the URL.
+func DeleteTopologyConsumerHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeleteConsumer(r.Context(), chi.URLParam(r, "name")); err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetTopologyPathHandler creates or replaces the routes the consumer named in
+// the URL uses from the device named in the URL.
+func SetTopologyPathHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Routes [][]string `json:"routes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, err := s.SetPath(r.Context(), domain.ConsumerPath{
+			Device:   chi.URLParam(r, "device"),
+			Consumer: chi.URLParam(r, "consumer"),
+			Routes:   req.Routes,
+		})
+		if err != nil {
+			topologyError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// DeleteTopologyPathHandler removes the routes the consumer named in the URL
+// uses from the device named in the URL.
+func DeleteTopologyPathHandler(s *services.TopologyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeletePath(r.Context(), chi.URLParam(r, "device"), chi.URLParam(r, "consumer")); err != nil {
+			topologyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1,26 +1,53 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/joho/godotenv"
 
+	"mondash-backend/config"
 	"mondash-backend/logger"
 	mongorepo "mondash-backend/repository/mongo"
 	"mondash-backend/routes"
+	"mondash-backend/tracing"
 )
 
 func main() {
 	// Load environment variables from .env if present
 	_ = godotenv.Load()
 
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(validateConfig(os.Args[2:]))
+	}
+	lenient := flag.Bool("lenient", os.Getenv("CONFIG_LENIENT") == "true", "start even if the configuration file is invalid")
+	flag.Parse()
+
 	if err := logger.Init(); err != nil {
 		log.Fatalf("failed to init logger: %v", err)
 	}
 	defer logger.Log.Sync()
 
+	configPath := config.PathFromEnv()
+	if problems := checkConfig(configPath); len(problems) > 0 {
+		for _, p := range problems {
+			logger.Log.Errorw("invalid configuration", "file", configPath, "problem", p)
+		}
+		if !*lenient {
+			logger.Log.Fatalf("refusing to start with an invalid %s; fix it or start with -lenient (CONFIG_LENIENT=true)", configPath)
+		}
+		logger.Log.Warnw("starting with an invalid configuration", "file", configPath, "problems", len(problems))
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logger.Log.Fatalf("failed to init tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "28080"
@@ -34,6 +61,11 @@ func main() {
 	if dbName == "" {
 		dbName = "mondash"
 	}
+	timeouts, err := mongorepo.TimeoutsFromEnv()
+	if err != nil {
+		logger.Log.Fatalf("invalid MongoDB timeouts: %v", err)
+	}
+	mongorepo.SetTimeouts(timeouts)
 	db, err := mongorepo.Connect(mongoURI, dbName)
 	if err != nil {
 		logger.Log.Fatalf("failed to connect to MongoDB: %v", err)
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"mondash-backend/config"
+)
+
+// validateConfig implements `mondash validate-config [file]`. It checks the
+// given configuration file, or the one named by CONFIG_FILE, prints every
+// problem found and returns the exit status.
+func validateConfig(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mondash validate-config [file]")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path := config.PathFromEnv()
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	problems := checkConfig(path)
+	if len(problems) == 0 {
+		fmt.Printf("%s: ok\n", path)
+		return 0
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, p)
+	}
+	return 1
+}
+
+// checkConfig loads and validates a configuration file and returns the
+// problems found.
+func checkConfig(path string) []string {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var invalid *config.ValidationError
+	err = cfg.Validate()
+	if errors.As(err, &invalid) {
+		return invalid.Problems
+	}
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"sort"
 
@@ -12,14 +14,32 @@ type Coordinates struct {
 	Long float64 `yaml:"long"`
 }
 
+// Node declares a node of the network: the devices it hosts, the URL of its
+// KME and its type, such as "terminal" or "trusted node".
+type Node struct {
+	Devices []string `yaml:"devices"`
+	KME     string   `yaml:"kme,omitempty"`
+	Type    string   `yaml:"type,omitempty"`
+}
+
 type Config struct {
-	Names       []string                         `yaml:"names"`
-	URLs        map[string]string                `yaml:"urls"`
-	Consumers   []string                         `yaml:"consumers"`
-	Geolocation map[string]Coordinates           `yaml:"geolocation"`
-	Links       [][]string                       `yaml:"links"`
-	Paths       map[string]map[string][][]string `yaml:"paths"`
-	// Additional fields are ignored
+	// Nodes maps node names to their declaration. Files without it are legacy
+	// files, whose devices belong to the node given by BaseName.
+	Nodes       map[string]Node                  `yaml:"nodes,omitempty"`
+	Names       []string                         `yaml:"names,omitempty"`
+	URLs        map[string]string                `yaml:"urls,omitempty"`
+	Consumers   []string                         `yaml:"consumers,omitempty"`
+	Geolocation map[string]Coordinates           `yaml:"geolocation,omitempty"`
+	Links       [][]string                       `yaml:"links,omitempty"`
+	Paths       map[string]map[string][][]string `yaml:"paths,omitempty"`
+	// Extra holds the remaining top-level keys, such as key_parameters, so
+	// that they survive a round trip through Config.
+	Extra map[string]interface{} `yaml:",inline"`
+
+	// unknownFields lists the keys of nested mappings, such as nodes or
+	// geolocation, that the file sets but Config does not define. They are
+	// reported by Validate.
+	unknownFields []string
 }
 
 func Load(path string) (Config, error) {
@@ -27,19 +47,90 @@ func Load(path string) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	return Parse(b)
+}
+
+// Parse decodes a config.yaml document. Unknown keys inside the typed
+// sections are dropped like unknown top-level keys, and Validate reports
+// both.
+func Parse(b []byte) (Config, error) {
 	var cfg Config
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
 		return Config{}, err
 	}
+	var strict Config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var typeErr *yaml.TypeError
+	if err := dec.Decode(&strict); errors.As(err, &typeErr) {
+		cfg.unknownFields = typeErr.Errors
+	}
 	return cfg, nil
 }
 
+// PathFromEnv returns the configuration file named by CONFIG_FILE, or
+// config.yaml in the working directory.
+func PathFromEnv() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	return "config.yaml"
+}
+
 func LoadFromEnv() (Config, error) {
-	path := os.Getenv("CONFIG_FILE")
-	if path == "" {
-		path = "config.yaml"
+	return Load(PathFromEnv())
+}
+
+// Legacy reports whether the file predates explicit node declarations.
+func (c Config) Legacy() bool {
+	return len(c.Nodes) == 0
+}
+
+// NodeOf returns the node hosting the named device, or the name itself when
+// it is a node. Legacy files fall back to BaseName; otherwise undeclared names
+// are returned unchanged.
+func (c Config) NodeOf(name string) string {
+	if c.Legacy() {
+		return BaseName(name)
+	}
+	if _, ok := c.Nodes[name]; ok {
+		return name
+	}
+	for node, n := range c.Nodes {
+		for _, d := range n.Devices {
+			if d == name {
+				return node
+			}
+		}
+	}
+	return name
+}
+
+// Devices returns the devices of the network: those declared by nodes, in
+// node name order, followed by those only listed under names.
+func (c Config) Devices() []string {
+	nodes := make([]string, 0, len(c.Nodes))
+	for name := range c.Nodes {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	var devices []string
+	seen := map[string]struct{}{}
+	for _, name := range nodes {
+		for _, d := range c.Nodes[name].Devices {
+			if _, ok := seen[d]; !ok {
+				seen[d] = struct{}{}
+				devices = append(devices, d)
+			}
+		}
+	}
+	for _, d := range c.Names {
+		if _, ok := seen[d]; !ok {
+			seen[d] = struct{}{}
+			devices = append(devices, d)
+		}
 	}
-	return Load(path)
+	return devices
 }
 
 // NodesByConsumer returns a map of consumer names to the nodes that reference
@@ -49,7 +140,7 @@ func (c Config) NodesByConsumer() map[string][]string {
 	m := make(map[string][]string)
 	seen := make(map[string]map[string]struct{})
 	for node, consumerMap := range c.Paths {
-		base := baseName(node)
+		base := c.NodeOf(node)
 		for cons := range consumerMap {
 			if seen[cons] == nil {
 				seen[cons] = make(map[string]struct{})
@@ -72,7 +163,7 @@ func (c Config) NodesByConsumer() map[string][]string {
 func (c Config) ConsumersByNode() map[string][]string {
 	m := make(map[string][]string)
 	for node, consumerMap := range c.Paths {
-		base := baseName(node)
+		base := c.NodeOf(node)
 		for cons := range consumerMap {
 			m[base] = append(m[base], cons)
 		}
@@ -83,7 +174,11 @@ func (c Config) ConsumersByNode() map[string][]string {
 	return m
 }
 
-func baseName(s string) string {
+// BaseName returns the node a device name belongs to in legacy files, where
+// devices are named after their node with a single trailing uppercase letter
+// (precisA, precisB); other names are returned unchanged. Use Config.NodeOf
+// instead, which honours node declarations.
+func BaseName(s string) string {
 	if len(s) == 0 {
 		return s
 	}
@@ -1,16 +1,68 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Permission names understood by the API. Roles grant them in roles.yaml; the
+// wildcard "*" grants every permission.
+const (
+	PermAll                   = "*"
+	PermViewDevices           = "view_devices"
+	PermViewNodes             = "view_nodes"
+	PermViewSpecificNode      = "view_specific_node"
+	PermViewNodeDevices       = "view_node_devices"
+	PermViewApplication       = "view_application"
+	PermViewAssociatedDevices = "view_associated_devices"
+	PermManageAlerts          = "manage_alerts"
+	PermViewUsers             = "view_users"
+	PermManageUsers           = "manage_users"
+	PermManageAgents          = "manage_agents"
+	PermManageTopology        = "manage_topology"
+)
+
+// permissions lists every permission name, for validation.
+var permissions = map[string]struct{}{
+	PermAll: {}, PermViewDevices: {}, PermViewNodes: {}, PermViewSpecificNode: {},
+	PermViewNodeDevices: {}, PermViewApplication: {}, PermViewAssociatedDevices: {},
+	PermManageAlerts: {}, PermViewUsers: {}, PermManageUsers: {}, PermManageAgents: {},
+	PermManageTopology: {},
+}
+
 // Roles maps role names to the permissions granted for that role.
 type Roles struct {
 	Roles map[string][]string `yaml:"roles"`
 }
 
+// DefaultRoles returns the role definitions shipped in roles.yaml. It is used
+// when no roles file can be found so that a fresh checkout still enforces
+// sensible permissions.
+func DefaultRoles() Roles {
+	return Roles{Roles: map[string][]string{
+		"admin":        {PermAll},
+		"auditor":      {PermAll},
+		"technician":   {PermViewDevices, PermViewNodes},
+		"partner_head": {PermViewSpecificNode, PermViewNodeDevices},
+		"usecase_head": {PermViewApplication, PermViewAssociatedDevices},
+		"qkd_user":     {PermViewApplication},
+	}}
+}
+
+// Has reports whether the role is granted perm, either explicitly or through
+// the "*" wildcard. Unknown roles have no permissions.
+func (r Roles) Has(role, perm string) bool {
+	for _, p := range r.Roles[role] {
+		if p == PermAll || p == perm {
+			return true
+		}
+	}
+	return false
+}
+
 // LoadRoles reads a YAML file and unmarshals it into a Roles struct.
 func LoadRoles(path string) (Roles, error) {
 	b, err := os.ReadFile(path)
@@ -24,13 +76,44 @@ func LoadRoles(path string) (Roles, error) {
 	return r, nil
 }
 
+// Validate checks that at least one role is defined and that roles only
+// grant known permissions. It returns a *ValidationError listing all
+// problems, or nil.
+func (r Roles) Validate() error {
+	var problems []string
+	if len(r.Roles) == 0 {
+		problems = append(problems, "no roles defined")
+	}
+	names := make([]string, 0, len(r.Roles))
+	for name := range r.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, p := range r.Roles[name] {
+			if _, ok := permissions[p]; !ok {
+				problems = append(problems, fmt.Sprintf("roles.%s: unknown permission %q", name, p))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// RolesPathFromEnv returns the roles file named by ROLES_FILE, or roles.yaml
+// in the working directory.
+func RolesPathFromEnv() string {
+	if path := os.Getenv("ROLES_FILE"); path != "" {
+		return path
+	}
+	return "roles.yaml"
+}
+
 // LoadRolesFromEnv loads roles configuration from the ROLES_FILE environment
 // variable. If ROLES_FILE is unset it defaults to roles.yaml in the working
 // directory.
 func LoadRolesFromEnv() (Roles, error) {
-	path := os.Getenv("ROLES_FILE")
-	if path == "" {
-		path = "roles.yaml"
-	}
-	return LoadRoles(path)
+	return LoadRoles(RolesPathFromEnv())
 }
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// knownSettings are the top-level keys of config.yaml that are kept in Extra
+// without being interpreted by the backend.
+var knownSettings = map[string]struct{}{
+	"key_parameters": {},
+	"alerts":         {},
+}
+
+// keyParameters lists the accepted key_parameters and their minimum value.
+var keyParameters = map[string]int{
+	"default_key_size":    1,
+	"max_key_count":       1,
+	"max_key_per_request": 1,
+	"max_key_size":        1,
+	"min_key_size":        1,
+	"max_SAE_ID_count":    0,
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that the configuration describes a consistent network:
+// every device belongs to one node, every node has a valid geolocation, links
+// and paths only reference known devices and declared consumers, and
+// key_parameters are in range. Unknown keys, at the top level or inside a
+// section, are reported as well, since they usually are typos. It returns a *ValidationError listing all
+// problems, or nil.
+func (c Config) Validate() error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, key := range sortedKeys(c.Extra) {
+		if _, ok := knownSettings[key]; !ok {
+			report("unknown key %q", key)
+		}
+	}
+	problems = append(problems, c.unknownFields...)
+
+	devices := map[string]struct{}{}
+	for _, d := range c.Devices() {
+		devices[d] = struct{}{}
+	}
+	if len(devices) == 0 {
+		report("no devices defined under nodes or names")
+	}
+
+	nodes := map[string]struct{}{}
+	owner := map[string]string{}
+	for _, name := range sortedKeys(c.Nodes) {
+		nodes[name] = struct{}{}
+		for _, d := range c.Nodes[name].Devices {
+			if prev, ok := owner[d]; ok {
+				report("nodes.%s: device %s is already declared by node %s", name, d, prev)
+				continue
+			}
+			owner[d] = name
+		}
+	}
+	for _, d := range c.Names {
+		if !c.Legacy() {
+			if _, ok := owner[d]; !ok {
+				report("names: device %s is not declared by any node", d)
+			}
+		}
+		nodes[c.NodeOf(d)] = struct{}{}
+	}
+
+	for _, name := range sortedKeys(nodes) {
+		coord, ok := c.Geolocation[name]
+		switch {
+		case !ok:
+			report("geolocation: node %s has no coordinates", name)
+		case coord.Lat < -90 || coord.Lat > 90:
+			report("geolocation.%s: latitude %v is out of range", name, coord.Lat)
+		case coord.Long < -180 || coord.Long > 180:
+			report("geolocation.%s: longitude %v is out of range", name, coord.Long)
+		}
+	}
+	for _, name := range sortedKeys(c.Geolocation) {
+		if _, ok := nodes[name]; !ok {
+			report("geolocation: unknown node %s", name)
+		}
+	}
+
+	for _, d := range sortedKeys(c.URLs) {
+		if _, ok := devices[d]; !ok {
+			report("urls: unknown device %s", d)
+		}
+	}
+
+	consumers := map[string]struct{}{}
+	for _, cons := range c.Consumers {
+		if _, ok := consumers[cons]; ok {
+			report("consumers: duplicate consumer %s", cons)
+		}
+		consumers[cons] = struct{}{}
+	}
+
+	for i, l := range c.Links {
+		if len(l) < 2 || len(l) > 3 {
+			report("links[%d]: expected two devices and an optional length, got %v", i, l)
+			continue
+		}
+		for _, end := range l[:2] {
+			if _, ok := devices[end]; !ok {
+				report("links[%d]: unknown device %s", i, end)
+			}
+		}
+		if l[0] == l[1] {
+			report("links[%d]: device %s is linked to itself", i, l[0])
+		}
+		if len(l) == 3 {
+			if v, err := strconv.ParseFloat(l[2], 64); err != nil || v < 0 {
+				report("links[%d]: invalid length %q", i, l[2])
+			}
+		}
+	}
+
+	for _, device := range sortedKeys(c.Paths) {
+		if _, ok := devices[device]; !ok {
+			report("paths: unknown device %s", device)
+		}
+		for _, cons := range sortedKeys(c.Paths[device]) {
+			if _, ok := consumers[cons]; !ok {
+				report("paths.%s: undeclared consumer %s", device, cons)
+			}
+			for i, route := range c.Paths[device][cons] {
+				if len(route) != 2 {
+					report("paths.%s.%s[%d]: expected a device and a consumer, got %v", device, cons, i, route)
+					continue
+				}
+				if _, ok := devices[route[0]]; !ok {
+					report("paths.%s.%s[%d]: unknown device %s", device, cons, i, route[0])
+				}
+				if _, ok := consumers[route[1]]; !ok {
+					report("paths.%s.%s[%d]: undeclared consumer %s", device, cons, i, route[1])
+				}
+			}
+		}
+	}
+
+	problems = append(problems, c.validateKeyParameters()...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validateKeyParameters checks that key_parameters only holds known integer
+// parameters within range and that the key sizes are ordered.
+func (c Config) validateKeyParameters() []string {
+	raw, ok := c.Extra["key_parameters"]
+	if !ok {
+		return nil
+	}
+	params, ok := raw.(map[string]interface{})
+	if !ok {
+		return []string{"key_parameters: expected a mapping"}
+	}
+	var problems []string
+	values := map[string]int{}
+	for _, key := range sortedKeys(params) {
+		min, known := keyParameters[key]
+		if !known {
+			problems = append(problems, fmt.Sprintf("key_parameters: unknown parameter %q", key))
+			continue
+		}
+		v, ok := asInt(params[key])
+		if !ok {
+			problems = append(problems, fmt.Sprintf("key_parameters.%s: expected an integer, got %v", key, params[key]))
+			continue
+		}
+		if v < min {
+			problems = append(problems, fmt.Sprintf("key_parameters.%s: %d is below %d", key, v, min))
+			continue
+		}
+		values[key] = v
+	}
+	ordered := func(low, high string) {
+		l, lok := values[low]
+		h, hok := values[high]
+		if lok && hok && l > h {
+			problems = append(problems, fmt.Sprintf("key_parameters: %s (%d) exceeds %s (%d)", low, l, high, h))
+		}
+	}
+	ordered("min_key_size", "default_key_size")
+	ordered("default_key_size", "max_key_size")
+	ordered("min_key_size", "max_key_size")
+	ordered("max_key_per_request", "max_key_count")
+	return problems
+}
+
+// asInt converts the integer types produced by the YAML and BSON decoders.
+func asInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
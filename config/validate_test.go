@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateShippedConfig(t *testing.T) {
+	cfg, err := Load("../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+nodes:
+  precis:
+    devices: [precisA, precisB]
+  campus:
+    devices: [campus]
+consumers: [vault1]
+geolocation:
+  precis: {lat: 44.43, long: 26.04}
+links:
+  - [campus, precisC, 14000]
+paths:
+  campus:
+    vault2:
+      - [precisA, vault1]
+key_parameters:
+  min_key_size: 512
+  max_key_size: 256
+linx: []
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var invalid *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	want := []string{
+		`unknown key "linx"`,
+		"geolocation: node campus has no coordinates",
+		"links[0]: unknown device precisC",
+		"paths.campus: undeclared consumer vault2",
+		"key_parameters: min_key_size (512) exceeds max_key_size (256)",
+	}
+	got := strings.Join(invalid.Problems, "\n")
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("missing problem %q in:\n%s", w, got)
+		}
+	}
+}
+
+func TestValidateReportsNestedTypos(t *testing.T) {
+	cfg, err := Parse([]byte(`
+nodes:
+  precis:
+    device: [precisA]
+    devices: [precisA]
+geolocation:
+  precis: {latitude: 44.43, long: 26.04}
+key_parameters:
+  max_key_size: 256
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var invalid *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	got := strings.Join(invalid.Problems, "\n")
+	for _, w := range []string{"field device not found", "field latitude not found"} {
+		if !strings.Contains(got, w) {
+			t.Errorf("missing problem %q in:\n%s", w, got)
+		}
+	}
+	if strings.Contains(got, "key_parameters") {
+		t.Errorf("unexpected problem with key_parameters in:\n%s", got)
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// AgentToken is a credential issued to a KME agent. The agent may only report
+// status for the listed nodes. Only a hash of the token is stored.
+type AgentToken struct {
+	ID        string    `json:"id" bson:"id"`
+	Name      string    `json:"name" bson:"name"`
+	Nodes     []string  `json:"nodes" bson:"nodes"`
+	TokenHash string    `json:"-" bson:"token_hash"`
+	CreatedAt time.Time `json:"createdAt" bson:"created_at"`
+	Revoked   bool      `json:"revoked" bson:"revoked"`
+	RevokedAt time.Time `json:"revokedAt,omitempty" bson:"revoked_at,omitempty"`
+}
@@ -1,25 +1,72 @@
 package domain
 
+import "time"
+
+// Alert is a registered alert. Without a Metric it fires while Device is down
+// or not reporting. With a Metric it is a threshold rule: it fires once the
+// metric of Target compared with Threshold using Operator has held for
+// Duration.
+//
+// Channel selects how notifications are delivered ("email" when empty):
+// email goes to Email, webhook and slack post to Webhook, and syslog writes
+// to the configured syslog daemon.
 type Alert struct {
-	ID            string `json:"id"`
-	Device        string `json:"device"`
-	Level         string `json:"level"`
-	LastActivated string `json:"lastActivated"`
-	Email         string `json:"email"`
+	ID            string     `json:"id"`
+	Device        string     `json:"device"`
+	Level         string     `json:"level"`
+	LastActivated *time.Time `json:"lastActivated"`
+	Email         string     `json:"email"`
+	Channel       string     `json:"channel,omitempty"`
+	Webhook       string     `json:"webhook,omitempty"`
+
+	Metric    string  `json:"metric,omitempty"`
+	Target    string  `json:"target,omitempty"`
+	Operator  string  `json:"operator,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Duration  string  `json:"duration,omitempty"`
 }
 
 // AlertInfo represents the alert configuration stored by the alert service.
 // It does not contain any device information.
 type AlertInfo struct {
-	AlertLevels []string `json:"alertLevels"`
-	Alerts      []Alert  `json:"alerts"`
+	AlertLevels []string           `json:"alertLevels"`
+	Escalations []EscalationPolicy `json:"escalations,omitempty"`
+	Alerts      []Alert            `json:"alerts"`
+}
+
+// EscalationPolicy describes how an unacknowledged incident of a level is
+// followed up. RepeatEvery re-sends the notification at that interval and,
+// once the incident has been firing for EscalateAfter, Contacts are emailed
+// as well. Empty durations disable the respective step.
+type EscalationPolicy struct {
+	Level         string   `json:"level"`
+	RepeatEvery   string   `json:"repeatEvery,omitempty"`
+	EscalateAfter string   `json:"escalateAfter,omitempty"`
+	Contacts      []string `json:"contacts,omitempty"`
 }
 
 // AlertsResponse is returned by the alerts API endpoint. It combines the
 // device list obtained from the device service with alert information from the
 // alert service.
 type AlertsResponse struct {
-	Devices     []string `json:"devices"`
-	AlertLevels []string `json:"alertLevels"`
-	Alerts      []Alert  `json:"alerts"`
+	Devices     []string           `json:"devices"`
+	AlertLevels []string           `json:"alertLevels"`
+	Escalations []EscalationPolicy `json:"escalations"`
+	Metrics     []string           `json:"metrics"`
+	Operators   []string           `json:"operators"`
+	Channels    []string           `json:"channels"`
+	Alerts      []Alert            `json:"alerts"`
+}
+
+// AlertDelivery records the outcome of delivering a notification for an
+// alert, including failed attempts.
+type AlertDelivery struct {
+	AlertID     string    `json:"alertId"`
+	Channel     string    `json:"channel"`
+	Destination string    `json:"destination"`
+	Subject     string    `json:"subject"`
+	Attempts    int       `json:"attempts"`
+	Delivered   bool      `json:"delivered"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
 }
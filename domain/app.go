@@ -1,10 +1,21 @@
 package domain
 
+import "time"
+
 // App represents an application running on a node.
 type App struct {
-	NodeID       string `json:"nodeId"`
-	Name         string `json:"name"`
-	NumberOfKeys int    `json:"numberOfKeys"`
-	KeySize      int    `json:"keySize"`
-	Timestamp    string `json:"timestamp"`
+	NodeID       string    `json:"nodeId"`
+	Name         string    `json:"name"`
+	NumberOfKeys int       `json:"numberOfKeys"`
+	KeySize      int       `json:"keySize"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// KeysConsumed returns the number of keys the report accounts for. Reports
+// without a positive number of keys count as one key.
+func (a App) KeysConsumed() int {
+	if a.NumberOfKeys > 0 {
+		return a.NumberOfKeys
+	}
+	return 1
 }
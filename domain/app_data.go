@@ -1,10 +1,12 @@
 package domain
 
+import "time"
+
 // KeyConsumptionEntry represents a single key consumption data point.
 // Timestamp follows the same format used by node timestamps.
 type KeyConsumptionEntry struct {
-	Timestamp string `json:"timestamp"`
-	Count     int    `json:"count"`
+	Timestamp time.Time `json:"timestamp"`
+	Count     int       `json:"count"`
 }
 
 // AppData holds runtime information about an application.
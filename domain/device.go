@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type ConnectedTo struct {
 	ID     string `json:"id"`
 	NodeID string `json:"node_id"`
@@ -7,8 +9,8 @@ type ConnectedTo struct {
 
 // KeyRateEntry represents a single key rate measurement for a device.
 type KeyRateEntry struct {
-	Timestamp string `json:"timestamp"`
-	Rate      int    `json:"rate"`
+	Timestamp time.Time `json:"timestamp"`
+	Rate      int       `json:"rate"`
 }
 
 // SelfReporting holds the runtime statistics reported by a device.
@@ -28,4 +30,11 @@ type Device struct {
 	Coordinates   Coordinates   `json:"coordinates"`
 	ConnectedTo   ConnectedTo   `json:"connected_to"`
 	SelfReporting SelfReporting `json:"self_reporting"`
+	// Live metrics from the latest agent report for the device, or for its
+	// node when the device never reported on its own. DataAge is the number
+	// of seconds since LastSeen.
+	StoredKeyCount int        `json:"stored_key_count"`
+	CurrentKeyRate float64    `json:"current_key_rate"`
+	LastSeen       *time.Time `json:"last_seen"`
+	DataAge        int64      `json:"data_age"`
 }
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// Event types published to stream subscribers.
+const (
+	EventNodeStatus        = "node.status"
+	EventNodeSample        = "node.sample"
+	EventAppConsumption    = "app.consumption"
+	EventAlertFiring       = "alert.firing"
+	EventAlertAcknowledged = "alert.acknowledged"
+	EventAlertResolved     = "alert.resolved"
+)
+
+// Event is a change pushed to stream subscribers. Node, Device and App name
+// what the event is about and are used for topic filtering.
+type Event struct {
+	Type      string      `json:"type"`
+	Node      string      `json:"node,omitempty"`
+	Device    string      `json:"device,omitempty"`
+	App       string      `json:"app,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
@@ -0,0 +1,85 @@
+package domain
+
+import "time"
+
+// States of an alert incident.
+const (
+	IncidentFiring       = "firing"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+// Incident is one occurrence of an alert, from the moment it fires until the
+// condition clears. Device holds the alerted device, or the target of a
+// threshold rule.
+type Incident struct {
+	ID             string     `json:"id" bson:"id"`
+	AlertID        string     `json:"alertId" bson:"alert_id"`
+	Device         string     `json:"device" bson:"device"`
+	Level          string     `json:"level" bson:"level"`
+	State          string     `json:"state" bson:"state"`
+	Subject        string     `json:"subject" bson:"subject"`
+	Message        string     `json:"message" bson:"message"`
+	Silenced       bool       `json:"silenced" bson:"silenced"`
+	StartedAt      time.Time  `json:"startedAt" bson:"started_at"`
+	AcknowledgedBy string     `json:"acknowledgedBy,omitempty" bson:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty" bson:"acknowledged_at,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty" bson:"resolved_at,omitempty"`
+	// NotifiedAt is when the last notification for the incident was sent.
+	NotifiedAt *time.Time `json:"notifiedAt,omitempty" bson:"notified_at,omitempty"`
+	// Escalated is set once the level's escalation contacts were notified.
+	Escalated bool `json:"escalated" bson:"escalated"`
+}
+
+// IncidentFilter narrows an incident history query. Zero fields match
+// everything; Start and End bound StartedAt.
+type IncidentFilter struct {
+	Device string
+	Level  string
+	Start  time.Time
+	End    time.Time
+	Limit  int
+}
+
+// Matches reports whether the incident satisfies the filter, ignoring Limit.
+func (f IncidentFilter) Matches(i Incident) bool {
+	if f.Device != "" && i.Device != f.Device {
+		return false
+	}
+	if f.Level != "" && i.Level != f.Level {
+		return false
+	}
+	if !f.Start.IsZero() && i.StartedAt.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && i.StartedAt.After(f.End) {
+		return false
+	}
+	return true
+}
+
+// Silence suppresses notifications for an alert, or for every alert of a
+// device, until Until. Incidents are still recorded while silenced.
+type Silence struct {
+	ID        string    `json:"id" bson:"id"`
+	AlertID   string    `json:"alertId,omitempty" bson:"alert_id,omitempty"`
+	Device    string    `json:"device,omitempty" bson:"device,omitempty"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy" bson:"created_by"`
+	CreatedAt time.Time `json:"createdAt" bson:"created_at"`
+	Until     time.Time `json:"until" bson:"until"`
+}
+
+// Covers reports whether the silence applies to the incident at time t.
+func (s Silence) Covers(alertID, device string, t time.Time) bool {
+	if !t.Before(s.Until) {
+		return false
+	}
+	if s.AlertID != "" && s.AlertID != alertID {
+		return false
+	}
+	if s.Device != "" && s.Device != device {
+		return false
+	}
+	return true
+}
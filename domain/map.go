@@ -7,10 +7,15 @@ type MapNode struct {
 	Endpoint    bool        `json:"endpoint"`
 }
 
+// MapConnection is a link between two nodes. Status is green, yellow or red
+// as derived by the map service from the health of both ends, with Reason
+// explaining it. KeyRate is the rate at which keys are currently exchanged.
 type MapConnection struct {
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Status string `json:"status"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Status  string  `json:"status"`
+	Reason  string  `json:"reason"`
+	KeyRate float64 `json:"keyRate"`
 }
 
 type MapData struct {
@@ -1,10 +1,12 @@
 package domain
 
+import "time"
+
 // Node represents node runtime information sent by the agents.
 type Node struct {
-	Name           string  `json:"name"`
-	Status         string  `json:"status"`
-	StoredKeyCount int     `json:"stored_key_count"`
-	CurrentKeyRate float64 `json:"current_key_rate"`
-	Timestamp      string  `json:"timestamp"`
+	Name           string    `json:"name"`
+	Status         string    `json:"status"`
+	StoredKeyCount int       `json:"stored_key_count"`
+	CurrentKeyRate float64   `json:"current_key_rate"`
+	Timestamp      time.Time `json:"timestamp"`
 }
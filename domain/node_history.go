@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// NodeHistoryPoint summarises the reports of a node within one time bucket.
+// Status is "down" if any report in the bucket was down and the last reported
+// status otherwise; the metrics are averaged over the bucket.
+type NodeHistoryPoint struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Status         string    `json:"status"`
+	StoredKeyCount int       `json:"stored_key_count"`
+	CurrentKeyRate float64   `json:"current_key_rate"`
+	Samples        int       `json:"samples"`
+}
+
+// NodeHistory is the downsampled status timeline of a node.
+type NodeHistory struct {
+	Node   string             `json:"node"`
+	Start  time.Time          `json:"start"`
+	End    time.Time          `json:"end"`
+	Step   string             `json:"step"`
+	Points []NodeHistoryPoint `json:"points"`
+}
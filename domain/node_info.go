@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type Coordinates struct {
 	Lat  float64 `json:"lat"`
 	Long float64 `json:"long"`
@@ -33,10 +35,16 @@ type NodeInfo struct {
 	ScheduledMaintenance []Maintenance `json:"scheduledMaintenance"`
 	Devices              []Device      `json:"devices"`
 	Events               []NodeEvent   `json:"events"`
+	// Live metrics from the latest agent report for the node or one of its
+	// devices. DataAge is the number of seconds since LastSeen.
+	StoredKeyCount int        `json:"storedKeyCount"`
+	CurrentKeyRate float64    `json:"currentKeyRate"`
+	LastSeen       *time.Time `json:"lastSeen"`
+	DataAge        int64      `json:"dataAge"`
 }
 
 // NodeEvent represents a status change event for a node.
 type NodeEvent struct {
-	Timestamp string `json:"timestamp"`
-	Message   string `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
 }
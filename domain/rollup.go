@@ -0,0 +1,51 @@
+package domain
+
+import "time"
+
+// Series kept as rollups.
+const (
+	SeriesAppConsumption = "app_consumption"
+	SeriesDeviceKeyRate  = "device_key_rate"
+	SeriesNodeKeyCount   = "node_key_count"
+)
+
+// RollupResolutions are the bucket sizes rollups are kept at, finest first.
+var RollupResolutions = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
+
+// RollupPoint aggregates the samples of one series key falling into the
+// bucket starting at Timestamp.
+type RollupPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Count     int       `json:"count"`
+	Sum       float64   `json:"sum"`
+	Avg       float64   `json:"avg"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+}
+
+// Merge folds another bucket into p. Avg is recomputed.
+func (p *RollupPoint) Merge(o RollupPoint) {
+	if p.Count == 0 {
+		p.Min, p.Max = o.Min, o.Max
+	} else {
+		p.Min = min(p.Min, o.Min)
+		p.Max = max(p.Max, o.Max)
+	}
+	p.Count += o.Count
+	p.Sum += o.Sum
+	if p.Count > 0 {
+		p.Avg = p.Sum / float64(p.Count)
+	}
+}
+
+// RollupSeries is the timeline of a series between Start and End, with one
+// point per Step for every key (app, device or node) that reported.
+// Resolution is the rollup the points were computed from.
+type RollupSeries struct {
+	Series     string                   `json:"series"`
+	Start      time.Time                `json:"start"`
+	End        time.Time                `json:"end"`
+	Step       string                   `json:"step"`
+	Resolution string                   `json:"resolution"`
+	Data       map[string][]RollupPoint `json:"data"`
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Session ties an opaque login token to a user. Only a hash of the token is
+// persisted; the token itself is handed to the browser as the auth_token
+// cookie.
+type Session struct {
+	TokenHash string    `json:"-" bson:"token_hash"`
+	UserID    string    `json:"userId" bson:"user_id"`
+	CreatedAt time.Time `json:"createdAt" bson:"created_at"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expires_at"`
+}
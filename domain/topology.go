@@ -0,0 +1,61 @@
+package domain
+
+// Topology sources.
+const (
+	// TopologySourceFile marks a topology imported from config.yaml.
+	TopologySourceFile = "file"
+	// TopologySourceAPI marks a topology edited through the topology API.
+	TopologySourceAPI = "api"
+)
+
+// Topology is the definition of the QKD network: the nodes and their
+// location, the devices (KMEs) they host, the links between devices and the
+// paths consumers obtain keys over.
+type Topology struct {
+	Nodes     []TopologyNode   `json:"nodes"`
+	Devices   []TopologyDevice `json:"devices"`
+	Links     []TopologyLink   `json:"links"`
+	Consumers []string         `json:"consumers"`
+	Paths     []ConsumerPath   `json:"paths"`
+	// Settings holds the other top-level keys of config.yaml, such as
+	// key_parameters, so that an export reproduces the imported file.
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	// Source tells whether the topology was last loaded from config.yaml or
+	// edited through the API.
+	Source string `json:"source,omitempty"`
+}
+
+// TopologyNode is a site of the network. Coordinates are required. KME is
+// the URL of the node's KME and Type is shown on the dashboard; without it
+// nodes hosting more than one device are trusted nodes and others terminals.
+type TopologyNode struct {
+	Name        string       `json:"name"`
+	Coordinates *Coordinates `json:"coordinates"`
+	KME         string       `json:"kme,omitempty"`
+	Type        string       `json:"type,omitempty"`
+}
+
+// TopologyDevice is a device hosted by a node. URL is the address of the KME
+// it is reached through, when it differs from the node's.
+type TopologyDevice struct {
+	ID   string `json:"id"`
+	Node string `json:"node"`
+	URL  string `json:"url,omitempty"`
+}
+
+// TopologyLink is a quantum link between two devices. Length is the optional
+// third field of a config.yaml link, such as the fibre length.
+type TopologyLink struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Length string `json:"length,omitempty"`
+}
+
+// ConsumerPath lists the routes a consumer uses from a device. Each route is
+// a peer device followed by the consumer served at the other end, as in the
+// paths section of config.yaml.
+type ConsumerPath struct {
+	Device   string     `json:"device"`
+	Consumer string     `json:"consumer"`
+	Routes   [][]string `json:"routes"`
+}
@@ -0,0 +1,166 @@
+// Package metrics exposes MonDash telemetry in the Prometheus format.
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"mondash-backend/logger"
+	"mondash-backend/services"
+)
+
+const namespace = "mondash"
+
+// Collector reads the current node, device, app and alert state from the
+// services on every scrape.
+type Collector struct {
+	Nodes   *services.NodeService
+	Devices *services.DeviceService
+	Apps    *services.AppService
+	Alerts  *services.AlertService
+
+	nodeKeyCount   *prometheus.Desc
+	nodeKeyRate    *prometheus.Desc
+	nodeUp         *prometheus.Desc
+	nodeDataAge    *prometheus.Desc
+	deviceStatus   *prometheus.Desc
+	deviceKeyRate  *prometheus.Desc
+	appConsumed    *prometheus.Desc
+	appKeySize     *prometheus.Desc
+	activeAlerts   *prometheus.Desc
+	scrapeFailures *prometheus.Desc
+}
+
+// NewCollector returns a collector reading from the given services.
+func NewCollector(nodes *services.NodeService, devices *services.DeviceService, apps *services.AppService, alerts *services.AlertService) *Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+	}
+	return &Collector{
+		Nodes:   nodes,
+		Devices: devices,
+		Apps:    apps,
+		Alerts:  alerts,
+
+		nodeKeyCount:   desc("node_stored_key_count", "Keys stored by the node's KME.", "node"),
+		nodeKeyRate:    desc("node_current_key_rate", "Current key rate reported for the node.", "node"),
+		nodeUp:         desc("node_up", "Whether the node is active (1) or not (0).", "node"),
+		nodeDataAge:    desc("node_data_age_seconds", "Seconds since the node last reported.", "node"),
+		deviceStatus:   desc("device_status", "Current status of the device; the series with the active status is 1.", "node", "device", "status"),
+		deviceKeyRate:  desc("device_key_rate", "Key rate of the device's latest report.", "node", "device"),
+		appConsumed:    desc("app_keys_consumed_total", "Keys consumed by the app since the server started.", "app"),
+		appKeySize:     desc("app_key_size", "Key size last reported by the app.", "app"),
+		activeAlerts:   desc("active_alerts", "Number of currently active alerts.", "level"),
+		scrapeFailures: desc("scrape_errors", "Sources that could not be read during this scrape.", "source"),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.nodeKeyCount, c.nodeKeyRate, c.nodeUp, c.nodeDataAge,
+		c.deviceStatus, c.deviceKeyRate, c.appConsumed, c.appKeySize,
+		c.activeAlerts, c.scrapeFailures,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	c.collectNodes(ctx, ch)
+	c.collectDevices(ctx, ch)
+	c.collectApps(ctx, ch)
+	c.collectAlerts(ctx, ch)
+}
+
+func (c *Collector) failed(ch chan<- prometheus.Metric, source string, err error) {
+	logger.Log.Warnw("metrics scrape failed", "source", source, "error", err)
+	ch <- prometheus.MustNewConstMetric(c.scrapeFailures, prometheus.GaugeValue, 1, source)
+}
+
+func (c *Collector) collectNodes(ctx context.Context, ch chan<- prometheus.Metric) {
+	if c.Nodes == nil {
+		return
+	}
+	nodes, err := c.Nodes.List(ctx)
+	if err != nil {
+		c.failed(ch, "nodes", err)
+		return
+	}
+	for _, n := range nodes {
+		ch <- prometheus.MustNewConstMetric(c.nodeKeyCount, prometheus.GaugeValue, float64(n.StoredKeyCount), n.ID)
+		ch <- prometheus.MustNewConstMetric(c.nodeKeyRate, prometheus.GaugeValue, n.CurrentKeyRate, n.ID)
+		ch <- prometheus.MustNewConstMetric(c.nodeUp, prometheus.GaugeValue, boolValue(n.Status == "active"), n.ID)
+		if n.LastSeen != nil {
+			ch <- prometheus.MustNewConstMetric(c.nodeDataAge, prometheus.GaugeValue, float64(n.DataAge), n.ID)
+		}
+	}
+}
+
+func (c *Collector) collectDevices(ctx context.Context, ch chan<- prometheus.Metric) {
+	if c.Devices == nil {
+		return
+	}
+	devices, err := c.Devices.List(ctx)
+	if err != nil {
+		c.failed(ch, "devices", err)
+		return
+	}
+	for _, d := range devices {
+		ch <- prometheus.MustNewConstMetric(c.deviceStatus, prometheus.GaugeValue, 1, d.NodeID, d.ID, d.Status)
+		ch <- prometheus.MustNewConstMetric(c.deviceKeyRate, prometheus.GaugeValue, d.CurrentKeyRate, d.NodeID, d.ID)
+	}
+}
+
+func (c *Collector) collectApps(ctx context.Context, ch chan<- prometheus.Metric) {
+	if c.Apps == nil {
+		return
+	}
+	consumed := c.Apps.Consumed()
+	apps, err := c.Apps.List(ctx)
+	if err != nil {
+		c.failed(ch, "apps", err)
+		return
+	}
+	for _, a := range apps {
+		ch <- prometheus.MustNewConstMetric(c.appConsumed, prometheus.CounterValue, float64(consumed[a.Name]), a.Name)
+		ch <- prometheus.MustNewConstMetric(c.appKeySize, prometheus.GaugeValue, float64(a.KeySize), a.Name)
+		delete(consumed, a.Name)
+	}
+	for name, n := range consumed {
+		ch <- prometheus.MustNewConstMetric(c.appConsumed, prometheus.CounterValue, float64(n), name)
+	}
+}
+
+func (c *Collector) collectAlerts(ctx context.Context, ch chan<- prometheus.Metric) {
+	if c.Alerts == nil {
+		return
+	}
+	active, err := c.Alerts.ActiveAlerts(ctx)
+	if err != nil {
+		c.failed(ch, "alerts", err)
+		return
+	}
+	counts := map[string]int{}
+	if info, err := c.Alerts.List(ctx); err == nil {
+		for _, l := range info.AlertLevels {
+			counts[l] = 0
+		}
+	}
+	for _, a := range active {
+		counts[a.Level]++
+	}
+	for level, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.activeAlerts, prometheus.GaugeValue, float64(n), level)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTP holds the request metrics recorded by the router middleware.
+type HTTP struct {
+	Requests *prometheus.CounterVec
+	Duration *prometheus.HistogramVec
+	InFlight prometheus.Gauge
+}
+
+// NewHTTP creates the request metrics.
+func NewHTTP() *HTTP {
+	return &HTTP{
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (h *HTTP) Describe(ch chan<- *prometheus.Desc) {
+	h.Requests.Describe(ch)
+	h.Duration.Describe(ch)
+	h.InFlight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (h *HTTP) Collect(ch chan<- prometheus.Metric) {
+	h.Requests.Collect(ch)
+	h.Duration.Collect(ch)
+	h.InFlight.Collect(ch)
+}
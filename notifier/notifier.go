@@ -0,0 +1,37 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Channels an alert can be delivered through.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelSyslog  = "syslog"
+)
+
+// Channels lists the supported delivery channels.
+var Channels = []string{ChannelEmail, ChannelWebhook, ChannelSlack, ChannelSyslog}
+
+// Message is a single alert notification.
+type Message struct {
+	AlertID   string    `json:"alert_id"`
+	Level     string    `json:"level"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notifier delivers a message to a destination. The meaning of the
+// destination depends on the channel: an email address for SMTP, a URL for
+// webhooks and nothing for syslog.
+type Notifier interface {
+	Notify(ctx context.Context, to string, msg Message) error
+}
+
+// defaultClient is used by the webhook notifiers when no client is given.
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
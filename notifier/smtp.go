@@ -0,0 +1,35 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+)
+
+// SMTP delivers notifications by email.
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Notify sends the message to the given address.
+func (n SMTP) Notify(_ context.Context, to string, msg Message) error {
+	if n.Host == "" || n.Port == "" || n.From == "" {
+		return errors.New("smtp not configured")
+	}
+	if to == "" {
+		return errors.New("missing email address")
+	}
+	addr := n.Host + ":" + n.Port
+	body := []byte("To: " + to + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"\r\n" + msg.Body + "\r\n")
+	var auth smtp.Auth
+	if n.Username != "" || n.Password != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	return smtp.SendMail(addr, auth, n.From, []string{to}, body)
+}
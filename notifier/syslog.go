@@ -0,0 +1,37 @@
+package notifier
+
+import (
+	"context"
+	"log/syslog"
+)
+
+// Syslog writes notifications to a syslog daemon. An empty Network and Addr
+// use the local daemon.
+type Syslog struct {
+	Network string
+	Addr    string
+	Tag     string
+}
+
+// Notify writes the message at a priority derived from the alert level. The
+// destination is ignored.
+func (n Syslog) Notify(_ context.Context, _ string, msg Message) error {
+	tag := n.Tag
+	if tag == "" {
+		tag = "mondash"
+	}
+	w, err := syslog.Dial(n.Network, n.Addr, syslog.LOG_WARNING|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	line := msg.Subject + ": " + msg.Body
+	switch msg.Level {
+	case "high":
+		return w.Crit(line)
+	case "medium":
+		return w.Err(line)
+	default:
+		return w.Warning(line)
+	}
+}
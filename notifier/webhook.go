@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Webhook posts the message as JSON to an arbitrary URL.
+type Webhook struct {
+	Client *http.Client
+}
+
+// Notify posts the message to the URL.
+func (n Webhook) Notify(ctx context.Context, url string, msg Message) error {
+	return postJSON(ctx, n.Client, url, msg)
+}
+
+// Slack posts the message to a Slack or Mattermost incoming webhook.
+type Slack struct {
+	Client *http.Client
+}
+
+// Notify posts the message to the incoming webhook URL.
+func (n Slack) Notify(ctx context.Context, url string, msg Message) error {
+	text := fmt.Sprintf("*[%s] %s*\n%s", msg.Level, msg.Subject, msg.Body)
+	return postJSON(ctx, n.Client, url, struct {
+		Text string `json:"text"`
+	}{Text: text})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	if url == "" {
+		return errors.New("missing webhook url")
+	}
+	if client == nil {
+		client = defaultClient
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
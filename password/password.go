@@ -0,0 +1,34 @@
+package password
+
+import (
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hash returns the bcrypt hash of a plaintext password.
+func Hash(plain string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// IsHash reports whether stored is a bcrypt hash rather than a legacy
+// plaintext password.
+func IsHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// Verify checks a plaintext password against the stored value. Legacy
+// plaintext values are still accepted; upgrade is true when the stored value
+// should be replaced with a fresh hash.
+func Verify(stored, plain string) (ok, upgrade bool) {
+	if IsHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) == nil, false
+	}
+	ok = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+	return ok, ok
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"mondash-backend/domain"
+)
+
+// ErrNoAgentToken is returned by AgentRepository.ByTokenHash for unknown
+// credentials.
+var ErrNoAgentToken = errors.New("agent token not found")
+
+// AgentRepository defines persistence methods for agent credentials.
+type AgentRepository interface {
+	Add(ctx context.Context, token domain.AgentToken) error
+	List(ctx context.Context) ([]domain.AgentToken, error)
+	// ByTokenHash returns the credential stored under the given token hash,
+	// including revoked ones.
+	ByTokenHash(ctx context.Context, hash string) (domain.AgentToken, error)
+	// Revoke marks the credential with the given ID as revoked.
+	Revoke(ctx context.Context, id string) error
+}
@@ -1,10 +1,24 @@
 package repository
 
-import "mondash-backend/domain"
+import (
+	"context"
+
+	"mondash-backend/domain"
+)
 
 // AlertRepository defines persistence methods for alerts.
 type AlertRepository interface {
 	// List returns the alert configuration (levels and registered alerts).
-	List() (domain.AlertInfo, error)
-	Add(alert domain.Alert) error
+	List(ctx context.Context) (domain.AlertInfo, error)
+	Add(ctx context.Context, alert domain.Alert) error
+	// Update replaces the registered alert with the same ID.
+	Update(ctx context.Context, alert domain.Alert) error
+	// Delete removes the registered alert with the given ID.
+	Delete(ctx context.Context, id string) error
+	// SetEscalations replaces the escalation policies.
+	SetEscalations(ctx context.Context, policies []domain.EscalationPolicy) error
+	// RecordDelivery stores the outcome of a notification delivery.
+	RecordDelivery(ctx context.Context, delivery domain.AlertDelivery) error
+	// Deliveries returns up to `limit` delivery records, newest first.
+	Deliveries(ctx context.Context, limit int) ([]domain.AlertDelivery, error)
 }
@@ -1,11 +1,19 @@
 package repository
 
-import "mondash-backend/domain"
+import (
+	"context"
+	"time"
+
+	"mondash-backend/domain"
+)
 
 // AppRepository defines persistence methods for apps.
 type AppRepository interface {
-	Update(app *domain.App) error
-	List() ([]domain.AppData, error)
+	Update(ctx context.Context, app *domain.App) error
+	List(ctx context.Context) ([]domain.AppData, error)
 	// Timeline returns key consumption history for all apps within the given time range.
-	Timeline(start, end string) ([]domain.AppData, error)
+	Timeline(ctx context.Context, start, end time.Time) ([]domain.AppData, error)
+	// Sync replaces the app definitions with apps. Key consumption data is
+	// kept.
+	Sync(ctx context.Context, apps []domain.AppData) error
 }
@@ -1,7 +1,25 @@
 package repository
 
-// AuthRepository defines authentication persistence methods.
+import (
+	"context"
+	"errors"
+
+	"mondash-backend/domain"
+)
+
+// ErrNoUser is returned by AuthRepository.UserByID for unknown accounts.
+var ErrNoUser = errors.New("user not found")
+
+// AuthRepository defines authentication persistence methods. Passwords are
+// hashed and verified by the service layer; repositories only store them.
 type AuthRepository interface {
-	Login(username, password string) (string, error)
-	Register(username, email, password, role string) error
+	// Credentials returns the user with the given username together with
+	// the stored password hash (or a legacy plaintext password).
+	Credentials(ctx context.Context, username string) (domain.User, string, error)
+	// SetPassword replaces the stored password hash of a user.
+	SetPassword(ctx context.Context, username, hash string) error
+	Register(ctx context.Context, username, email, passwordHash, role, affiliation string) error
+	// UserByID returns the public information of the account with the given
+	// ID.
+	UserByID(ctx context.Context, id string) (domain.User, error)
 }
@@ -1,14 +1,21 @@
 package repository
 
-import "mondash-backend/domain"
+import (
+	"context"
+
+	"mondash-backend/domain"
+)
 
 // DeviceRepository defines persistence methods for devices.
 type DeviceRepository interface {
 	// List returns all devices. When silent is true, implementations should
 	// suppress verbose logging.
-	List(silent bool) ([]domain.Device, error)
+	List(ctx context.Context, silent bool) ([]domain.Device, error)
 	// KeyRateHistory returns up to `limit` key rate entries for a device.
-	KeyRateHistory(deviceID string, limit int) ([]domain.KeyRateEntry, error)
+	KeyRateHistory(ctx context.Context, deviceID string, limit int) ([]domain.KeyRateEntry, error)
+	// LatestKeyRates returns the most recent key rate entry of each listed
+	// device that has one, including zero rates.
+	LatestKeyRates(ctx context.Context, deviceIDs []string) (map[string]domain.KeyRateEntry, error)
 	// AddKeyRate stores a new key rate entry for the given device.
-	AddKeyRate(deviceID string, entry domain.KeyRateEntry) error
+	AddKeyRate(ctx context.Context, deviceID string, entry domain.KeyRateEntry) error
 }
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"mondash-backend/domain"
+)
+
+// IncidentRepository defines persistence methods for alert incidents and
+// silences.
+type IncidentRepository interface {
+	// Save inserts the incident or replaces the one with the same ID.
+	Save(ctx context.Context, incident domain.Incident) error
+	// Open returns all incidents that are not resolved.
+	Open(ctx context.Context) ([]domain.Incident, error)
+	// History returns the incidents matching the filter, newest first.
+	History(ctx context.Context, filter domain.IncidentFilter) ([]domain.Incident, error)
+
+	AddSilence(ctx context.Context, silence domain.Silence) error
+	// Silences returns the silences that have not yet expired.
+	Silences(ctx context.Context) ([]domain.Silence, error)
+	DeleteSilence(ctx context.Context, id string) error
+}
@@ -0,0 +1,72 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// AgentRepo is an in-memory implementation of repository.AgentRepository.
+type AgentRepo struct {
+	mu     sync.RWMutex
+	tokens []domain.AgentToken
+}
+
+// NewAgentRepo creates an empty AgentRepo.
+func NewAgentRepo() *AgentRepo {
+	return &AgentRepo{}
+}
+
+// Add stores a new agent credential.
+func (r *AgentRepo) Add(_ context.Context, t domain.AgentToken) error {
+	if t.ID == "" || t.TokenHash == "" || len(t.Nodes) == 0 {
+		return errors.New("invalid agent token")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = append(r.tokens, t)
+	return nil
+}
+
+// List returns all agent credentials.
+func (r *AgentRepo) List(_ context.Context) ([]domain.AgentToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tokens := make([]domain.AgentToken, len(r.tokens))
+	copy(tokens, r.tokens)
+	return tokens, nil
+}
+
+// ByTokenHash returns the credential stored under the given hash.
+func (r *AgentRepo) ByTokenHash(_ context.Context, hash string) (domain.AgentToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.tokens {
+		if t.TokenHash == hash {
+			return t, nil
+		}
+	}
+	return domain.AgentToken{}, repository.ErrNoAgentToken
+}
+
+// Revoke marks the credential as revoked.
+func (r *AgentRepo) Revoke(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.tokens {
+		if r.tokens[i].ID == id {
+			if !r.tokens[i].Revoked {
+				r.tokens[i].Revoked = true
+				r.tokens[i].RevokedAt = time.Now()
+			}
+			return nil
+		}
+	}
+	return errors.New("agent token not found")
+}
+
+var _ repository.AgentRepository = (*AgentRepo)(nil)
@@ -1,14 +1,22 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
+	"sync"
 
 	"mondash-backend/domain"
 )
 
+// deliveryLimit bounds the number of delivery records kept in memory.
+const deliveryLimit = 500
+
 // AlertRepo is an in-memory implementation of repository.AlertRepository.
 type AlertRepo struct {
 	data domain.AlertInfo
+
+	mu         sync.Mutex
+	deliveries []domain.AlertDelivery
 }
 
 var defaultAlertData = domain.AlertInfo{
@@ -42,16 +50,83 @@ func NewAlertRepo() *AlertRepo {
 	return &AlertRepo{data: DefaultAlertData()}
 }
 
-// List returns all alerts.
-func (r *AlertRepo) List() (domain.AlertInfo, error) {
-	return r.data, nil
+// List returns a copy of the alert configuration.
+func (r *AlertRepo) List(_ context.Context) (domain.AlertInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.data
+	res.Alerts = append([]domain.Alert{}, r.data.Alerts...)
+	res.Escalations = append([]domain.EscalationPolicy(nil), r.data.Escalations...)
+	return res, nil
 }
 
 // Add appends an alert after validation.
-func (r *AlertRepo) Add(a domain.Alert) error {
-	if a.ID == "" || a.Device == "" || a.Level == "" {
+func (r *AlertRepo) Add(_ context.Context, a domain.Alert) error {
+	if a.ID == "" || a.Level == "" || (a.Device == "" && a.Target == "") {
 		return errors.New("invalid alert")
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.data.Alerts = append(r.data.Alerts, a)
 	return nil
 }
+
+// Update replaces the alert with the same ID.
+func (r *AlertRepo) Update(_ context.Context, a domain.Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.data.Alerts {
+		if r.data.Alerts[i].ID == a.ID {
+			r.data.Alerts[i] = a
+			return nil
+		}
+	}
+	return errors.New("alert not found")
+}
+
+// Delete removes the alert with the given ID.
+func (r *AlertRepo) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.data.Alerts {
+		if a.ID == id {
+			r.data.Alerts = append(r.data.Alerts[:i:i], r.data.Alerts[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("alert not found")
+}
+
+// SetEscalations replaces the escalation policies.
+func (r *AlertRepo) SetEscalations(_ context.Context, policies []domain.EscalationPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data.Escalations = append([]domain.EscalationPolicy(nil), policies...)
+	return nil
+}
+
+// RecordDelivery appends a delivery record, dropping the oldest ones beyond
+// the limit.
+func (r *AlertRepo) RecordDelivery(_ context.Context, d domain.AlertDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, d)
+	if len(r.deliveries) > deliveryLimit {
+		r.deliveries = r.deliveries[len(r.deliveries)-deliveryLimit:]
+	}
+	return nil
+}
+
+// Deliveries returns up to `limit` delivery records, newest first.
+func (r *AlertRepo) Deliveries(_ context.Context, limit int) ([]domain.AlertDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []domain.AlertDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0; i-- {
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		res = append(res, r.deliveries[i])
+	}
+	return res, nil
+}
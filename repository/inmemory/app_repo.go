@@ -1,14 +1,19 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"time"
 
 	"mondash-backend/config"
 	"mondash-backend/domain"
+	"mondash-backend/repository"
 )
 
 // AppRepo is an in-memory implementation of repository.AppRepository.
 type AppRepo struct {
+	mu   sync.RWMutex
 	data []domain.AppData
 }
 
@@ -19,24 +24,7 @@ func DefaultAppData() []domain.AppData {
 	if err != nil {
 		return []domain.AppData{}
 	}
-	nodesByConsumer := cfg.NodesByConsumer()
-	apps := make([]domain.AppData, len(cfg.Consumers))
-	for i, name := range cfg.Consumers {
-		nodes := nodesByConsumer[name]
-		if nodes == nil {
-			nodes = []string{}
-		}
-		apps[i] = domain.AppData{
-			Name:                  name,
-			Certificate:           name + "-cert.pem",
-			Nodes:                 nodes,
-			KeyConsumptionHistory: []domain.KeyConsumptionEntry{},
-			ErrorHistory:          []string{},
-			NumberOfKeys:          0,
-			KeySize:               0,
-		}
-	}
-	return apps
+	return repository.AppsFromTopology(repository.TopologyFromConfig(cfg))
 }
 
 // NewAppRepo creates a new AppRepo with data loaded from the config file.
@@ -45,10 +33,12 @@ func NewAppRepo() *AppRepo {
 }
 
 // Update performs a basic validation and pretends to update the app.
-func (r *AppRepo) Update(a *domain.App) error {
+func (r *AppRepo) Update(_ context.Context, a *domain.App) error {
 	if a == nil || a.Name == "" {
 		return errors.New("invalid app")
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	for i := range r.data {
 		if r.data[i].Name == a.Name {
 			r.data[i].NumberOfKeys = a.NumberOfKeys
@@ -60,11 +50,33 @@ func (r *AppRepo) Update(a *domain.App) error {
 }
 
 // List returns all apps.
-func (r *AppRepo) List() ([]domain.AppData, error) {
+func (r *AppRepo) List(_ context.Context) ([]domain.AppData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.data, nil
 }
 
+// Sync replaces the app definitions, keeping the key counts of the apps that
+// remain defined.
+func (r *AppRepo) Sync(_ context.Context, apps []domain.AppData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := make(map[string]domain.AppData, len(r.data))
+	for _, a := range r.data {
+		prev[a.Name] = a
+	}
+	data := append([]domain.AppData(nil), apps...)
+	for i := range data {
+		if old, ok := prev[data[i].Name]; ok {
+			data[i].NumberOfKeys = old.NumberOfKeys
+			data[i].KeySize = old.KeySize
+		}
+	}
+	r.data = data
+	return nil
+}
+
 // Timeline returns no data for the in-memory repository.
-func (r *AppRepo) Timeline(start, end string) ([]domain.AppData, error) {
+func (r *AppRepo) Timeline(_ context.Context, start, end time.Time) ([]domain.AppData, error) {
 	return []domain.AppData{}, nil
 }
@@ -1,28 +1,38 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
-	"os"
 	"strconv"
+	"sync"
 
 	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/password"
+	"mondash-backend/repository"
 )
 
 // AuthUser represents a stored authentication user.
 type AuthUser struct {
 	domain.User
 	Username string
+	// Password holds the bcrypt hash of the user's password.
 	Password string
 }
 
 // AuthRepo is an in-memory implementation of repository.AuthRepository.
 // It stores users in a map keyed by username.
 type AuthRepo struct {
+	mu    sync.RWMutex
 	users map[string]AuthUser
 }
 
 // NewAuthRepo creates a new AuthRepo seeded with a default admin user.
 func NewAuthRepo() *AuthRepo {
+	hash, err := password.Hash("admin")
+	if err != nil {
+		logger.Log.Errorw("failed to hash default admin password", "error", err)
+	}
 	admin := AuthUser{
 		User: domain.User{
 			ID:          "1",
@@ -32,40 +42,70 @@ func NewAuthRepo() *AuthRepo {
 			Role:        "admin",
 		},
 		Username: "admin",
-		Password: "admin",
+		Password: hash,
 	}
 	return &AuthRepo{users: map[string]AuthUser{"admin": admin}}
 }
 
-// Login returns a dummy token if credentials are non-empty.
-func (r *AuthRepo) Login(username, password string) (string, error) {
+// Credentials returns the user and its stored password hash.
+func (r *AuthRepo) Credentials(_ context.Context, username string) (domain.User, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	user, ok := r.users[username]
-	if !ok || user.Password != password {
-		return "", errors.New("invalid credentials")
+	if !ok {
+		return domain.User{}, "", errors.New("invalid credentials")
 	}
-	token := os.Getenv("AUTH_TOKEN")
-	if token == "" {
-		token = "abc"
+	return user.User, user.Password, nil
+}
+
+// SetPassword replaces the stored password hash of a user.
+func (r *AuthRepo) SetPassword(_ context.Context, username, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[username]
+	if !ok {
+		return errors.New("user not found")
 	}
-	return token, nil
+	user.Password = hash
+	r.users[username] = user
+	return nil
 }
 
 // Register performs basic validation.
-func (r *AuthRepo) Register(username, email, password, role string) error {
-	if username == "" || email == "" || password == "" || role == "" {
+func (r *AuthRepo) Register(_ context.Context, username, email, passwordHash, role, affiliation string) error {
+	if username == "" || email == "" || passwordHash == "" || role == "" {
 		return errors.New("invalid registration")
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[username]; ok {
+		return errors.New("username already taken")
+	}
 	id := strconv.Itoa(len(r.users) + 1)
 	r.users[username] = AuthUser{
 		User: domain.User{
 			ID:          id,
 			Email:       email,
 			FullName:    username,
-			Affiliation: "",
+			Affiliation: affiliation,
 			Role:        role,
 		},
 		Username: username,
-		Password: password,
+		Password: passwordHash,
 	}
 	return nil
 }
+
+// UserByID returns the public information of the account with the given ID.
+func (r *AuthRepo) UserByID(_ context.Context, id string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if u.ID == id {
+			return u.User, nil
+		}
+	}
+	return domain.User{}, repository.ErrNoUser
+}
+
+var _ repository.AuthRepository = (*AuthRepo)(nil)
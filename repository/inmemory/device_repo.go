@@ -1,6 +1,7 @@
 package inmemory
 
 import (
+	"context"
 	"sort"
 	"time"
 
@@ -21,11 +22,11 @@ func NewDeviceRepo(nodeRepo *NodeRepo) *DeviceRepo {
 }
 
 // List returns all devices from all nodes.
-func (r *DeviceRepo) List(silent bool) ([]domain.Device, error) {
+func (r *DeviceRepo) List(ctx context.Context, silent bool) ([]domain.Device, error) {
 	if r.nodes == nil {
 		return []domain.Device{}, nil
 	}
-	nodes, err := r.nodes.List()
+	nodes, err := r.nodes.List(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +41,7 @@ func (r *DeviceRepo) List(silent bool) ([]domain.Device, error) {
 }
 
 // KeyRateHistory returns stored key rate entries for the given device.
-func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry, error) {
+func (r *DeviceRepo) KeyRateHistory(_ context.Context, id string, limit int) ([]domain.KeyRateEntry, error) {
 	entries := r.history[id]
 	var filtered []domain.KeyRateEntry
 	for _, e := range entries {
@@ -49,21 +50,13 @@ func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry
 		}
 	}
 
-	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Timestamp < filtered[j].Timestamp })
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Timestamp.Before(filtered[j].Timestamp) })
 
 	const tolerance = 100 * time.Millisecond
 	var result []domain.KeyRateEntry
 	var group []domain.KeyRateEntry
 	var lastTime time.Time
 
-	parseTS := func(ts string) (time.Time, error) {
-		t, err := time.Parse(time.RFC3339Nano, ts)
-		if err != nil {
-			return time.Parse(time.RFC3339, ts)
-		}
-		return t, nil
-	}
-
 	flush := func() {
 		if len(group) == 0 {
 			return
@@ -78,8 +71,8 @@ func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry
 	}
 
 	for _, rec := range filtered {
-		ts, err := parseTS(rec.Timestamp)
-		if err != nil {
+		ts := rec.Timestamp
+		if ts.IsZero() {
 			continue
 		}
 		if len(group) == 0 {
@@ -106,8 +99,21 @@ func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry
 	return result, nil
 }
 
+// LatestKeyRates returns the most recent entry of each device's history.
+func (r *DeviceRepo) LatestKeyRates(_ context.Context, ids []string) (map[string]domain.KeyRateEntry, error) {
+	res := map[string]domain.KeyRateEntry{}
+	for _, id := range ids {
+		for _, e := range r.history[id] {
+			if latest, ok := res[id]; !ok || !e.Timestamp.Before(latest.Timestamp) {
+				res[id] = e
+			}
+		}
+	}
+	return res, nil
+}
+
 // AddKeyRate appends a key rate entry to the device's history.
-func (r *DeviceRepo) AddKeyRate(id string, entry domain.KeyRateEntry) error {
+func (r *DeviceRepo) AddKeyRate(_ context.Context, id string, entry domain.KeyRateEntry) error {
 	r.history[id] = append(r.history[id], entry)
 	return nil
 }
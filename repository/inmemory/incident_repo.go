@@ -0,0 +1,113 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// IncidentRepo is an in-memory implementation of
+// repository.IncidentRepository.
+type IncidentRepo struct {
+	mu        sync.Mutex
+	incidents []domain.Incident
+	silences  []domain.Silence
+}
+
+// NewIncidentRepo creates an empty IncidentRepo.
+func NewIncidentRepo() *IncidentRepo {
+	return &IncidentRepo{}
+}
+
+// Save inserts the incident or replaces the one with the same ID.
+func (r *IncidentRepo) Save(_ context.Context, i domain.Incident) error {
+	if i.ID == "" || i.AlertID == "" {
+		return errors.New("invalid incident")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.incidents {
+		if r.incidents[k].ID == i.ID {
+			r.incidents[k] = i
+			return nil
+		}
+	}
+	r.incidents = append(r.incidents, i)
+	return nil
+}
+
+// Open returns all incidents that are not resolved.
+func (r *IncidentRepo) Open(_ context.Context) ([]domain.Incident, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []domain.Incident{}
+	for _, i := range r.incidents {
+		if i.State != domain.IncidentResolved {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+// History returns the incidents matching the filter, newest first.
+func (r *IncidentRepo) History(_ context.Context, f domain.IncidentFilter) ([]domain.Incident, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []domain.Incident{}
+	for _, i := range r.incidents {
+		if f.Matches(i) {
+			res = append(res, i)
+		}
+	}
+	sort.SliceStable(res, func(a, b int) bool { return res[a].StartedAt.After(res[b].StartedAt) })
+	if f.Limit > 0 && len(res) > f.Limit {
+		res = res[:f.Limit]
+	}
+	return res, nil
+}
+
+// AddSilence stores a new silence.
+func (r *IncidentRepo) AddSilence(_ context.Context, s domain.Silence) error {
+	if s.ID == "" {
+		return errors.New("invalid silence")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.silences = append(r.silences, s)
+	return nil
+}
+
+// Silences returns the unexpired silences, dropping expired ones.
+func (r *IncidentRepo) Silences(_ context.Context) ([]domain.Silence, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	kept := r.silences[:0]
+	for _, s := range r.silences {
+		if s.Until.After(now) {
+			kept = append(kept, s)
+		}
+	}
+	r.silences = kept
+	return append([]domain.Silence{}, kept...), nil
+}
+
+// DeleteSilence removes the silence with the given ID.
+func (r *IncidentRepo) DeleteSilence(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, s := range r.silences {
+		if s.ID == id {
+			r.silences = append(r.silences[:k], r.silences[k+1:]...)
+			return nil
+		}
+	}
+	return errors.New("silence not found")
+}
+
+var _ repository.IncidentRepository = (*IncidentRepo)(nil)
@@ -1,14 +1,17 @@
 package inmemory
 
 import (
-	"sort"
+	"context"
+	"sync"
 
 	"mondash-backend/config"
 	"mondash-backend/domain"
+	"mondash-backend/repository"
 )
 
 // MapRepo is an in-memory implementation of repository.MapRepository.
 type MapRepo struct {
+	mu   sync.RWMutex
 	data domain.MapData
 }
 
@@ -19,41 +22,7 @@ func DefaultMapData() domain.MapData {
 	if err != nil {
 		return domain.MapData{}
 	}
-
-	nodeSet := map[string]struct{}{}
-	for _, name := range cfg.Names {
-		nodeSet[baseName(name)] = struct{}{}
-	}
-	for name := range cfg.Geolocation {
-		nodeSet[name] = struct{}{}
-	}
-
-	nodes := make([]domain.MapNode, 0, len(nodeSet))
-	for name := range nodeSet {
-		coord := cfg.Geolocation[name]
-		nodes = append(nodes, domain.MapNode{
-			ID:   name,
-			Name: name,
-			Coordinates: domain.Coordinates{
-				Lat:  coord.Lat,
-				Long: coord.Long,
-			},
-			Endpoint: true,
-		})
-	}
-	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
-
-	var connections []domain.MapConnection
-	for _, l := range cfg.Links {
-		if len(l) < 2 {
-			continue
-		}
-		from := baseName(l[0])
-		to := baseName(l[1])
-		connections = append(connections, domain.MapConnection{From: from, To: to, Status: "green"})
-	}
-
-	return domain.MapData{Nodes: nodes, Connections: connections}
+	return repository.MapFromTopology(repository.TopologyFromConfig(cfg))
 }
 
 // NewMapRepo creates a new MapRepo with sample data.
@@ -62,6 +31,16 @@ func NewMapRepo() *MapRepo {
 }
 
 // Get returns the network map data.
-func (r *MapRepo) Get() (domain.MapData, error) {
+func (r *MapRepo) Get(_ context.Context) (domain.MapData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.data, nil
 }
+
+// Save replaces the network map data.
+func (r *MapRepo) Save(_ context.Context, data domain.MapData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data = data
+	return nil
+}
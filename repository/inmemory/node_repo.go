@@ -1,143 +1,100 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
 	"sort"
+	"sync"
+	"time"
 
 	"mondash-backend/config"
 	"mondash-backend/domain"
+	"mondash-backend/repository"
 )
 
+// nodeHistoryLimit bounds the number of reports kept per node or device name.
+const nodeHistoryLimit = 2000
+
 // NodeRepo is an in-memory implementation of repository.NodeRepository.
+// Reports are kept in a bounded ring buffer per name, so the oldest ones are
+// dropped once nodeHistoryLimit is reached.
 type NodeRepo struct {
-	data []domain.NodeInfo
+	mu      sync.RWMutex
+	data    []domain.NodeInfo
+	history map[string]*nodeRing
 }
 
-// DefaultNodeData loads node data from the configuration file defined by
-// CONFIG_FILE. If the file cannot be read, an empty slice is returned.
-func DefaultNodeData() []domain.NodeInfo {
-	cfg, err := config.LoadFromEnv()
-	if err != nil {
-		return []domain.NodeInfo{}
-	}
+// nodeRing is a fixed-size ring buffer of node reports.
+type nodeRing struct {
+	buf  []domain.Node
+	next int
+	full bool
+}
 
-	groups := map[string][]string{}
-	for _, name := range cfg.Names {
-		base := baseName(name)
-		groups[base] = append(groups[base], name)
+func (r *nodeRing) add(n domain.Node) {
+	if len(r.buf) < nodeHistoryLimit {
+		r.buf = append(r.buf, n)
+		return
 	}
+	r.buf[r.next] = n
+	r.next = (r.next + 1) % len(r.buf)
+	r.full = true
+}
 
-	consumersByNode := cfg.ConsumersByNode()
-
-	var (
-		nodes     []domain.NodeInfo
-		deviceMap = make(map[string]*domain.Device)
-	)
-	for name, devs := range groups {
-		coord := cfg.Geolocation[name]
-		apps := consumersByNode[name]
-		if apps == nil {
-			apps = []string{}
-		}
-		nodeType := "terminal"
-		if len(devs) > 1 {
-			nodeType = "trusted node"
-		}
-		node := domain.NodeInfo{
-			ID:     name,
-			Name:   name,
-			Status: "active",
-			KME:    name + "-kme",
-			Type:   nodeType,
-			Apps:   apps,
-			Events: []domain.NodeEvent{},
-			Coordinates: domain.Coordinates{
-				Lat:  coord.Lat,
-				Long: coord.Long,
-			},
-		}
-		for _, d := range devs {
-			device := domain.Device{
-				ID:          d,
-				Device:      d,
-				Status:      "online",
-				NodeID:      name,
-				Coordinates: node.Coordinates,
-			}
-			node.Devices = append(node.Devices, device)
-		}
-		for _, l := range cfg.Links {
-			if len(l) < 2 {
-				continue
-			}
-			from := l[0]
-			to := l[1]
-			if baseName(from) == name {
-				node.Connections = append(node.Connections, domain.Connection{
-					Device:    from,
-					OtherNode: baseName(to),
-				})
-			}
-			if baseName(to) == name {
-				node.Connections = append(node.Connections, domain.Connection{
-					Device:    to,
-					OtherNode: baseName(from),
-				})
-			}
-		}
-		nodes = append(nodes, node)
+// last returns the most recently added report.
+func (r *nodeRing) last() (domain.Node, bool) {
+	if len(r.buf) == 0 {
+		return domain.Node{}, false
 	}
-	// build lookup map from device ID to pointer for setting connections
-	for i := range nodes {
-		for j := range nodes[i].Devices {
-			deviceMap[nodes[i].Devices[j].ID] = &nodes[i].Devices[j]
-		}
+	if !r.full {
+		return r.buf[len(r.buf)-1], true
 	}
-	// assign ConnectedTo information based on link configuration
-	for _, l := range cfg.Links {
-		if len(l) < 2 {
-			continue
-		}
-		from, to := l[0], l[1]
-		if d := deviceMap[from]; d != nil {
-			d.ConnectedTo = domain.ConnectedTo{ID: to, NodeID: baseName(to)}
-		}
-		if d := deviceMap[to]; d != nil {
-			d.ConnectedTo = domain.ConnectedTo{ID: from, NodeID: baseName(from)}
-		}
-	}
-	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
-	return nodes
+	return r.buf[(r.next+len(r.buf)-1)%len(r.buf)], true
 }
 
-func baseName(s string) string {
-	if len(s) == 0 {
-		return s
+// all returns the stored reports from oldest to newest.
+func (r *nodeRing) all() []domain.Node {
+	if !r.full {
+		return append([]domain.Node(nil), r.buf...)
 	}
-	r := s[len(s)-1]
-	if r >= 'A' && r <= 'Z' {
-		return s[:len(s)-1]
+	return append(append([]domain.Node(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// DefaultNodeData loads node data from the configuration file defined by
+// CONFIG_FILE. If the file cannot be read, an empty slice is returned.
+func DefaultNodeData() []domain.NodeInfo {
+	cfg, err := config.LoadFromEnv()
+	if err != nil {
+		return []domain.NodeInfo{}
 	}
-	return s
+	return repository.NodesFromTopology(repository.TopologyFromConfig(cfg))
 }
 
 // NewNodeRepo creates a new NodeRepo with data loaded from the config file.
 func NewNodeRepo() *NodeRepo {
-	return &NodeRepo{data: DefaultNodeData()}
+	return &NodeRepo{data: DefaultNodeData(), history: map[string]*nodeRing{}}
 }
 
 // Update performs validation and pretends to update a node.
-func (r *NodeRepo) Update(nodes []domain.Node) error {
+func (r *NodeRepo) Update(_ context.Context, nodes []domain.Node) error {
 	if len(nodes) == 0 {
 		return errors.New("invalid nodes")
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	for _, n := range nodes {
 		if n.Name == "" {
 			return errors.New("invalid node")
 		}
-		if n.Timestamp == "" {
+		if n.Timestamp.IsZero() {
 			return errors.New("missing timestamp")
 		}
+		ring := r.history[n.Name]
+		if ring == nil {
+			ring = &nodeRing{}
+			r.history[n.Name] = ring
+		}
+		ring.add(n)
 		for i := range r.data {
 			if r.data[i].Name != n.Name {
 				continue
@@ -162,7 +119,75 @@ func (r *NodeRepo) Update(nodes []domain.Node) error {
 	return nil
 }
 
-// List returns all nodes.
-func (r *NodeRepo) List() ([]domain.NodeInfo, error) {
-	return r.data, nil
+// List returns all nodes merged with the metrics of their latest reports.
+func (r *NodeRepo) List(_ context.Context) ([]domain.NodeInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	latest := make(map[string]domain.Node, len(r.history))
+	for name, ring := range r.history {
+		if rec, ok := ring.last(); ok {
+			latest[name] = rec
+		}
+	}
+	nodes := append([]domain.NodeInfo(nil), r.data...)
+	now := time.Now()
+	for i := range nodes {
+		repository.MergeLatest(&nodes[i], latest, now)
+	}
+	return nodes, nil
+}
+
+// History returns the buffered reports for the given names within the time
+// range, ordered chronologically. A zero start or end leaves the range open.
+func (r *NodeRepo) History(_ context.Context, names []string, start, end time.Time) ([]domain.Node, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	recs := []domain.Node{}
+	for _, name := range names {
+		ring := r.history[name]
+		if ring == nil {
+			continue
+		}
+		for _, n := range ring.all() {
+			if (!start.IsZero() && n.Timestamp.Before(start)) || (!end.IsZero() && n.Timestamp.After(end)) {
+				continue
+			}
+			recs = append(recs, n)
+		}
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Timestamp.Before(recs[j].Timestamp) })
+	return recs, nil
+}
+
+// Sync replaces the node definitions, keeping the status and events of the
+// nodes that remain defined. Reports are kept as well.
+func (r *NodeRepo) Sync(_ context.Context, nodes []domain.NodeInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := make(map[string]domain.NodeInfo, len(r.data))
+	for _, n := range r.data {
+		prev[n.ID] = n
+	}
+	data := append([]domain.NodeInfo(nil), nodes...)
+	for i := range data {
+		if old, ok := prev[data[i].ID]; ok {
+			data[i].Status = old.Status
+			data[i].Events = old.Events
+		}
+	}
+	r.data = data
+	return nil
+}
+
+// AddEvent appends an event to the node with the given name.
+func (r *NodeRepo) AddEvent(_ context.Context, name string, event domain.NodeEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.data {
+		if r.data[i].Name == name {
+			r.data[i].Events = append(r.data[i].Events, event)
+			return nil
+		}
+	}
+	return errors.New("node not found")
 }
@@ -0,0 +1,82 @@
+package inmemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// rollupLimit bounds the number of buckets kept per series key and
+// resolution, so about a day of minutes and several years of days.
+const rollupLimit = 2000
+
+// RollupRepo is an in-memory implementation of repository.RollupRepository.
+type RollupRepo struct {
+	mu      sync.RWMutex
+	buckets map[rollupKey][]domain.RollupPoint
+}
+
+type rollupKey struct {
+	series     string
+	key        string
+	resolution time.Duration
+}
+
+// NewRollupRepo creates an empty RollupRepo.
+func NewRollupRepo() *RollupRepo {
+	return &RollupRepo{buckets: map[rollupKey][]domain.RollupPoint{}}
+}
+
+// Add folds the sample into its bucket at every resolution, dropping the
+// oldest buckets beyond rollupLimit.
+func (r *RollupRepo) Add(_ context.Context, series, key string, at time.Time, value float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sample := domain.RollupPoint{Count: 1, Sum: value, Avg: value, Min: value, Max: value}
+	for _, res := range domain.RollupResolutions {
+		k := rollupKey{series: series, key: key, resolution: res}
+		points := r.buckets[k]
+		bucket := at.UTC().Truncate(res)
+		i := sort.Search(len(points), func(i int) bool { return !points[i].Timestamp.Before(bucket) })
+		if i == len(points) || !points[i].Timestamp.Equal(bucket) {
+			points = append(points, domain.RollupPoint{})
+			copy(points[i+1:], points[i:])
+			points[i] = domain.RollupPoint{Timestamp: bucket}
+		}
+		points[i].Merge(sample)
+		if len(points) > rollupLimit {
+			points = append([]domain.RollupPoint(nil), points[len(points)-rollupLimit:]...)
+		}
+		r.buckets[k] = points
+	}
+	return nil
+}
+
+// Range returns the buckets of the resolution starting between start and end.
+func (r *RollupRepo) Range(_ context.Context, series string, resolution time.Duration, keys []string, start, end time.Time) (map[string][]domain.RollupPoint, error) {
+	wanted := map[string]bool{}
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := map[string][]domain.RollupPoint{}
+	for k, points := range r.buckets {
+		if k.series != series || k.resolution != resolution || (len(wanted) > 0 && !wanted[k.key]) {
+			continue
+		}
+		for _, p := range points {
+			if p.Timestamp.Before(start) || p.Timestamp.After(end) {
+				continue
+			}
+			res[k.key] = append(res[k.key], p)
+		}
+	}
+	return res, nil
+}
+
+var _ repository.RollupRepository = (*RollupRepo)(nil)
@@ -0,0 +1,58 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// SessionRepo is an in-memory implementation of repository.SessionRepository.
+type SessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]domain.Session
+}
+
+// NewSessionRepo creates an empty SessionRepo.
+func NewSessionRepo() *SessionRepo {
+	return &SessionRepo{sessions: map[string]domain.Session{}}
+}
+
+// Create stores a new session.
+func (r *SessionRepo) Create(_ context.Context, s domain.Session) error {
+	if s.TokenHash == "" || s.UserID == "" {
+		return errors.New("invalid session")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s.TokenHash] = s
+	return nil
+}
+
+// Get returns the session for the token hash, dropping it if it has expired.
+func (r *SessionRepo) Get(_ context.Context, tokenHash string) (domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[tokenHash]
+	if !ok {
+		return domain.Session{}, repository.ErrNoSession
+	}
+	if !s.ExpiresAt.After(time.Now()) {
+		delete(r.sessions, tokenHash)
+		return domain.Session{}, repository.ErrNoSession
+	}
+	return s, nil
+}
+
+// Delete removes the session.
+func (r *SessionRepo) Delete(_ context.Context, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, tokenHash)
+	return nil
+}
+
+var _ repository.SessionRepository = (*SessionRepo)(nil)
@@ -0,0 +1,42 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// TopologyRepo is an in-memory implementation of
+// repository.TopologyRepository. It starts empty.
+type TopologyRepo struct {
+	mu    sync.RWMutex
+	data  domain.Topology
+	saved bool
+}
+
+// NewTopologyRepo creates an empty TopologyRepo.
+func NewTopologyRepo() *TopologyRepo {
+	return &TopologyRepo{}
+}
+
+// Get returns the saved topology or repository.ErrNoTopology.
+func (r *TopologyRepo) Get(_ context.Context) (domain.Topology, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.saved {
+		return domain.Topology{}, repository.ErrNoTopology
+	}
+	return r.data, nil
+}
+
+// Save replaces the topology.
+func (r *TopologyRepo) Save(_ context.Context, t domain.Topology) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data, r.saved = t, true
+	return nil
+}
+
+var _ repository.TopologyRepository = (*TopologyRepo)(nil)
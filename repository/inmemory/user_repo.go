@@ -1,6 +1,10 @@
 package inmemory
 
-import "mondash-backend/domain"
+import (
+	"context"
+
+	"mondash-backend/domain"
+)
 
 // UserRepo is an in-memory implementation of repository.UserRepository
 // backed by the in-memory AuthRepo.
@@ -15,10 +19,12 @@ func NewUserRepo(auth *AuthRepo) *UserRepo {
 }
 
 // List returns all users from the AuthRepo.
-func (r *UserRepo) List() ([]domain.User, error) {
+func (r *UserRepo) List(_ context.Context) ([]domain.User, error) {
 	if r.auth == nil {
 		return nil, nil
 	}
+	r.auth.mu.RLock()
+	defer r.auth.mu.RUnlock()
 	users := make([]domain.User, 0, len(r.auth.users))
 	for _, u := range r.auth.users {
 		users = append(users, u.User)
@@ -1,8 +1,14 @@
 package repository
 
-import "mondash-backend/domain"
+import (
+	"context"
+
+	"mondash-backend/domain"
+)
 
 // MapRepository defines persistence methods for network map data.
 type MapRepository interface {
-	Get() (domain.MapData, error)
+	Get(ctx context.Context) (domain.MapData, error)
+	// Save replaces the network map data.
+	Save(ctx context.Context, data domain.MapData) error
 }
@@ -0,0 +1,102 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+// AgentRepo implements repository.AgentRepository backed by MongoDB.
+type AgentRepo struct {
+	coll *mongo.Collection
+}
+
+// NewAgentRepo returns a new MongoDB AgentRepo using the given database.
+func NewAgentRepo(db *mongo.Database) *AgentRepo {
+	coll := db.Collection("agent_tokens")
+	_, err := coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		logger.Log.Errorw("failed to create agent token indexes", "error", err)
+	}
+	return &AgentRepo{coll: coll}
+}
+
+// Add inserts a new agent credential.
+func (r *AgentRepo) Add(ctx context.Context, t domain.AgentToken) error {
+	ctx, done := startOp(ctx, "AgentRepo.Add")
+	defer done()
+	if t.ID == "" || t.TokenHash == "" || len(t.Nodes) == 0 {
+		return errors.New("invalid agent token")
+	}
+	logger.Log.Debugw("mongo add agent token", "id", t.ID, "nodes", t.Nodes)
+	_, err := r.coll.InsertOne(ctx, t)
+	return err
+}
+
+// List returns all agent credentials.
+func (r *AgentRepo) List(ctx context.Context) ([]domain.AgentToken, error) {
+	ctx, done := startOp(ctx, "AgentRepo.List")
+	defer done()
+	logger.Log.Debug("mongo list agent tokens")
+	cursor, err := r.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var tokens []domain.AgentToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = []domain.AgentToken{}
+	}
+	return tokens, nil
+}
+
+// ByTokenHash returns the credential stored under the given hash.
+func (r *AgentRepo) ByTokenHash(ctx context.Context, hash string) (domain.AgentToken, error) {
+	ctx, done := startOp(ctx, "AgentRepo.ByTokenHash")
+	defer done()
+	var t domain.AgentToken
+	err := r.coll.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&t)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.AgentToken{}, repository.ErrNoAgentToken
+	}
+	return t, err
+}
+
+// Revoke marks the credential as revoked.
+func (r *AgentRepo) Revoke(ctx context.Context, id string) error {
+	ctx, done := startOp(ctx, "AgentRepo.Revoke")
+	defer done()
+	logger.Log.Debugw("mongo revoke agent token", "id", id)
+	res, err := r.coll.UpdateOne(
+		ctx,
+		bson.M{"id": id, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		count, err := r.coll.CountDocuments(ctx, bson.M{"id": id})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("agent token not found")
+		}
+	}
+	return nil
+}
+
+var _ repository.AgentRepository = (*AgentRepo)(nil)
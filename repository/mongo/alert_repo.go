@@ -23,10 +23,12 @@ func NewAlertRepo(db *mongo.Database) *AlertRepo {
 }
 
 // List returns the alerts response document.
-func (r *AlertRepo) List() (domain.AlertInfo, error) {
+func (r *AlertRepo) List(ctx context.Context) (domain.AlertInfo, error) {
+	ctx, done := startOp(ctx, "AlertRepo.List")
+	defer done()
 	logger.Log.Debug("mongo list alerts")
 	var res domain.AlertInfo
-	err := r.coll.FindOne(context.Background(), bson.M{"_id": 1}).Decode(&res)
+	err := r.coll.FindOne(ctx, bson.M{"_id": 1}).Decode(&res)
 	if err == nil {
 		logger.Log.Debugw("mongo list alerts result", "alerts", res)
 	}
@@ -34,13 +36,15 @@ func (r *AlertRepo) List() (domain.AlertInfo, error) {
 }
 
 // Add pushes a new alert into the alerts array.
-func (r *AlertRepo) Add(a domain.Alert) error {
-	if a.ID == "" || a.Device == "" || a.Level == "" {
+func (r *AlertRepo) Add(ctx context.Context, a domain.Alert) error {
+	ctx, done := startOp(ctx, "AlertRepo.Add")
+	defer done()
+	if a.ID == "" || a.Level == "" || (a.Device == "" && a.Target == "") {
 		return errors.New("invalid alert")
 	}
 	logger.Log.Debugw("mongo add alert", "id", a.ID, "device", a.Device)
 	_, err := r.coll.UpdateOne(
-		context.Background(),
+		ctx,
 		bson.M{"_id": 1},
 		bson.M{"$push": bson.M{"alerts": a}},
 		options.Update().SetUpsert(true),
@@ -48,4 +52,87 @@ func (r *AlertRepo) Add(a domain.Alert) error {
 	return err
 }
 
+// Update replaces the matching element of the alerts array.
+func (r *AlertRepo) Update(ctx context.Context, a domain.Alert) error {
+	ctx, done := startOp(ctx, "AlertRepo.Update")
+	defer done()
+	logger.Log.Debugw("mongo update alert", "id", a.ID)
+	res, err := r.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": 1, "alerts.id": a.ID},
+		bson.M{"$set": bson.M{"alerts.$": a}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("alert not found")
+	}
+	return nil
+}
+
+// Delete pulls the alert from the alerts array.
+func (r *AlertRepo) Delete(ctx context.Context, id string) error {
+	ctx, done := startOp(ctx, "AlertRepo.Delete")
+	defer done()
+	logger.Log.Debugw("mongo delete alert", "id", id)
+	res, err := r.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": 1},
+		bson.M{"$pull": bson.M{"alerts": bson.M{"id": id}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return errors.New("alert not found")
+	}
+	return nil
+}
+
+// SetEscalations sets the escalations field of the alerts response
+// document.
+func (r *AlertRepo) SetEscalations(ctx context.Context, policies []domain.EscalationPolicy) error {
+	ctx, done := startOp(ctx, "AlertRepo.SetEscalations")
+	defer done()
+	logger.Log.Debugw("mongo set escalations", "policies", len(policies))
+	_, err := r.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": 1},
+		bson.M{"$set": bson.M{"escalations": policies}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// RecordDelivery inserts a delivery record into alert_deliveries.
+func (r *AlertRepo) RecordDelivery(ctx context.Context, d domain.AlertDelivery) error {
+	ctx, done := startOp(ctx, "AlertRepo.RecordDelivery")
+	defer done()
+	_, err := r.coll.Database().Collection("alert_deliveries").InsertOne(ctx, d)
+	return err
+}
+
+// Deliveries returns up to `limit` delivery records, newest first.
+func (r *AlertRepo) Deliveries(ctx context.Context, limit int) ([]domain.AlertDelivery, error) {
+	ctx, done := startOp(ctx, "AlertRepo.Deliveries")
+	defer done()
+	opts := options.Find().SetSort(bson.M{"timestamp": -1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := r.coll.Database().Collection("alert_deliveries").Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var res []domain.AlertDelivery
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = []domain.AlertDelivery{}
+	}
+	return res, nil
+}
+
 var _ repository.AlertRepository = (*AlertRepo)(nil)
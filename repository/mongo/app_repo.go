@@ -9,7 +9,6 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"mondash-backend/config"
 	"mondash-backend/domain"
 	"mondash-backend/logger"
 	"mondash-backend/repository"
@@ -21,17 +20,20 @@ type AppRepo struct {
 	dynamicColl *mongo.Collection
 }
 
-func (r *AppRepo) latest(name string) (*domain.App, error) {
-	var rec domain.App
+func (r *AppRepo) latest(ctx context.Context, name string) (*domain.App, error) {
+	ctx, done := startOp(ctx, "AppRepo.latest")
+	defer done()
+	var rec appRecord
 	err := r.dynamicColl.FindOne(
-		context.Background(),
+		ctx,
 		bson.M{"name": name},
 		options.FindOne().SetSort(bson.M{"timestamp": -1}),
 	).Decode(&rec)
 	if err != nil {
 		return nil, err
 	}
-	return &rec, nil
+	a := rec.app()
+	return &a, nil
 }
 
 const historyLimit = 10
@@ -40,116 +42,164 @@ const historyLimit = 10
 func NewAppRepo(db *mongo.Database) *AppRepo {
 	return &AppRepo{
 		staticColl:  db.Collection("static_apps"),
-		dynamicColl: db.Collection("key_consumption"),
+		dynamicColl: db.Collection(keyConsumptionCollection),
+	}
+}
+
+// historyBatch is the number of records fetched per expected history entry.
+// historyFor fetches more when records are grouped more densely.
+const historyBatch = 20
+
+// consumptionBucket is the consumption recorded at one timestamp, as returned
+// by the history pipeline. Docs counts the records it sums.
+type consumptionBucket struct {
+	Timestamp time.Time `bson:"_id"`
+	Count     int       `bson:"count"`
+	Docs      int       `bson:"docs"`
+}
+
+// keysConsumed is the number of keys a key_consumption document accounts for,
+// as domain.App.KeysConsumed counts them.
+var keysConsumed = bson.D{{Key: "$cond", Value: bson.A{
+	bson.D{{Key: "$gt", Value: bson.A{"$numberofkeys", 0}}},
+	"$numberofkeys",
+	1,
+}}}
+
+// historyPipeline sums the most recent `docs` records of an app per
+// timestamp. Records without a positive number of keys count as one key.
+// Buckets are returned in chronological order.
+func historyPipeline(name string, docs int) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "name", Value: name}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: -1}}}},
+		{{Key: "$limit", Value: docs}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$timestamp"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: keysConsumed}}},
+			{Key: "docs", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
 	}
 }
 
 // historyFor returns the last `limit` key consumption entries for the given app
 // name. Results are ordered chronologically with the earliest entry first.
-func (r *AppRepo) historyFor(name string, limit int) ([]domain.KeyConsumptionEntry, error) {
+// Only the most recent records are aggregated by MongoDB.
+func (r *AppRepo) historyFor(ctx context.Context, name string, limit int) ([]domain.KeyConsumptionEntry, error) {
+	ctx, done := startOp(ctx, "AppRepo.historyFor")
+	defer done()
 	if limit <= 0 {
 		limit = historyLimit
 	}
-	cursor, err := r.dynamicColl.Find(
-		context.Background(),
-		bson.M{"name": name},
-		options.Find().SetSort(bson.M{"timestamp": -1}),
-	)
-	if err != nil {
-		return nil, err
-	}
-	var recs []domain.App
-	if err := cursor.All(context.Background(), &recs); err != nil {
-		return nil, err
-	}
-
-	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Timestamp < recs[j].Timestamp })
-
-	const tolerance = 100 * time.Millisecond
-	var result []domain.KeyConsumptionEntry
-	var group []domain.App
-	var lastTime time.Time
-
-	parseTS := func(ts string) (time.Time, error) {
-		t, err := time.Parse(time.RFC3339Nano, ts)
+	return collectHistory(limit, func(docs int) ([]consumptionBucket, error) {
+		cursor, err := r.dynamicColl.Aggregate(ctx, historyPipeline(name, docs))
 		if err != nil {
-			return time.Parse(time.RFC3339, ts)
-		}
-		return t, nil
-	}
-
-	flush := func() {
-		if len(group) == 0 {
-			return
+			return nil, err
 		}
-		sum := 0
-		for _, g := range group {
-			if g.NumberOfKeys > 0 {
-				sum += g.NumberOfKeys
-			} else {
-				sum++
-			}
+		var buckets []consumptionBucket
+		if err := cursor.All(ctx, &buckets); err != nil {
+			return nil, err
 		}
-		result = append(result, domain.KeyConsumptionEntry{Timestamp: group[0].Timestamp, Count: sum})
-		group = group[:0]
-	}
+		return buckets, nil
+	})
+}
 
-	for _, rec := range recs {
-		ts, err := parseTS(rec.Timestamp)
+// collectHistory fetches the buckets of a growing number of recent records
+// until they make up `limit` complete entries or hold the whole history.
+func collectHistory(limit int, fetch func(docs int) ([]consumptionBucket, error)) ([]domain.KeyConsumptionEntry, error) {
+	for docs := limit * historyBatch; ; docs *= 4 {
+		buckets, err := fetch(docs)
 		if err != nil {
-			continue
+			return nil, err
+		}
+		fetched := 0
+		for _, b := range buckets {
+			fetched += b.Docs
 		}
-		if len(group) == 0 {
-			group = append(group, rec)
-			lastTime = ts
+		partial := fetched >= docs
+		result := groupConsumption(buckets, partial)
+		if partial && len(result) < limit {
 			continue
 		}
-		if ts.Sub(lastTime) <= tolerance {
-			group = append(group, rec)
-		} else {
-			flush()
-			group = append(group, rec)
-			lastTime = ts
+		if len(result) > limit {
+			result = result[len(result)-limit:]
 		}
+		return result, nil
 	}
-	flush()
+}
 
-	if limit > 0 && len(result) > limit {
-		result = result[len(result)-limit:]
+// groupConsumption merges chronologically ordered buckets lying within 100ms
+// of the first bucket of their group into a single entry. When the buckets
+// are only the most recent part of the history, the oldest group may be
+// missing records, so groups before the first gap wider than 100ms are
+// dropped: a bucket following such a gap always starts a new group. This
+// only holds for chronologically ordered buckets, which legacy string
+// timestamps mixed with dates may not be, so such partial buckets yield no
+// entries at all.
+func groupConsumption(buckets []consumptionBucket, partial bool) []domain.KeyConsumptionEntry {
+	const tolerance = 100 * time.Millisecond
+	result := []domain.KeyConsumptionEntry{}
+	if partial && !chronological(buckets) {
+		return result
 	}
-	if result == nil {
-		result = []domain.KeyConsumptionEntry{}
+	var (
+		cur      *domain.KeyConsumptionEntry
+		anchor   time.Time
+		prev     time.Time
+		havePrev bool
+	)
+	for _, b := range buckets {
+		ts := b.Timestamp
+		if ts.IsZero() {
+			continue
+		}
+		if partial {
+			if !havePrev || ts.Sub(prev) <= tolerance {
+				prev, havePrev = ts, true
+				continue
+			}
+			partial = false
+		}
+		if cur != nil && ts.Sub(anchor) <= tolerance {
+			cur.Count += b.Count
+			continue
+		}
+		result = append(result, domain.KeyConsumptionEntry{Timestamp: ts, Count: b.Count})
+		cur = &result[len(result)-1]
+		anchor = ts
 	}
-	return result, nil
+	return result
 }
 
 // Update upserts an app's basic information.
-func (r *AppRepo) Update(a *domain.App) error {
-	if a == nil || a.Name == "" || a.Timestamp == "" {
+func (r *AppRepo) Update(ctx context.Context, a *domain.App) error {
+	ctx, done := startOp(ctx, "AppRepo.Update")
+	defer done()
+	if a == nil || a.Name == "" || a.Timestamp.IsZero() {
 		return errors.New("invalid app")
 	}
 	logger.Log.Debugw("mongo store app update", "name", a.Name)
-	_, err := r.dynamicColl.InsertOne(context.Background(), a)
+	_, err := r.dynamicColl.InsertOne(ctx, newAppRecord(*a))
 	return err
 }
 
 // List returns all app data from the collection.
-func (r *AppRepo) List() ([]domain.AppData, error) {
+func (r *AppRepo) List(ctx context.Context) ([]domain.AppData, error) {
+	ctx, done := startOp(ctx, "AppRepo.List")
+	defer done()
 	logger.Log.Debug("mongo list apps")
-	cursor, err := r.staticColl.Find(context.Background(), bson.D{})
+	cursor, err := r.staticColl.Find(ctx, bson.D{})
 	if err != nil {
 		return nil, err
 	}
 	var apps []domain.AppData
-	if err = cursor.All(context.Background(), &apps); err != nil {
+	if err = cursor.All(ctx, &apps); err != nil {
 		return nil, err
 	}
 
-	cfg, _ := config.LoadFromEnv()
-	nodesByConsumer := cfg.NodesByConsumer()
-
 	for i := range apps {
-		history, err := r.historyFor(apps[i].Name, historyLimit)
+		history, err := r.historyFor(ctx, apps[i].Name, historyLimit)
 		if err == nil {
 			apps[i].KeyConsumptionHistory = history
 		}
@@ -159,12 +209,10 @@ func (r *AppRepo) List() ([]domain.AppData, error) {
 		if apps[i].ErrorHistory == nil {
 			apps[i].ErrorHistory = []string{}
 		}
-		if nodes := nodesByConsumer[apps[i].Name]; len(nodes) > 0 {
-			apps[i].Nodes = nodes
-		} else if apps[i].Nodes == nil {
+		if apps[i].Nodes == nil {
 			apps[i].Nodes = []string{}
 		}
-		if last, err := r.latest(apps[i].Name); err == nil && last != nil {
+		if last, err := r.latest(ctx, apps[i].Name); err == nil && last != nil {
 			apps[i].KeySize = last.KeySize
 		}
 	}
@@ -172,49 +220,70 @@ func (r *AppRepo) List() ([]domain.AppData, error) {
 	return apps, nil
 }
 
-// Timeline returns key consumption history for all apps within the given range.
-func (r *AppRepo) Timeline(start, end string) ([]domain.AppData, error) {
-	filter := bson.M{}
-	ts := bson.M{}
-	if start != "" {
-		ts["$gte"] = start
-	}
-	if end != "" {
-		ts["$lte"] = end
+// Sync upserts the static documents of the apps and deletes those of apps no
+// longer defined. Key consumption records are kept.
+func (r *AppRepo) Sync(ctx context.Context, apps []domain.AppData) error {
+	ctx, done := startOp(ctx, "AppRepo.Sync")
+	defer done()
+	names := make([]string, len(apps))
+	for i, a := range apps {
+		names[i] = a.Name
+		_, err := r.staticColl.UpdateOne(
+			ctx,
+			bson.M{"name": a.Name},
+			bson.M{
+				"$set": bson.M{"name": a.Name, "nodes": a.Nodes},
+				"$setOnInsert": bson.M{
+					"certificate":           a.Certificate,
+					"keyconsumptionhistory": a.KeyConsumptionHistory,
+					"errorhistory":          a.ErrorHistory,
+					"numberofkeys":          a.NumberOfKeys,
+					"keysize":               a.KeySize,
+				},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
 	}
-	if len(ts) > 0 {
+	_, err := r.staticColl.DeleteMany(ctx, bson.M{"name": bson.M{"$nin": names}})
+	logger.Log.Debugw("mongo synced apps", "names", names)
+	return err
+}
+
+// Timeline returns key consumption history for all apps within the given
+// range. A zero start or end leaves the range open.
+func (r *AppRepo) Timeline(ctx context.Context, start, end time.Time) ([]domain.AppData, error) {
+	ctx, done := startOp(ctx, "AppRepo.Timeline")
+	defer done()
+	filter := bson.M{}
+	if ts := rangeFilter(start, end); len(ts) > 0 {
 		filter["timestamp"] = ts
 	}
 	cursor, err := r.dynamicColl.Find(
-		context.Background(),
+		ctx,
 		filter,
 		options.Find().SetSort(bson.M{"timestamp": 1}),
 	)
 	if err != nil {
 		return nil, err
 	}
-	var recs []domain.App
-	if err := cursor.All(context.Background(), &recs); err != nil {
+	var recs []appRecord
+	if err := cursor.All(ctx, &recs); err != nil {
 		return nil, err
 	}
 
 	byName := make(map[string][]domain.App)
 	for _, rec := range recs {
-		byName[rec.Name] = append(byName[rec.Name], rec)
+		byName[rec.Name] = append(byName[rec.Name], rec.app())
 	}
 
 	const tolerance = 100 * time.Millisecond
-	parseTS := func(ts string) (time.Time, error) {
-		t, err := time.Parse(time.RFC3339Nano, ts)
-		if err != nil {
-			return time.Parse(time.RFC3339, ts)
-		}
-		return t, nil
-	}
 
 	result := make([]domain.AppData, 0, len(byName))
 	for name, entries := range byName {
-		sort.Slice(entries, func(i, j int) bool { return entries[i].Timestamp < entries[j].Timestamp })
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
 
 		var group []domain.App
 		var lastTime time.Time
@@ -226,19 +295,15 @@ func (r *AppRepo) Timeline(start, end string) ([]domain.AppData, error) {
 			}
 			sum := 0
 			for _, g := range group {
-				if g.NumberOfKeys > 0 {
-					sum += g.NumberOfKeys
-				} else {
-					sum++
-				}
+				sum += g.KeysConsumed()
 			}
 			history = append(history, domain.KeyConsumptionEntry{Timestamp: group[0].Timestamp, Count: sum})
 			group = group[:0]
 		}
 
 		for _, rec := range entries {
-			ts, err := parseTS(rec.Timestamp)
-			if err != nil {
+			ts := rec.Timestamp
+			if ts.IsZero() {
 				continue
 			}
 			if len(group) == 0 {
@@ -271,4 +336,21 @@ func (r *AppRepo) Timeline(start, end string) ([]domain.AppData, error) {
 	return result, nil
 }
 
+// chronological reports whether the valid timestamps of the buckets are in
+// chronological order.
+func chronological(buckets []consumptionBucket) bool {
+	var prev time.Time
+	for _, b := range buckets {
+		ts := b.Timestamp
+		if ts.IsZero() {
+			continue
+		}
+		if ts.Before(prev) {
+			return false
+		}
+		prev = ts
+	}
+	return true
+}
+
 var _ repository.AppRepository = (*AppRepo)(nil)
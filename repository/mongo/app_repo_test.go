@@ -0,0 +1,231 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+)
+
+// legacyHistory is the in-process grouping historyFor used to perform on the
+// whole collection, kept as the reference for the pipeline. Records are
+// ordered chronologically, as their BSON dates are.
+func legacyHistory(recs []domain.App, limit int) []domain.KeyConsumptionEntry {
+	recs = append([]domain.App(nil), recs...)
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Timestamp.Before(recs[j].Timestamp) })
+	const tolerance = 100 * time.Millisecond
+	var (
+		result   []domain.KeyConsumptionEntry
+		group    []domain.App
+		lastTime time.Time
+	)
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		sum := 0
+		for _, g := range group {
+			if g.NumberOfKeys > 0 {
+				sum += g.NumberOfKeys
+			} else {
+				sum++
+			}
+		}
+		result = append(result, domain.KeyConsumptionEntry{Timestamp: group[0].Timestamp, Count: sum})
+		group = group[:0]
+	}
+	for _, rec := range recs {
+		ts := rec.Timestamp
+		if len(group) > 0 && ts.Sub(lastTime) <= tolerance {
+			group = append(group, rec)
+			continue
+		}
+		flush()
+		group = append(group, rec)
+		lastTime = ts
+	}
+	flush()
+	if len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	if result == nil {
+		result = []domain.KeyConsumptionEntry{}
+	}
+	return result
+}
+
+// pipelineFetch evaluates historyPipeline in memory over recs.
+func pipelineFetch(recs []domain.App) func(int) ([]consumptionBucket, error) {
+	sorted := make([]appRecord, len(recs))
+	for i, rec := range recs {
+		sorted[i] = newAppRecord(rec)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.After(sorted[j].Timestamp)
+	})
+	return func(docs int) ([]consumptionBucket, error) {
+		tail := sorted
+		if len(tail) > docs {
+			tail = tail[:docs]
+		}
+		byTS := map[time.Time]*consumptionBucket{}
+		for _, rec := range tail {
+			b := byTS[rec.Timestamp]
+			if b == nil {
+				b = &consumptionBucket{Timestamp: rec.Timestamp}
+				byTS[rec.Timestamp] = b
+			}
+			if rec.NumberOfKeys > 0 {
+				b.Count += rec.NumberOfKeys
+			} else {
+				b.Count++
+			}
+			b.Docs++
+		}
+		buckets := make([]consumptionBucket, 0, len(byTS))
+		for _, b := range byTS {
+			buckets = append(buckets, *b)
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			return buckets[i].Timestamp.Before(buckets[j].Timestamp)
+		})
+		return buckets, nil
+	}
+}
+
+// consumptionRecords generates n records in bursts whose spacing sometimes
+// falls within the grouping tolerance.
+func consumptionRecords(rng *rand.Rand, n int) []domain.App {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recs := make([]domain.App, n)
+	for i := range recs {
+		switch rng.Intn(4) {
+		case 0:
+			ts = ts.Add(time.Duration(rng.Intn(5)) * time.Second)
+		default:
+			ts = ts.Add(time.Duration(rng.Intn(60)) * time.Millisecond)
+		}
+		recs[i] = domain.App{Name: "app", NumberOfKeys: rng.Intn(4), Timestamp: ts}
+	}
+	return recs
+}
+
+func TestCollectHistoryMatchesFullScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 5, 50, 199, 200, 201, 1000, 20000} {
+		recs := consumptionRecords(rng, n)
+		for _, limit := range []int{1, historyLimit, 100} {
+			got, err := collectHistory(limit, pipelineFetch(recs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := legacyHistory(recs, limit); !reflect.DeepEqual(got, want) {
+				t.Fatalf("n=%d limit=%d: got %+v, want %+v", n, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestCollectHistoryDenseBursts(t *testing.T) {
+	// Every record lies within the tolerance of the previous one, so the
+	// whole history has to be fetched to find where groups start.
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var recs []domain.App
+	for i := 0; i < 5000; i++ {
+		recs = append(recs, domain.App{Name: "app", NumberOfKeys: 1, Timestamp: ts})
+		ts = ts.Add(30 * time.Millisecond)
+	}
+	got, err := collectHistory(historyLimit, pipelineFetch(recs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := legacyHistory(recs, historyLimit); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+// The in-memory benchmarks compare grouping the whole history, as historyFor
+// used to, with grouping the buckets of the most recent records only.
+func BenchmarkLegacyHistory(b *testing.B) {
+	recs := consumptionRecords(rand.New(rand.NewSource(1)), 1000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		legacyHistory(recs, historyLimit)
+	}
+}
+
+func BenchmarkCollectHistory(b *testing.B) {
+	fetch := pipelineFetch(consumptionRecords(rand.New(rand.NewSource(1)), 1000000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := collectHistory(historyLimit, fetch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHistoryFor measures historyFor against a real MongoDB holding
+// MONGO_BENCH_RECORDS key consumption records (default one million). It is
+// skipped unless MONGODB_TEST_URI is set; the records are written to a
+// throwaway database that is dropped afterwards.
+func BenchmarkHistoryFor(b *testing.B) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		b.Skip("MONGODB_TEST_URI not set")
+	}
+	n := 1000000
+	if v := os.Getenv("MONGO_BENCH_RECORDS"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database(fmt.Sprintf("mondash_bench_%d", time.Now().UnixNano()))
+	defer db.Drop(ctx)
+
+	repo := NewAppRepo(db)
+	if err := EnsureIndexes(ctx, db, Retention{}); err != nil {
+		b.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	recs := consumptionRecords(rng, n)
+	const batch = 10000
+	for i := 0; i < len(recs); i += batch {
+		docs := make([]interface{}, 0, batch)
+		for _, rec := range recs[i:min(i+batch, len(recs))] {
+			docs = append(docs, newAppRecord(rec))
+		}
+		if _, err := repo.dynamicColl.InsertMany(ctx, docs); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	SetTimeouts(Timeouts{})
+	defer SetTimeouts(Timeouts{Default: DefaultTimeout})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.historyFor(ctx, "app", historyLimit); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
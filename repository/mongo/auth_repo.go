@@ -3,11 +3,13 @@ package mongo
 import (
 	"context"
 	"errors"
-	"os"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"mondash-backend/domain"
 	"mondash-backend/logger"
+	"mondash-backend/password"
 	"mondash-backend/repository"
 )
 
@@ -25,10 +27,15 @@ func NewAuthRepo(db *mongo.Database) *AuthRepo {
 	ctx := context.Background()
 	count, err := coll.CountDocuments(ctx, bson.D{})
 	if err == nil && count == 0 {
+		hash, err := password.Hash("admin")
+		if err != nil {
+			logger.Log.Errorw("failed to hash default admin password", "error", err)
+			return repo
+		}
 		admin := bson.M{
 			"id":          "1",
 			"username":    "admin",
-			"password":    "admin",
+			"password":    hash,
 			"email":       "admin@ronaqci.eu",
 			"fullname":    "Administrator",
 			"affiliation": "RoNaQCI",
@@ -42,44 +49,118 @@ func NewAuthRepo(db *mongo.Database) *AuthRepo {
 	return repo
 }
 
-// Login checks credentials and returns a dummy token if valid.
-func (r *AuthRepo) Login(username, password string) (string, error) {
-	if username == "" || password == "" {
-		return "", errors.New("missing credentials")
+// authDoc is the stored form of an auth_users document.
+type authDoc struct {
+	domain.User `bson:",inline"`
+	ObjectID    primitive.ObjectID `bson:"_id,omitempty"`
+	Password    string             `bson:"password"`
+}
+
+// user returns the public information of the account. Accounts registered
+// before users had an "id" field are identified by their _id instead.
+func (d authDoc) user() domain.User {
+	u := d.User
+	if u.ID == "" && !d.ObjectID.IsZero() {
+		u.ID = d.ObjectID.Hex()
+	}
+	return u
+}
+
+// userIDFilter matches the account with the given ID, falling back to the
+// _id of accounts without an "id" field.
+func userIDFilter(id string) bson.M {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return bson.M{"id": id}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"id": id},
+		bson.M{"_id": oid, "id": bson.M{"$exists": false}},
+	}}
+}
+
+// Credentials returns the user and its stored password hash. The password
+// is verified by the caller, never in the query filter.
+func (r *AuthRepo) Credentials(ctx context.Context, username string) (domain.User, string, error) {
+	ctx, done := startOp(ctx, "AuthRepo.Credentials")
+	defer done()
+	if username == "" {
+		return domain.User{}, "", errors.New("missing credentials")
 	}
 	logger.Log.Debugw("mongo login", "username", username)
-	var doc bson.M
-	err := r.coll.FindOne(context.Background(), bson.M{"username": username, "password": password}).Decode(&doc)
+	var doc authDoc
+	err := r.coll.FindOne(ctx, bson.M{"username": username}).Decode(&doc)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		return domain.User{}, "", errors.New("invalid credentials")
 	}
-	if doc != nil {
-		sanitized := bson.M{"username": doc["username"]}
-		logger.Log.Debugw("mongo login result", "doc", sanitized)
+	user := doc.user()
+	logger.Log.Debugw("mongo login result", "username", username, "id", user.ID)
+	return user, doc.Password, nil
+}
+
+// SetPassword replaces the stored password hash of a user.
+func (r *AuthRepo) SetPassword(ctx context.Context, username, hash string) error {
+	ctx, done := startOp(ctx, "AuthRepo.SetPassword")
+	defer done()
+	logger.Log.Debugw("mongo set password", "username", username)
+	res, err := r.coll.UpdateOne(
+		ctx,
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"password": hash}},
+	)
+	if err != nil {
+		return err
 	}
-	token := os.Getenv("AUTH_TOKEN")
-	if token == "" {
-		token = "abc"
+	if res.MatchedCount == 0 {
+		return errors.New("user not found")
 	}
-	return token, nil
+	return nil
 }
 
 // Register inserts a new user document.
-func (r *AuthRepo) Register(username, email, password, role string) error {
-	if username == "" || email == "" || password == "" || role == "" {
+func (r *AuthRepo) Register(ctx context.Context, username, email, passwordHash, role, affiliation string) error {
+	ctx, done := startOp(ctx, "AuthRepo.Register")
+	defer done()
+	if username == "" || email == "" || passwordHash == "" || role == "" {
 		return errors.New("invalid registration")
 	}
 	logger.Log.Debugw("mongo register user", "username", username)
+	count, err := r.coll.CountDocuments(ctx, bson.M{"username": username})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("username already taken")
+	}
 	doc := bson.M{
+		"id":          primitive.NewObjectID().Hex(),
 		"username":    username,
-		"password":    password,
+		"password":    passwordHash,
 		"email":       email,
 		"fullname":    username,
-		"affiliation": "",
+		"affiliation": affiliation,
 		"role":        role,
 	}
-	_, err := r.coll.InsertOne(context.Background(), doc)
+	_, err = r.coll.InsertOne(ctx, doc)
 	return err
 }
 
+// UserByID returns the public information of the account with the given ID.
+func (r *AuthRepo) UserByID(ctx context.Context, id string) (domain.User, error) {
+	ctx, done := startOp(ctx, "AuthRepo.UserByID")
+	defer done()
+	if id == "" {
+		return domain.User{}, repository.ErrNoUser
+	}
+	var doc authDoc
+	err := r.coll.FindOne(ctx, userIDFilter(id)).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.User{}, repository.ErrNoUser
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	return doc.user(), nil
+}
+
 var _ repository.AuthRepository = (*AuthRepo)(nil)
@@ -0,0 +1,47 @@
+package mongo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLegacyUserID(t *testing.T) {
+	oid := primitive.NewObjectID()
+	// Accounts registered before users had an "id" field.
+	raw, err := bson.Marshal(bson.M{
+		"_id":         oid,
+		"username":    "alice",
+		"password":    "secret",
+		"email":       "alice@example.com",
+		"fullname":    "alice",
+		"affiliation": "",
+		"role":        "technician",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc authDoc
+	if err := bson.UnmarshalWithRegistry(Registry, raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	user := doc.user()
+	if user.ID != oid.Hex() || user.Role != "technician" {
+		t.Fatalf("expected the _id as user ID, got %+v", user)
+	}
+
+	or, ok := userIDFilter(user.ID)["$or"].(bson.A)
+	if !ok || len(or) != 2 || or[1].(bson.M)["_id"] != oid {
+		t.Fatalf("expected the filter to fall back to _id, got %v", userIDFilter(user.ID))
+	}
+	if got := userIDFilter("1"); got["id"] != "1" || len(got) != 1 {
+		t.Fatalf("expected a plain id filter, got %v", got)
+	}
+
+	// Accounts with an "id" keep it.
+	doc.ID = "42"
+	if got := doc.user().ID; got != "42" {
+		t.Fatalf("expected the stored id, got %q", got)
+	}
+}
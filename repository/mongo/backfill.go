@@ -0,0 +1,117 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mondash-backend/domain"
+)
+
+// rollupSource is the time-series collection a rollup series is recorded
+// from.
+type rollupSource struct {
+	Series     string
+	Collection string
+	Value      interface{}
+}
+
+// rollupSources lists the series BackfillRollups rebuilds, with the values
+// recorded for them as reports arrive.
+var rollupSources = []rollupSource{
+	{Series: domain.SeriesAppConsumption, Collection: keyConsumptionCollection, Value: keysConsumed},
+	{Series: domain.SeriesDeviceKeyRate, Collection: nodeHistoryCollection, Value: "$currentkeyrate"},
+	{Series: domain.SeriesNodeKeyCount, Collection: nodeHistoryCollection, Value: "$storedkeycount"},
+}
+
+// dateTruncUnits names the $dateTrunc unit of every rollup resolution.
+var dateTruncUnits = map[time.Duration]string{
+	time.Minute:    "minute",
+	time.Hour:      "hour",
+	24 * time.Hour: "day",
+}
+
+// backfillBucket is a bucket computed from the reports of a name.
+type backfillBucket struct {
+	ID struct {
+		Key       string    `bson:"key"`
+		Timestamp time.Time `bson:"timestamp"`
+	} `bson:"_id"`
+	Count int     `bson:"count"`
+	Sum   float64 `bson:"sum"`
+	Min   float64 `bson:"min"`
+	Max   float64 `bson:"max"`
+}
+
+// backfillPipeline groups the reports of src into buckets of res per name.
+func backfillPipeline(src rollupSource, res time.Duration) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "timestamp", Value: bson.D{{Key: "$type", Value: "date"}}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "key", Value: "$name"},
+				{Key: "timestamp", Value: bson.D{{Key: "$dateTrunc", Value: bson.D{
+					{Key: "date", Value: "$timestamp"},
+					{Key: "unit", Value: dateTruncUnits[res]},
+				}}}},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "sum", Value: bson.D{{Key: "$sum", Value: src.Value}}},
+			{Key: "min", Value: bson.D{{Key: "$min", Value: src.Value}}},
+			{Key: "max", Value: bson.D{{Key: "$max", Value: src.Value}}},
+		}}},
+	}
+}
+
+// backfillWrites returns the upserts creating the buckets of series that do
+// not exist yet, keyed by the reporting name as when recorded live. Buckets
+// of unnamed reports are dropped.
+func backfillWrites(series string, buckets []backfillBucket) []mongo.WriteModel {
+	var writes []mongo.WriteModel
+	for _, b := range buckets {
+		if b.ID.Key == "" {
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"series": series, "key": b.ID.Key, "timestamp": b.ID.Timestamp.UTC()}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"count": b.Count, "sum": b.Sum, "min": b.Min, "max": b.Max}}).
+			SetUpsert(true))
+	}
+	return writes
+}
+
+// BackfillRollups builds the rollup buckets of the reports stored before
+// rollups were kept, from the key_consumption and node_history collections.
+// Existing buckets are left alone, so it can be run repeatedly; a bucket
+// already started when rollups were introduced keeps only the reports
+// recorded since. The number of buckets created per series is returned.
+func BackfillRollups(ctx context.Context, db *mongo.Database) (map[string]int64, error) {
+	created := map[string]int64{}
+	for _, src := range rollupSources {
+		for _, res := range domain.RollupResolutions {
+			cursor, err := db.Collection(src.Collection).Aggregate(ctx, backfillPipeline(src, res))
+			if err != nil {
+				return created, fmt.Errorf("%s: %w", src.Series, err)
+			}
+			var buckets []backfillBucket
+			if err := cursor.All(ctx, &buckets); err != nil {
+				return created, fmt.Errorf("%s: %w", src.Series, err)
+			}
+			writes := backfillWrites(src.Series, buckets)
+			if len(writes) == 0 {
+				continue
+			}
+			coll := db.Collection(rollupCollections[res])
+			result, err := coll.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return created, fmt.Errorf("%s: %w", src.Series, err)
+			}
+			created[src.Series] += result.UpsertedCount
+		}
+	}
+	return created, nil
+}
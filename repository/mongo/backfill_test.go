@@ -0,0 +1,46 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"mondash-backend/domain"
+)
+
+func TestBackfillWritesPerDevice(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("EEST", 3*3600))
+	bucket := func(name string, max float64) backfillBucket {
+		var b backfillBucket
+		b.ID.Key, b.ID.Timestamp = name, at
+		b.Count, b.Sum, b.Min, b.Max = 1, max, max, max
+		return b
+	}
+	writes := backfillWrites(domain.SeriesNodeKeyCount, []backfillBucket{
+		bucket("precisA", 20),
+		bucket("precisB", 5),
+		bucket("", 1),
+	})
+
+	var keys []string
+	for _, w := range writes {
+		filter := w.(*mongo.UpdateOneModel).Filter.(bson.M)
+		if filter["series"] != domain.SeriesNodeKeyCount || filter["timestamp"] != at.UTC() {
+			t.Fatalf("unexpected filter %v", filter)
+		}
+		keys = append(keys, filter["key"].(string))
+	}
+	if len(keys) != 2 || keys[0] != "precisA" || keys[1] != "precisB" {
+		t.Fatalf("expected one bucket per device, got %v", keys)
+	}
+}
+
+func TestBackfillPipelineUnits(t *testing.T) {
+	for _, res := range domain.RollupResolutions {
+		if dateTruncUnits[res] == "" {
+			t.Errorf("no $dateTrunc unit for resolution %s", res)
+		}
+	}
+}
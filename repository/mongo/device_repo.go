@@ -13,31 +13,31 @@ import (
 	"mondash-backend/repository"
 )
 
-// DeviceRepo implements repository.DeviceRepository backed by MongoDB.
+// DeviceRepo implements repository.DeviceRepository backed by MongoDB. Devices
+// are read through a NodeRepo so they carry the metrics of the latest reports.
 type DeviceRepo struct {
-	coll *mongo.Collection
+	coll  *mongo.Collection
+	nodes *NodeRepo
 }
 
 const keyRateHistoryLimit = 10
 
 // NewDeviceRepo returns a new MongoDB DeviceRepo using the given database.
 func NewDeviceRepo(db *mongo.Database) *DeviceRepo {
-	return &DeviceRepo{coll: db.Collection("static_nodes")}
+	return &DeviceRepo{coll: db.Collection("static_nodes"), nodes: NewNodeRepo(db)}
 }
 
 // List returns all devices from the collection.
-func (r *DeviceRepo) List(silent bool) ([]domain.Device, error) {
+func (r *DeviceRepo) List(ctx context.Context, silent bool) ([]domain.Device, error) {
+	ctx, done := startOp(ctx, "DeviceRepo.List")
+	defer done()
 	if !silent {
 		logger.Log.Debug("mongo list devices")
 	}
-	cursor, err := r.coll.Find(context.Background(), bson.D{})
+	nodes, err := r.nodes.list(ctx, silent)
 	if err != nil {
 		return nil, err
 	}
-	var nodes []domain.NodeInfo
-	if err = cursor.All(context.Background(), &nodes); err != nil {
-		return nil, err
-	}
 	var devices []domain.Device
 	for _, n := range nodes {
 		devices = append(devices, n.Devices...)
@@ -52,13 +52,15 @@ func (r *DeviceRepo) List(silent bool) ([]domain.Device, error) {
 }
 
 // KeyRateHistory returns key rate history for the device ordered chronologically.
-func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry, error) {
+func (r *DeviceRepo) KeyRateHistory(ctx context.Context, id string, limit int) ([]domain.KeyRateEntry, error) {
+	ctx, done := startOp(ctx, "DeviceRepo.KeyRateHistory")
+	defer done()
 	if limit <= 0 {
 		limit = keyRateHistoryLimit
 	}
 
-	cursor, err := r.coll.Database().Collection("device_keyrate").Find(
-		context.Background(),
+	cursor, err := r.coll.Database().Collection(deviceKeyRateCollection).Find(
+		ctx,
 		bson.M{"id": id, "rate": bson.M{"$ne": 0}},
 		options.Find().SetSort(bson.M{"timestamp": -1}),
 	)
@@ -66,25 +68,21 @@ func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry
 		return nil, err
 	}
 
-	var recs []domain.KeyRateEntry
-	if err := cursor.All(context.Background(), &recs); err != nil {
+	var docs []keyRateRecord
+	if err := cursor.All(ctx, &docs); err != nil {
 		return nil, err
 	}
-
-	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Timestamp < recs[j].Timestamp })
+	recs := make([]domain.KeyRateEntry, len(docs))
+	for i, d := range docs {
+		recs[i] = domain.KeyRateEntry{Timestamp: d.Timestamp, Rate: d.Rate}
+	}
 
 	const tolerance = 100 * time.Millisecond
 	var result []domain.KeyRateEntry
 	var group []domain.KeyRateEntry
 	var lastTime time.Time
 
-	parseTS := func(ts string) (time.Time, error) {
-		t, err := time.Parse(time.RFC3339Nano, ts)
-		if err != nil {
-			return time.Parse(time.RFC3339, ts)
-		}
-		return t, nil
-	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Timestamp.Before(recs[j].Timestamp) })
 
 	flush := func() {
 		if len(group) == 0 {
@@ -100,8 +98,8 @@ func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry
 	}
 
 	for _, rec := range recs {
-		ts, err := parseTS(rec.Timestamp)
-		if err != nil {
+		ts := rec.Timestamp
+		if ts.IsZero() {
 			continue
 		}
 		if len(group) == 0 {
@@ -126,11 +124,36 @@ func (r *DeviceRepo) KeyRateHistory(id string, limit int) ([]domain.KeyRateEntry
 	return result, nil
 }
 
+// LatestKeyRates returns the most recent device_keyrate entry of each
+// device.
+func (r *DeviceRepo) LatestKeyRates(ctx context.Context, ids []string) (map[string]domain.KeyRateEntry, error) {
+	ctx, done := startOp(ctx, "DeviceRepo.LatestKeyRates")
+	defer done()
+	res := map[string]domain.KeyRateEntry{}
+	if len(ids) == 0 {
+		return res, nil
+	}
+	cursor, err := r.coll.Database().Collection(deviceKeyRateCollection).Aggregate(ctx, latestPipeline("id", ids))
+	if err != nil {
+		return nil, err
+	}
+	var docs []keyRateRecord
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		res[d.ID] = domain.KeyRateEntry{Timestamp: d.Timestamp, Rate: d.Rate}
+	}
+	return res, nil
+}
+
 // AddKeyRate inserts a key rate entry for the device into the database.
-func (r *DeviceRepo) AddKeyRate(id string, entry domain.KeyRateEntry) error {
-	_, err := r.coll.Database().Collection("device_keyrate").InsertOne(
-		context.Background(),
-		bson.M{"id": id, "timestamp": entry.Timestamp, "rate": entry.Rate},
+func (r *DeviceRepo) AddKeyRate(ctx context.Context, id string, entry domain.KeyRateEntry) error {
+	ctx, done := startOp(ctx, "DeviceRepo.AddKeyRate")
+	defer done()
+	_, err := r.coll.Database().Collection(deviceKeyRateCollection).InsertOne(
+		ctx,
+		keyRateRecord{ID: id, Timestamp: entry.Timestamp, Rate: entry.Rate},
 	)
 	return err
 }
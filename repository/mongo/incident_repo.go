@@ -0,0 +1,154 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+// IncidentRepo implements repository.IncidentRepository backed by MongoDB.
+type IncidentRepo struct {
+	incidents *mongo.Collection
+	silences  *mongo.Collection
+}
+
+// NewIncidentRepo returns a new MongoDB IncidentRepo using the given
+// database. Expired silences are purged by a TTL index.
+func NewIncidentRepo(db *mongo.Database) *IncidentRepo {
+	r := &IncidentRepo{
+		incidents: db.Collection("alert_incidents"),
+		silences:  db.Collection("alert_silences"),
+	}
+	_, err := r.incidents.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "state", Value: 1}}},
+		{Keys: bson.D{{Key: "started_at", Value: -1}}},
+	})
+	if err != nil {
+		logger.Log.Errorw("failed to create incident indexes", "error", err)
+	}
+	_, err = r.silences.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "until", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.Log.Errorw("failed to create silence indexes", "error", err)
+	}
+	return r
+}
+
+// Save upserts the incident document by ID.
+func (r *IncidentRepo) Save(ctx context.Context, i domain.Incident) error {
+	ctx, done := startOp(ctx, "IncidentRepo.Save")
+	defer done()
+	if i.ID == "" || i.AlertID == "" {
+		return errors.New("invalid incident")
+	}
+	logger.Log.Debugw("mongo save incident", "id", i.ID, "state", i.State)
+	_, err := r.incidents.ReplaceOne(
+		ctx,
+		bson.M{"id": i.ID},
+		i,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// Open returns all incidents that are not resolved.
+func (r *IncidentRepo) Open(ctx context.Context) ([]domain.Incident, error) {
+	ctx, done := startOp(ctx, "IncidentRepo.Open")
+	defer done()
+	return r.find(ctx, bson.M{"state": bson.M{"$ne": domain.IncidentResolved}}, options.Find())
+}
+
+// History returns the incidents matching the filter, newest first.
+func (r *IncidentRepo) History(ctx context.Context, f domain.IncidentFilter) ([]domain.Incident, error) {
+	ctx, done := startOp(ctx, "IncidentRepo.History")
+	defer done()
+	filter := bson.M{}
+	if f.Device != "" {
+		filter["device"] = f.Device
+	}
+	if f.Level != "" {
+		filter["level"] = f.Level
+	}
+	started := bson.M{}
+	if !f.Start.IsZero() {
+		started["$gte"] = f.Start
+	}
+	if !f.End.IsZero() {
+		started["$lte"] = f.End
+	}
+	if len(started) > 0 {
+		filter["started_at"] = started
+	}
+	opts := options.Find().SetSort(bson.M{"started_at": -1})
+	if f.Limit > 0 {
+		opts.SetLimit(int64(f.Limit))
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *IncidentRepo) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]domain.Incident, error) {
+	ctx, done := startOp(ctx, "IncidentRepo.find")
+	defer done()
+	cursor, err := r.incidents.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := []domain.Incident{}
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AddSilence inserts a new silence document.
+func (r *IncidentRepo) AddSilence(ctx context.Context, s domain.Silence) error {
+	ctx, done := startOp(ctx, "IncidentRepo.AddSilence")
+	defer done()
+	if s.ID == "" {
+		return errors.New("invalid silence")
+	}
+	_, err := r.silences.InsertOne(ctx, s)
+	return err
+}
+
+// Silences returns the unexpired silences. The TTL monitor only runs
+// periodically, so expiry is checked in the filter too.
+func (r *IncidentRepo) Silences(ctx context.Context) ([]domain.Silence, error) {
+	ctx, done := startOp(ctx, "IncidentRepo.Silences")
+	defer done()
+	cursor, err := r.silences.Find(ctx, bson.M{"until": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	res := []domain.Silence{}
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteSilence removes the silence with the given ID.
+func (r *IncidentRepo) DeleteSilence(ctx context.Context, id string) error {
+	ctx, done := startOp(ctx, "IncidentRepo.DeleteSilence")
+	defer done()
+	res, err := r.silences.DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("silence not found")
+	}
+	return nil
+}
+
+var _ repository.IncidentRepository = (*IncidentRepo)(nil)
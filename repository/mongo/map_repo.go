@@ -5,6 +5,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"mondash-backend/domain"
 	"mondash-backend/logger"
 	"mondash-backend/repository"
@@ -21,14 +22,29 @@ func NewMapRepo(db *mongo.Database) *MapRepo {
 }
 
 // Get returns the network map data from the collection.
-func (r *MapRepo) Get() (domain.MapData, error) {
+func (r *MapRepo) Get(ctx context.Context) (domain.MapData, error) {
+	ctx, done := startOp(ctx, "MapRepo.Get")
+	defer done()
 	logger.Log.Debug("mongo get map data")
 	var data domain.MapData
-	err := r.coll.FindOne(context.Background(), bson.D{}).Decode(&data)
+	err := r.coll.FindOne(ctx, bson.D{}).Decode(&data)
 	if err == nil {
 		logger.Log.Debugw("mongo get map data result", "data", data)
 	}
 	return data, err
 }
 
+// Save replaces the network map document.
+func (r *MapRepo) Save(ctx context.Context, data domain.MapData) error {
+	ctx, done := startOp(ctx, "MapRepo.Save")
+	defer done()
+	_, err := r.coll.ReplaceOne(
+		ctx,
+		bson.M{"_id": 1},
+		bson.M{"_id": 1, "nodes": data.Nodes, "connections": data.Connections},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
 var _ repository.MapRepository = (*MapRepo)(nil)
@@ -0,0 +1,88 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// timestampField is a field that held an RFC3339 string before timestamps
+// were stored as BSON dates. Array names the array of subdocuments holding
+// the field, if any.
+type timestampField struct {
+	Collection string
+	Array      string
+	Field      string
+}
+
+// timestampFields lists every field converted by MigrateTimestamps.
+var timestampFields = []timestampField{
+	{Collection: nodeHistoryCollection, Field: "timestamp"},
+	{Collection: keyConsumptionCollection, Field: "timestamp"},
+	{Collection: deviceKeyRateCollection, Field: "timestamp"},
+	{Collection: "alert_deliveries", Field: "timestamp"},
+	{Collection: "static_nodes", Field: "lastseen"},
+	{Collection: "static_nodes", Array: "events", Field: "timestamp"},
+	{Collection: "static_nodes", Array: "devices", Field: "lastseen"},
+	{Collection: "alerts_response", Array: "alerts", Field: "lastactivated"},
+}
+
+// dateExpr converts the string at path to a date, leaving other values
+// untouched. Strings that do not parse, such as the empty last seen time of a
+// node never heard from, become null.
+func dateExpr(path string) bson.D {
+	return bson.D{{Key: "$cond", Value: bson.A{
+		bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$type", Value: path}}, "string"}}},
+		bson.D{{Key: "$dateFromString", Value: bson.D{
+			{Key: "dateString", Value: path},
+			{Key: "onError", Value: nil},
+		}}},
+		path,
+	}}}
+}
+
+// migration returns the filter selecting the documents in which f still
+// holds a string and the update pipeline converting it.
+func (f timestampField) migration() (bson.D, mongo.Pipeline) {
+	if f.Array == "" {
+		return bson.D{{Key: f.Field, Value: bson.D{{Key: "$type", Value: "string"}}}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: f.Field, Value: dateExpr("$" + f.Field)}}}}}
+	}
+	convert := bson.D{{Key: "$map", Value: bson.D{
+		{Key: "input", Value: "$" + f.Array},
+		{Key: "as", Value: "item"},
+		{Key: "in", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{
+			"$$item",
+			bson.D{{Key: f.Field, Value: dateExpr("$$item." + f.Field)}},
+		}}}},
+	}}}
+	return bson.D{{Key: f.Array + "." + f.Field, Value: bson.D{{Key: "$type", Value: "string"}}}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: f.Array, Value: convert}}}}}
+}
+
+func (f timestampField) String() string {
+	if f.Array == "" {
+		return f.Collection + "." + f.Field
+	}
+	return f.Collection + "." + f.Array + "." + f.Field
+}
+
+// MigrateTimestamps converts the RFC3339 strings stored by earlier versions
+// into BSON dates, so that they are range queried chronologically and expired
+// by the TTL indexes. It can be run repeatedly: documents already holding
+// dates are left alone. The number of documents modified per field is
+// returned.
+func MigrateTimestamps(ctx context.Context, db *mongo.Database) (map[string]int64, error) {
+	modified := map[string]int64{}
+	for _, f := range timestampFields {
+		filter, update := f.migration()
+		res, err := db.Collection(f.Collection).UpdateMany(ctx, filter, update)
+		if err != nil {
+			return modified, fmt.Errorf("%s: %w", f, err)
+		}
+		modified[f.String()] = res.ModifiedCount
+	}
+	return modified, nil
+}
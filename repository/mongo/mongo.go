@@ -10,14 +10,28 @@ import (
 	"mondash-backend/logger"
 )
 
-// Connect establishes a connection to MongoDB and returns the database.
+// Connect establishes a connection to MongoDB and returns the database. The
+// indexes of the time-series collections and the retention configured by
+// RetentionFromEnv are ensured on the way.
 func Connect(uri, dbName string) (*mongo.Database, error) {
+	retention, err := RetentionFromEnv()
+	if err != nil {
+		return nil, err
+	}
 	logger.Log.Infow("connecting to MongoDB", "uri", uri)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetRegistry(Registry).SetMonitor(commandMonitor()))
 	if err != nil {
 		return nil, err
 	}
-	return client.Database(dbName), nil
+	db := client.Database(dbName)
+
+	// Index builds on large collections may take a while.
+	idxCtx, idxCancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer idxCancel()
+	if err := EnsureIndexes(idxCtx, db, retention); err != nil {
+		logger.Log.Errorw("failed to ensure indexes", "error", err)
+	}
+	return db, nil
 }
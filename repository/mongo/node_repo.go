@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -24,12 +25,14 @@ type NodeRepo struct {
 func NewNodeRepo(db *mongo.Database) *NodeRepo {
 	return &NodeRepo{
 		staticColl:  db.Collection("static_nodes"),
-		dynamicColl: db.Collection("node_history"),
+		dynamicColl: db.Collection(nodeHistoryCollection),
 	}
 }
 
 // Update upserts a node's name by ID.
-func (r *NodeRepo) Update(nodes []domain.Node) error {
+func (r *NodeRepo) Update(ctx context.Context, nodes []domain.Node) error {
+	ctx, done := startOp(ctx, "NodeRepo.Update")
+	defer done()
 	if len(nodes) == 0 {
 		return errors.New("invalid nodes")
 	}
@@ -38,12 +41,12 @@ func (r *NodeRepo) Update(nodes []domain.Node) error {
 		if n.Name == "" {
 			return errors.New("invalid node")
 		}
-		if n.Timestamp == "" {
+		if n.Timestamp.IsZero() {
 			return errors.New("missing timestamp")
 		}
-		var last domain.Node
+		var last nodeRecord
 		err := r.dynamicColl.FindOne(
-			context.Background(),
+			ctx,
 			bson.M{"name": n.Name},
 			options.FindOne().SetSort(bson.M{"timestamp": -1}),
 		).Decode(&last)
@@ -58,13 +61,13 @@ func (r *NodeRepo) Update(nodes []domain.Node) error {
 			if msg != "" {
 				event := domain.NodeEvent{Timestamp: n.Timestamp, Message: msg}
 				_, _ = r.staticColl.UpdateOne(
-					context.Background(),
+					ctx,
 					bson.M{"name": n.Name},
 					bson.M{"$push": bson.M{"events": event}},
 				)
 			}
 		}
-		_, err = r.dynamicColl.InsertOne(context.Background(), n)
+		_, err = r.dynamicColl.InsertOne(ctx, newNodeRecord(n))
 		if err != nil {
 			return err
 		}
@@ -73,29 +76,158 @@ func (r *NodeRepo) Update(nodes []domain.Node) error {
 }
 
 // List returns all node information from the collection.
-func (r *NodeRepo) List() ([]domain.NodeInfo, error) {
-	logger.Log.Debug("mongo list nodes")
-	cursor, err := r.staticColl.Find(context.Background(), bson.D{})
+func (r *NodeRepo) List(ctx context.Context) ([]domain.NodeInfo, error) {
+	ctx, done := startOp(ctx, "NodeRepo.List")
+	defer done()
+	return r.list(ctx, false)
+}
+
+// latestPipeline returns the most recent document of every name listed,
+// identified by the given field, in a single pass over the field and
+// timestamp index.
+func latestPipeline(field string, names []string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: names}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: field, Value: 1}, {Key: "timestamp", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$" + field},
+			{Key: "latest", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}},
+		}}},
+		{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$latest"}}}},
+	}
+}
+
+// list returns the nodes merged with their latest reports. When silent is
+// true logging is suppressed.
+func (r *NodeRepo) list(ctx context.Context, silent bool) ([]domain.NodeInfo, error) {
+	ctx, done := startOp(ctx, "NodeRepo.list")
+	defer done()
+	if !silent {
+		logger.Log.Debug("mongo list nodes")
+	}
+	cursor, err := r.staticColl.Find(ctx, bson.D{})
 	if err != nil {
 		return nil, err
 	}
 	var nodes []domain.NodeInfo
-	if err = cursor.All(context.Background(), &nodes); err != nil {
+	if err = cursor.All(ctx, &nodes); err != nil {
 		return nil, err
 	}
+	var names []string
+	for _, n := range nodes {
+		names = append(names, n.Name)
+		for _, d := range n.Devices {
+			names = append(names, d.ID)
+		}
+	}
+	latest := map[string]domain.Node{}
+	if len(names) > 0 {
+		cursor, err := r.dynamicColl.Aggregate(ctx, latestPipeline("name", names))
+		if err != nil {
+			return nil, err
+		}
+		var updates []nodeRecord
+		if err := cursor.All(ctx, &updates); err != nil {
+			return nil, err
+		}
+		for _, u := range updates {
+			latest[u.Name] = u.node()
+		}
+	}
+	now := time.Now()
 	for i := range nodes {
-		var update domain.Node
-		err := r.dynamicColl.FindOne(
-			context.Background(),
-			bson.M{"name": nodes[i].Name},
-			options.FindOne().SetSort(bson.M{"timestamp": -1}),
-		).Decode(&update)
-		if err == nil {
+		if update, ok := latest[nodes[i].Name]; ok {
 			nodes[i].Status = update.Status
 		}
+		repository.MergeLatest(&nodes[i], latest, now)
+	}
+	if !silent {
+		logger.Log.Debugw("mongo list nodes result", "nodes", nodes)
 	}
-	logger.Log.Debugw("mongo list nodes result", "nodes", nodes)
 	return nodes, nil
 }
 
+// History returns the reports appended to node_history for the given names
+// within the time range. A zero start or end leaves the range open.
+func (r *NodeRepo) History(ctx context.Context, names []string, start, end time.Time) ([]domain.Node, error) {
+	ctx, done := startOp(ctx, "NodeRepo.History")
+	defer done()
+	logger.Log.Debugw("mongo node history", "names", names, "start", start, "end", end)
+	filter := bson.M{"name": bson.M{"$in": names}}
+	if ts := rangeFilter(start, end); len(ts) > 0 {
+		filter["timestamp"] = ts
+	}
+	cursor, err := r.dynamicColl.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.M{"timestamp": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []nodeRecord
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	recs := make([]domain.Node, len(docs))
+	for i, d := range docs {
+		recs[i] = d.node()
+	}
+	return recs, nil
+}
+
+// AddEvent pushes an event onto the node's static document.
+func (r *NodeRepo) AddEvent(ctx context.Context, name string, event domain.NodeEvent) error {
+	ctx, done := startOp(ctx, "NodeRepo.AddEvent")
+	defer done()
+	logger.Log.Debugw("mongo add node event", "name", name, "message", event.Message)
+	res, err := r.staticColl.UpdateOne(
+		ctx,
+		bson.M{"name": name},
+		bson.M{"$push": bson.M{"events": event}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("node not found")
+	}
+	return nil
+}
+
+// Sync upserts the static documents of the nodes and deletes those of nodes
+// no longer defined. The status and events of existing nodes are kept.
+func (r *NodeRepo) Sync(ctx context.Context, nodes []domain.NodeInfo) error {
+	ctx, done := startOp(ctx, "NodeRepo.Sync")
+	defer done()
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Name
+		_, err := r.staticColl.UpdateOne(
+			ctx,
+			bson.M{"name": n.Name},
+			bson.M{
+				"$set": bson.M{
+					"id":          n.ID,
+					"name":        n.Name,
+					"kme":         n.KME,
+					"coordinates": n.Coordinates,
+					"type":        n.Type,
+					"connections": n.Connections,
+					"apps":        n.Apps,
+					"devices":     n.Devices,
+				},
+				"$setOnInsert": bson.M{"status": n.Status, "events": n.Events},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := r.staticColl.DeleteMany(ctx, bson.M{"name": bson.M{"$nin": names}})
+	logger.Log.Debugw("mongo synced nodes", "names", names)
+	return err
+}
+
 var _ repository.NodeRepository = (*NodeRepo)(nil)
@@ -0,0 +1,113 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// RollupRepo implements repository.RollupRepository backed by MongoDB. Each
+// resolution has its own collection, such as `rollups_1m`, so that every
+// resolution can be given its own retention.
+type RollupRepo struct {
+	colls map[time.Duration]*mongo.Collection
+}
+
+// rollupRecord is a bucket document of a rollup collection.
+type rollupRecord struct {
+	Series    string    `bson:"series"`
+	Key       string    `bson:"key"`
+	Timestamp time.Time `bson:"timestamp"`
+	Count     int       `bson:"count"`
+	Sum       float64   `bson:"sum"`
+	Min       float64   `bson:"min"`
+	Max       float64   `bson:"max"`
+}
+
+// rollupCollections names the collection of every resolution.
+var rollupCollections = map[time.Duration]string{
+	time.Minute:    "rollups_1m",
+	time.Hour:      "rollups_1h",
+	24 * time.Hour: "rollups_1d",
+}
+
+// NewRollupRepo returns a new MongoDB RollupRepo using the given database.
+func NewRollupRepo(db *mongo.Database) *RollupRepo {
+	colls := map[time.Duration]*mongo.Collection{}
+	for res, name := range rollupCollections {
+		colls[res] = db.Collection(name)
+	}
+	return &RollupRepo{colls: colls}
+}
+
+// Add upserts the bucket containing the sample at every resolution,
+// incrementing its count and sum and widening its bounds.
+func (r *RollupRepo) Add(ctx context.Context, series, key string, at time.Time, value float64) error {
+	ctx, done := startOp(ctx, "RollupRepo.Add")
+	defer done()
+	update := bson.M{
+		"$inc": bson.M{"count": 1, "sum": value},
+		"$min": bson.M{"min": value},
+		"$max": bson.M{"max": value},
+	}
+	for _, res := range domain.RollupResolutions {
+		filter := bson.M{"series": series, "key": key, "timestamp": at.UTC().Truncate(res)}
+		opts := options.Update().SetUpsert(true)
+		_, err := r.colls[res].UpdateOne(ctx, filter, update, opts)
+		if mongo.IsDuplicateKeyError(err) {
+			// A concurrent upsert created the bucket first.
+			_, err = r.colls[res].UpdateOne(ctx, filter, update, opts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Range returns the buckets of the resolution starting between start and end.
+func (r *RollupRepo) Range(ctx context.Context, series string, resolution time.Duration, keys []string, start, end time.Time) (map[string][]domain.RollupPoint, error) {
+	ctx, done := startOp(ctx, "RollupRepo.Range")
+	defer done()
+	res := map[string][]domain.RollupPoint{}
+	coll, ok := r.colls[resolution]
+	if !ok {
+		return res, nil
+	}
+	filter := bson.M{
+		"series":    series,
+		"timestamp": bson.M{"$gte": start, "$lte": end},
+	}
+	if len(keys) > 0 {
+		filter["key"] = bson.M{"$in": keys}
+	}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "key", Value: 1}, {Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var recs []rollupRecord
+	if err := cursor.All(ctx, &recs); err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		p := domain.RollupPoint{
+			Timestamp: rec.Timestamp,
+			Count:     rec.Count,
+			Sum:       rec.Sum,
+			Min:       rec.Min,
+			Max:       rec.Max,
+		}
+		if p.Count > 0 {
+			p.Avg = p.Sum / float64(p.Count)
+		}
+		res[rec.Key] = append(res[rec.Key], p)
+	}
+	return res, nil
+}
+
+var _ repository.RollupRepository = (*RollupRepo)(nil)
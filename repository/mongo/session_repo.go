@@ -0,0 +1,71 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+// SessionRepo implements repository.SessionRepository backed by MongoDB.
+type SessionRepo struct {
+	coll *mongo.Collection
+}
+
+// NewSessionRepo returns a new MongoDB SessionRepo using the given database.
+// A TTL index lets MongoDB purge expired sessions on its own.
+func NewSessionRepo(db *mongo.Database) *SessionRepo {
+	coll := db.Collection("sessions")
+	_, err := coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.Log.Errorw("failed to create session indexes", "error", err)
+	}
+	return &SessionRepo{coll: coll}
+}
+
+// Create inserts a new session document.
+func (r *SessionRepo) Create(ctx context.Context, s domain.Session) error {
+	ctx, done := startOp(ctx, "SessionRepo.Create")
+	defer done()
+	if s.TokenHash == "" || s.UserID == "" {
+		return errors.New("invalid session")
+	}
+	logger.Log.Debugw("mongo create session", "userId", s.UserID)
+	_, err := r.coll.InsertOne(ctx, s)
+	return err
+}
+
+// Get returns the unexpired session with the given token hash. The TTL
+// monitor only runs periodically, so expiry is checked in the filter too.
+func (r *SessionRepo) Get(ctx context.Context, tokenHash string) (domain.Session, error) {
+	ctx, done := startOp(ctx, "SessionRepo.Get")
+	defer done()
+	var s domain.Session
+	err := r.coll.FindOne(
+		ctx,
+		bson.M{"token_hash": tokenHash, "expires_at": bson.M{"$gt": time.Now()}},
+	).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.Session{}, repository.ErrNoSession
+	}
+	return s, err
+}
+
+// Delete removes the session document.
+func (r *SessionRepo) Delete(ctx context.Context, tokenHash string) error {
+	ctx, done := startOp(ctx, "SessionRepo.Delete")
+	defer done()
+	_, err := r.coll.DeleteOne(ctx, bson.M{"token_hash": tokenHash})
+	return err
+}
+
+var _ repository.SessionRepository = (*SessionRepo)(nil)
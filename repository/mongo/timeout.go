@@ -0,0 +1,69 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds repository operations when no timeout is configured.
+const DefaultTimeout = 5 * time.Second
+
+// Timeouts holds the deadlines applied to repository operations. Operations
+// are named after the repository method, e.g. "NodeRepo.History"; those
+// without an entry in PerOperation use Default. A zero duration disables the
+// deadline, leaving only the caller's.
+type Timeouts struct {
+	Default      time.Duration
+	PerOperation map[string]time.Duration
+}
+
+var timeouts = Timeouts{Default: DefaultTimeout}
+
+// SetTimeouts replaces the deadlines used by every repository. It must be
+// called before the repositories are used.
+func SetTimeouts(t Timeouts) {
+	timeouts = t
+}
+
+// TimeoutsFromEnv reads MONGO_TIMEOUT, the default deadline, and
+// MONGO_OP_TIMEOUTS, a comma separated list of operation=duration overrides
+// such as "NodeRepo.History=30s,AppRepo.List=2s".
+func TimeoutsFromEnv() (Timeouts, error) {
+	t := Timeouts{Default: DefaultTimeout, PerOperation: map[string]time.Duration{}}
+	if v := os.Getenv("MONGO_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return Timeouts{}, fmt.Errorf("invalid MONGO_TIMEOUT %q", v)
+		}
+		t.Default = d
+	}
+	for _, entry := range strings.Split(os.Getenv("MONGO_OP_TIMEOUTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		op, v, ok := strings.Cut(entry, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if !ok || err != nil || d < 0 {
+			return Timeouts{}, fmt.Errorf("invalid MONGO_OP_TIMEOUTS entry %q", entry)
+		}
+		t.PerOperation[strings.TrimSpace(op)] = d
+	}
+	return t, nil
+}
+
+// withTimeout derives a context bounded by the deadline of the operation.
+// An earlier deadline of the caller is kept.
+func withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	d, ok := timeouts.PerOperation[op]
+	if !ok {
+		d = timeouts.Default
+	}
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,323 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+)
+
+// Time-series collections receiving one document per report.
+const (
+	nodeHistoryCollection    = "node_history"
+	keyConsumptionCollection = "key_consumption"
+	deviceKeyRateCollection  = "device_keyrate"
+)
+
+// ttlIndexName names the index expiring old reports of a time-series collection.
+const ttlIndexName = "timestamp_ttl"
+
+// Registry decodes the documents of MonDash. Timestamps are stored as BSON
+// dates so that reports can be range queried and expired by TTL indexes;
+// documents written before that hold RFC3339 strings, which are decoded as
+// well until MigrateTimestamps converts them. Strings that do not parse, such
+// as the empty last seen time of a node never heard from, decode as the zero
+// time.
+var Registry = newRegistry()
+
+func newRegistry() *bsoncodec.Registry {
+	rb := bson.NewRegistryBuilder()
+	rb.RegisterTypeDecoder(reflect.TypeOf(time.Time{}), bsoncodec.ValueDecoderFunc(decodeTime))
+	rb.RegisterTypeDecoder(reflect.TypeOf(&time.Time{}), bsoncodec.ValueDecoderFunc(decodeTimePtr))
+	return rb.Build()
+}
+
+var timeCodec = bsoncodec.NewTimeCodec()
+
+func decodeTime(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() != bsontype.String {
+		return timeCodec.DecodeValue(dc, vr, val)
+	}
+	s, err := vr.ReadString()
+	if err != nil {
+		return err
+	}
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	val.Set(reflect.ValueOf(t.UTC()))
+	return nil
+}
+
+// decodeTimePtr decodes optional times, leaving them nil for null and
+// unparsable strings.
+func decodeTimePtr(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case bsontype.Null:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+		t = t.UTC()
+		val.Set(reflect.ValueOf(&t))
+		return nil
+	}
+	t := new(time.Time)
+	if err := timeCodec.DecodeValue(dc, vr, reflect.ValueOf(t).Elem()); err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// rangeFilter returns the timestamp condition selecting reports between start
+// and end, either of which may be zero.
+func rangeFilter(start, end time.Time) bson.M {
+	ts := bson.M{}
+	if !start.IsZero() {
+		ts["$gte"] = start
+	}
+	if !end.IsZero() {
+		ts["$lte"] = end
+	}
+	return ts
+}
+
+// nodeRecord is a document of node_history.
+type nodeRecord struct {
+	Name           string    `bson:"name"`
+	Status         string    `bson:"status"`
+	StoredKeyCount int       `bson:"storedkeycount"`
+	CurrentKeyRate float64   `bson:"currentkeyrate"`
+	Timestamp      time.Time `bson:"timestamp"`
+}
+
+func newNodeRecord(n domain.Node) nodeRecord {
+	return nodeRecord{
+		Name:           n.Name,
+		Status:         n.Status,
+		StoredKeyCount: n.StoredKeyCount,
+		CurrentKeyRate: n.CurrentKeyRate,
+		Timestamp:      n.Timestamp,
+	}
+}
+
+func (r nodeRecord) node() domain.Node {
+	return domain.Node{
+		Name:           r.Name,
+		Status:         r.Status,
+		StoredKeyCount: r.StoredKeyCount,
+		CurrentKeyRate: r.CurrentKeyRate,
+		Timestamp:      r.Timestamp,
+	}
+}
+
+// appRecord is a document of key_consumption.
+type appRecord struct {
+	NodeID       string    `bson:"nodeid"`
+	Name         string    `bson:"name"`
+	NumberOfKeys int       `bson:"numberofkeys"`
+	KeySize      int       `bson:"keysize"`
+	Timestamp    time.Time `bson:"timestamp"`
+}
+
+func newAppRecord(a domain.App) appRecord {
+	return appRecord{
+		NodeID:       a.NodeID,
+		Name:         a.Name,
+		NumberOfKeys: a.NumberOfKeys,
+		KeySize:      a.KeySize,
+		Timestamp:    a.Timestamp,
+	}
+}
+
+func (r appRecord) app() domain.App {
+	return domain.App{
+		NodeID:       r.NodeID,
+		Name:         r.Name,
+		NumberOfKeys: r.NumberOfKeys,
+		KeySize:      r.KeySize,
+		Timestamp:    r.Timestamp,
+	}
+}
+
+// keyRateRecord is a document of device_keyrate.
+type keyRateRecord struct {
+	ID        string    `bson:"id"`
+	Timestamp time.Time `bson:"timestamp"`
+	Rate      int       `bson:"rate"`
+}
+
+// Retention is how long reports and rollup buckets are kept in each
+// time-series collection before MongoDB expires them. Zero keeps them forever.
+type Retention struct {
+	NodeHistory    time.Duration
+	KeyConsumption time.Duration
+	DeviceKeyRate  time.Duration
+	Rollups        map[time.Duration]time.Duration
+}
+
+// defaultRollupRetention keeps minute buckets for a week and hour buckets for
+// three months. Day buckets are kept forever.
+var defaultRollupRetention = map[time.Duration]time.Duration{
+	time.Minute: 7 * 24 * time.Hour,
+	time.Hour:   90 * 24 * time.Hour,
+}
+
+// RetentionFromEnv reads HISTORY_RETENTION, the retention of every
+// time-series collection, and the NODE_HISTORY_RETENTION,
+// KEY_CONSUMPTION_RETENTION and DEVICE_KEYRATE_RETENTION overrides, as well
+// as ROLLUP_1M_RETENTION, ROLLUP_1H_RETENTION and ROLLUP_1D_RETENTION for the
+// rollups. Values are durations such as "720h" or a number of days such as
+// "30d".
+func RetentionFromEnv() (Retention, error) {
+	def, err := retentionVar("HISTORY_RETENTION", 0)
+	if err != nil {
+		return Retention{}, err
+	}
+	r := Retention{Rollups: map[time.Duration]time.Duration{}}
+	for res, coll := range rollupCollections {
+		name := "ROLLUP_" + strings.ToUpper(strings.TrimPrefix(coll, "rollups_")) + "_RETENTION"
+		if r.Rollups[res], err = retentionVar(name, defaultRollupRetention[res]); err != nil {
+			return Retention{}, err
+		}
+	}
+	if r.NodeHistory, err = retentionVar("NODE_HISTORY_RETENTION", def); err != nil {
+		return Retention{}, err
+	}
+	if r.KeyConsumption, err = retentionVar("KEY_CONSUMPTION_RETENTION", def); err != nil {
+		return Retention{}, err
+	}
+	if r.DeviceKeyRate, err = retentionVar("DEVICE_KEYRATE_RETENTION", def); err != nil {
+		return Retention{}, err
+	}
+	return r, nil
+}
+
+func retentionVar(name string, def time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def, nil
+	}
+	var (
+		d   time.Duration
+		err error
+	)
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return d, nil
+}
+
+// EnsureIndexes creates the indexes of the time-series and rollup collections
+// and applies the retention through TTL indexes on their timestamp. Existing TTL
+// indexes are updated when the retention changes and dropped when it is
+// disabled.
+func EnsureIndexes(ctx context.Context, db *mongo.Database, retention Retention) error {
+	type series struct {
+		coll  string
+		index mongo.IndexModel
+		keep  time.Duration
+	}
+	byTime := func(key string) mongo.IndexModel {
+		return mongo.IndexModel{Keys: bson.D{{Key: key, Value: 1}, {Key: "timestamp", Value: -1}}}
+	}
+	all := []series{
+		{nodeHistoryCollection, byTime("name"), retention.NodeHistory},
+		{keyConsumptionCollection, byTime("name"), retention.KeyConsumption},
+		{deviceKeyRateCollection, byTime("id"), retention.DeviceKeyRate},
+	}
+	for _, res := range domain.RollupResolutions {
+		all = append(all, series{rollupCollections[res], mongo.IndexModel{
+			Keys:    bson.D{{Key: "series", Value: 1}, {Key: "key", Value: 1}, {Key: "timestamp", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}, retention.Rollups[res]})
+	}
+	var errs []error
+	for _, s := range all {
+		coll := db.Collection(s.coll)
+		_, err := coll.Indexes().CreateOne(ctx, s.index)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.coll, err))
+			continue
+		}
+		if err := ensureTTL(ctx, coll, s.keep); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.coll, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ensureTTL makes the TTL index of coll expire documents after keep.
+func ensureTTL(ctx context.Context, coll *mongo.Collection, keep time.Duration) error {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var indexes []struct {
+		Name   string `bson:"name"`
+		Expire *int64 `bson:"expireAfterSeconds"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+	var current *int64
+	exists := false
+	for _, idx := range indexes {
+		if idx.Name == ttlIndexName {
+			exists, current = true, idx.Expire
+		}
+	}
+	seconds := int64(keep / time.Second)
+	switch {
+	case keep <= 0 && exists:
+		_, err = coll.Indexes().DropOne(ctx, ttlIndexName)
+	case keep <= 0:
+	case !exists:
+		_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(int32(seconds)),
+		})
+	case current == nil || *current != seconds:
+		err = coll.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coll.Name()},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: ttlIndexName},
+				{Key: "expireAfterSeconds", Value: seconds},
+			}},
+		}).Err()
+	default:
+		return nil
+	}
+	if err == nil && keep > 0 {
+		logger.Log.Infow("applied history retention", "collection", coll.Name(), "retention", keep.String())
+	}
+	return err
+}
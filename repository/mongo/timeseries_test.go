@@ -0,0 +1,71 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+
+	"mondash-backend/domain"
+)
+
+func TestTimestampStoredAsDate(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	raw, err := bson.Marshal(newNodeRecord(domain.Node{Name: "precisA", Status: "up", Timestamp: at}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := bson.Raw(raw).Lookup("timestamp").Type; typ != bsontype.DateTime {
+		t.Fatalf("expected a BSON date, got %s", typ)
+	}
+	var back nodeRecord
+	if err := bson.UnmarshalWithRegistry(Registry, raw, &back); err != nil {
+		t.Fatal(err)
+	}
+	if got := back.node().Timestamp; !got.Equal(at) || got.Location() != time.UTC {
+		t.Fatalf("unexpected timestamp %s", got)
+	}
+}
+
+func TestTimestampDecodesLegacyStrings(t *testing.T) {
+	raw, _ := bson.Marshal(bson.M{"name": "precisA", "timestamp": "2024-05-01T12:00:00.5+02:00"})
+	var rec nodeRecord
+	if err := bson.UnmarshalWithRegistry(Registry, raw, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 5e8, time.UTC); !rec.Timestamp.Equal(want) {
+		t.Fatalf("unexpected timestamp %v", rec.Timestamp)
+	}
+
+	// Nodes never heard from were stored with an empty last seen time.
+	raw, _ = bson.Marshal(bson.M{"name": "precis", "lastseen": "", "events": bson.A{
+		bson.M{"timestamp": "2024-05-01T10:00:00Z", "message": "node went down"},
+	}})
+	var node domain.NodeInfo
+	if err := bson.UnmarshalWithRegistry(Registry, raw, &node); err != nil {
+		t.Fatal(err)
+	}
+	if node.LastSeen != nil {
+		t.Fatalf("expected no last seen time, got %v", node.LastSeen)
+	}
+	if len(node.Events) != 1 || node.Events[0].Timestamp.IsZero() {
+		t.Fatalf("unexpected events %+v", node.Events)
+	}
+}
+
+func TestRetentionFromEnv(t *testing.T) {
+	t.Setenv("HISTORY_RETENTION", "30d")
+	t.Setenv("DEVICE_KEYRATE_RETENTION", "48h")
+	r, err := RetentionFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NodeHistory != 30*24*time.Hour || r.KeyConsumption != 30*24*time.Hour || r.DeviceKeyRate != 48*time.Hour {
+		t.Fatalf("unexpected retention %+v", r)
+	}
+	t.Setenv("NODE_HISTORY_RETENTION", "forever")
+	if _, err := RetentionFromEnv(); err == nil {
+		t.Fatal("expected an invalid retention to be rejected")
+	}
+}
@@ -0,0 +1,53 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+// TopologyRepo implements repository.TopologyRepository backed by MongoDB.
+// The topology is a single document of the topology collection.
+type TopologyRepo struct {
+	coll *mongo.Collection
+}
+
+// topologyDoc is the document holding the topology.
+type topologyDoc struct {
+	ID              int `bson:"_id"`
+	domain.Topology `bson:",inline"`
+}
+
+// NewTopologyRepo returns a new MongoDB TopologyRepo using the given database.
+func NewTopologyRepo(db *mongo.Database) *TopologyRepo {
+	return &TopologyRepo{coll: db.Collection("topology")}
+}
+
+// Get returns the stored topology or repository.ErrNoTopology.
+func (r *TopologyRepo) Get(ctx context.Context) (domain.Topology, error) {
+	ctx, done := startOp(ctx, "TopologyRepo.Get")
+	defer done()
+	var doc topologyDoc
+	err := r.coll.FindOne(ctx, bson.M{"_id": 1}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.Topology{}, repository.ErrNoTopology
+	}
+	return doc.Topology, err
+}
+
+// Save replaces the stored topology.
+func (r *TopologyRepo) Save(ctx context.Context, t domain.Topology) error {
+	ctx, done := startOp(ctx, "TopologyRepo.Save")
+	defer done()
+	logger.Log.Debugw("mongo save topology", "nodes", len(t.Nodes), "devices", len(t.Devices), "links", len(t.Links))
+	_, err := r.coll.ReplaceOne(ctx, bson.M{"_id": 1}, topologyDoc{ID: 1, Topology: t}, options.Replace().SetUpsert(true))
+	return err
+}
+
+var _ repository.TopologyRepository = (*TopologyRepo)(nil)
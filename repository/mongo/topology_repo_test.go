@@ -0,0 +1,40 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
+
+	"mondash-backend/config"
+	"mondash-backend/repository"
+)
+
+func TestTopologyDocRoundTrip(t *testing.T) {
+	cfg, err := config.Load("../../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := bson.Marshal(topologyDoc{ID: 1, Topology: repository.TopologyFromConfig(cfg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc topologyDoc
+	if err := bson.UnmarshalWithRegistry(Registry, raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// The settings must be written back as the YAML they were read from.
+	out, err := yaml.Marshal(repository.ConfigFromTopology(doc.Topology))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back config.Config
+	if err := yaml.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, cfg) {
+		t.Fatalf("export differs from config.yaml:\n%s", out)
+	}
+}
@@ -0,0 +1,66 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("mondash-backend/repository/mongo")
+
+// startOp starts the span of a repository method and bounds it with the
+// method's deadline. The returned function ends both.
+func startOp(ctx context.Context, name string) (context.Context, func()) {
+	ctx, cancel := withTimeout(ctx, name)
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attribute.String("db.system", "mongodb")))
+	return ctx, func() {
+		if err := ctx.Err(); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		cancel()
+	}
+}
+
+// commandMonitor records a client span for every command sent to MongoDB,
+// as a child of the repository method that issued it.
+func commandMonitor() *event.CommandMonitor {
+	var spans sync.Map // request ID -> trace.Span
+	end := func(id int64, err error) {
+		v, ok := spans.LoadAndDelete(id)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			_, span := tracer.Start(ctx, "mongo."+e.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("db.system", "mongodb"),
+					attribute.String("db.name", e.DatabaseName),
+					attribute.String("db.operation", e.CommandName),
+				),
+			)
+			spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			end(e.RequestID, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			end(e.RequestID, errors.New(e.Failure))
+		},
+	}
+}
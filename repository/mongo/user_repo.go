@@ -22,16 +22,22 @@ func NewUserRepo(db *mongo.Database) *UserRepo {
 }
 
 // List returns all users from the collection.
-func (r *UserRepo) List() ([]domain.User, error) {
+func (r *UserRepo) List(ctx context.Context) ([]domain.User, error) {
+	ctx, done := startOp(ctx, "UserRepo.List")
+	defer done()
 	logger.Log.Debug("mongo list users")
-	cursor, err := r.coll.Find(context.Background(), bson.D{})
+	cursor, err := r.coll.Find(ctx, bson.D{})
 	if err != nil {
 		return nil, err
 	}
-	var users []domain.User
-	if err = cursor.All(context.Background(), &users); err != nil {
+	var docs []authDoc
+	if err = cursor.All(ctx, &docs); err != nil {
 		return nil, err
 	}
+	users := make([]domain.User, 0, len(docs))
+	for _, d := range docs {
+		users = append(users, d.user())
+	}
 	logger.Log.Debugw("mongo list users result", "users", users)
 	return users, nil
 }
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"time"
+
+	"mondash-backend/domain"
+)
+
+// MergeLatest copies the live metrics of the most recent reports into a node
+// and its devices. latest maps node or device names to their last report.
+// The node takes the newest report made under its own name or any device
+// name; a device takes its own report and falls back to the node's.
+func MergeLatest(n *domain.NodeInfo, latest map[string]domain.Node, now time.Time) {
+	var (
+		nodeRec  domain.Node
+		nodeTime time.Time
+		found    bool
+	)
+	consider := func(name string) {
+		rec, ok := latest[name]
+		if !ok {
+			return
+		}
+		if rec.Timestamp.IsZero() {
+			return
+		}
+		if !found || rec.Timestamp.After(nodeTime) {
+			nodeRec, nodeTime, found = rec, rec.Timestamp, true
+		}
+	}
+	consider(n.Name)
+	for _, d := range n.Devices {
+		consider(d.ID)
+	}
+	if found {
+		n.StoredKeyCount = nodeRec.StoredKeyCount
+		n.CurrentKeyRate = nodeRec.CurrentKeyRate
+		n.LastSeen = &nodeTime
+		n.DataAge = int64(now.Sub(nodeTime) / time.Second)
+	}
+
+	devices := make([]domain.Device, len(n.Devices))
+	copy(devices, n.Devices)
+	for i := range devices {
+		rec, ok := latest[devices[i].ID]
+		if !ok || rec.Timestamp.IsZero() {
+			if !found {
+				continue
+			}
+			rec = nodeRec
+		}
+		ts := rec.Timestamp
+		devices[i].StoredKeyCount = rec.StoredKeyCount
+		devices[i].CurrentKeyRate = rec.CurrentKeyRate
+		devices[i].LastSeen = &ts
+		devices[i].DataAge = int64(now.Sub(ts) / time.Second)
+	}
+	n.Devices = devices
+}
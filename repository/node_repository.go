@@ -1,9 +1,22 @@
 package repository
 
-import "mondash-backend/domain"
+import (
+	"context"
+	"time"
+
+	"mondash-backend/domain"
+)
 
 // NodeRepository defines persistence methods for nodes.
 type NodeRepository interface {
-	Update(nodes []domain.Node) error
-	List() ([]domain.NodeInfo, error)
+	Update(ctx context.Context, nodes []domain.Node) error
+	List(ctx context.Context) ([]domain.NodeInfo, error)
+	// History returns the reports stored for any of the given node or device
+	// names between start and end (inclusive), ordered chronologically.
+	History(ctx context.Context, names []string, start, end time.Time) ([]domain.Node, error)
+	// AddEvent appends an event to the node with the given name.
+	AddEvent(ctx context.Context, name string, event domain.NodeEvent) error
+	// Sync replaces the node definitions with nodes. The status and events
+	// of nodes that remain defined are kept, as are all reports.
+	Sync(ctx context.Context, nodes []domain.NodeInfo) error
 }
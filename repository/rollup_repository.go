@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"mondash-backend/domain"
+)
+
+// RollupRepository keeps aggregates of time series at every resolution of
+// domain.RollupResolutions.
+type RollupRepository interface {
+	// Add folds a sample taken at `at` into the bucket containing it at every
+	// resolution.
+	Add(ctx context.Context, series, key string, at time.Time, value float64) error
+	// Range returns the buckets of the given resolution starting between
+	// start and end, per key in chronological order. Empty keys select every
+	// key of the series.
+	Range(ctx context.Context, series string, resolution time.Duration, keys []string, start, end time.Time) (map[string][]domain.RollupPoint, error)
+}
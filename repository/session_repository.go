@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"mondash-backend/domain"
+)
+
+// ErrNoSession is returned by SessionRepository.Get for unknown or expired
+// sessions.
+var ErrNoSession = errors.New("session not found")
+
+// SessionRepository defines persistence methods for login sessions.
+type SessionRepository interface {
+	Create(ctx context.Context, session domain.Session) error
+	// Get returns the unexpired session stored under the given token hash.
+	Get(ctx context.Context, tokenHash string) (domain.Session, error)
+	Delete(ctx context.Context, tokenHash string) error
+}
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"sort"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+)
+
+// TopologyFromConfig converts the network definition of config.yaml into a
+// topology. Devices belong to the node given by Config.NodeOf and nodes are
+// those declared, hosting devices or having a geolocation.
+func TopologyFromConfig(cfg config.Config) domain.Topology {
+	t := domain.Topology{
+		Nodes:     []domain.TopologyNode{},
+		Devices:   []domain.TopologyDevice{},
+		Links:     []domain.TopologyLink{},
+		Consumers: append([]string{}, cfg.Consumers...),
+		Paths:     []domain.ConsumerPath{},
+		Settings:  cfg.Extra,
+	}
+	nodeSet := map[string]struct{}{}
+	for name := range cfg.Nodes {
+		nodeSet[name] = struct{}{}
+	}
+	for _, name := range cfg.Devices() {
+		node := cfg.NodeOf(name)
+		nodeSet[node] = struct{}{}
+		t.Devices = append(t.Devices, domain.TopologyDevice{ID: name, Node: node, URL: cfg.URLs[name]})
+	}
+	for name := range cfg.Geolocation {
+		nodeSet[name] = struct{}{}
+	}
+	for name := range nodeSet {
+		n := domain.TopologyNode{Name: name, KME: cfg.Nodes[name].KME, Type: cfg.Nodes[name].Type}
+		if coord, ok := cfg.Geolocation[name]; ok {
+			n.Coordinates = &domain.Coordinates{Lat: coord.Lat, Long: coord.Long}
+		}
+		t.Nodes = append(t.Nodes, n)
+	}
+	sort.Slice(t.Nodes, func(i, j int) bool { return t.Nodes[i].Name < t.Nodes[j].Name })
+	for _, l := range cfg.Links {
+		if len(l) < 2 {
+			continue
+		}
+		link := domain.TopologyLink{From: l[0], To: l[1]}
+		if len(l) > 2 {
+			link.Length = l[2]
+		}
+		t.Links = append(t.Links, link)
+	}
+	for device, consumers := range cfg.Paths {
+		for consumer, routes := range consumers {
+			t.Paths = append(t.Paths, domain.ConsumerPath{Device: device, Consumer: consumer, Routes: routes})
+		}
+	}
+	sortPaths(t.Paths)
+	return t
+}
+
+// ConfigFromTopology converts a topology into the config.yaml format, with
+// every node declared explicitly. It is the inverse of TopologyFromConfig;
+// legacy files are upgraded on the way.
+func ConfigFromTopology(t domain.Topology) config.Config {
+	cfg := config.Config{Consumers: append([]string(nil), t.Consumers...), Extra: t.Settings}
+	for _, n := range t.Nodes {
+		if cfg.Nodes == nil {
+			cfg.Nodes = map[string]config.Node{}
+		}
+		node := config.Node{Devices: []string{}, KME: n.KME, Type: n.Type}
+		for _, d := range t.Devices {
+			if d.Node == n.Name {
+				node.Devices = append(node.Devices, d.ID)
+			}
+		}
+		cfg.Nodes[n.Name] = node
+		if n.Coordinates == nil {
+			continue
+		}
+		if cfg.Geolocation == nil {
+			cfg.Geolocation = map[string]config.Coordinates{}
+		}
+		cfg.Geolocation[n.Name] = config.Coordinates{Lat: n.Coordinates.Lat, Long: n.Coordinates.Long}
+	}
+	for _, d := range t.Devices {
+		if d.URL == "" {
+			continue
+		}
+		if cfg.URLs == nil {
+			cfg.URLs = map[string]string{}
+		}
+		cfg.URLs[d.ID] = d.URL
+	}
+	for _, l := range t.Links {
+		link := []string{l.From, l.To}
+		if l.Length != "" {
+			link = append(link, l.Length)
+		}
+		cfg.Links = append(cfg.Links, link)
+	}
+	for _, p := range t.Paths {
+		if cfg.Paths == nil {
+			cfg.Paths = map[string]map[string][][]string{}
+		}
+		if cfg.Paths[p.Device] == nil {
+			cfg.Paths[p.Device] = map[string][][]string{}
+		}
+		cfg.Paths[p.Device][p.Consumer] = p.Routes
+	}
+	return cfg
+}
+
+func sortPaths(paths []domain.ConsumerPath) {
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Device != paths[j].Device {
+			return paths[i].Device < paths[j].Device
+		}
+		return paths[i].Consumer < paths[j].Consumer
+	})
+}
+
+// deviceNodes maps the devices of the topology to their node.
+func deviceNodes(t domain.Topology) map[string]string {
+	m := make(map[string]string, len(t.Devices))
+	for _, d := range t.Devices {
+		m[d.ID] = d.Node
+	}
+	return m
+}
+
+// nodesByConsumer maps consumers to the sorted nodes whose devices have a
+// path for them.
+func nodesByConsumer(t domain.Topology) map[string][]string {
+	nodeOf := deviceNodes(t)
+	m := map[string][]string{}
+	seen := map[string]map[string]struct{}{}
+	for _, p := range t.Paths {
+		node := nodeOf[p.Device]
+		if seen[p.Consumer] == nil {
+			seen[p.Consumer] = map[string]struct{}{}
+		}
+		if _, ok := seen[p.Consumer][node]; ok || node == "" {
+			continue
+		}
+		seen[p.Consumer][node] = struct{}{}
+		m[p.Consumer] = append(m[p.Consumer], node)
+	}
+	for cons := range m {
+		sort.Strings(m[cons])
+	}
+	return m
+}
+
+// NodesFromTopology returns the node definitions of a topology, without any
+// runtime state, ordered by ID. Nodes without a declared type are trusted
+// nodes when they host more than one device and terminals otherwise.
+func NodesFromTopology(t domain.Topology) []domain.NodeInfo {
+	nodeOf := deviceNodes(t)
+	apps := map[string][]string{}
+	for cons, nodes := range nodesByConsumer(t) {
+		for _, n := range nodes {
+			apps[n] = append(apps[n], cons)
+		}
+	}
+	nodes := make([]domain.NodeInfo, 0, len(t.Nodes))
+	for _, tn := range t.Nodes {
+		n := domain.NodeInfo{
+			ID:          tn.Name,
+			Name:        tn.Name,
+			Status:      "active",
+			KME:         tn.KME,
+			Type:        tn.Type,
+			Apps:        apps[tn.Name],
+			Connections: []domain.Connection{},
+			Devices:     []domain.Device{},
+			Events:      []domain.NodeEvent{},
+		}
+		if n.Apps == nil {
+			n.Apps = []string{}
+		}
+		sort.Strings(n.Apps)
+		if tn.Coordinates != nil {
+			n.Coordinates = *tn.Coordinates
+		}
+		for _, d := range t.Devices {
+			if d.Node != tn.Name {
+				continue
+			}
+			n.Devices = append(n.Devices, domain.Device{
+				ID:          d.ID,
+				Device:      d.ID,
+				Status:      "online",
+				NodeID:      tn.Name,
+				Coordinates: n.Coordinates,
+			})
+		}
+		if n.KME == "" {
+			n.KME = tn.Name + "-kme"
+		}
+		if n.Type == "" {
+			n.Type = "terminal"
+			if len(n.Devices) > 1 {
+				n.Type = "trusted node"
+			}
+		}
+		for _, l := range t.Links {
+			if nodeOf[l.From] == tn.Name {
+				n.Connections = append(n.Connections, domain.Connection{Device: l.From, OtherNode: nodeOf[l.To]})
+			}
+			if nodeOf[l.To] == tn.Name {
+				n.Connections = append(n.Connections, domain.Connection{Device: l.To, OtherNode: nodeOf[l.From]})
+			}
+			for i := range n.Devices {
+				switch n.Devices[i].ID {
+				case l.From:
+					n.Devices[i].ConnectedTo = domain.ConnectedTo{ID: l.To, NodeID: nodeOf[l.To]}
+				case l.To:
+					n.Devices[i].ConnectedTo = domain.ConnectedTo{ID: l.From, NodeID: nodeOf[l.From]}
+				}
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// MapFromTopology returns the network map of a topology with one connection
+// per link between the nodes of its devices.
+func MapFromTopology(t domain.Topology) domain.MapData {
+	nodeOf := deviceNodes(t)
+	data := domain.MapData{
+		Nodes:       make([]domain.MapNode, 0, len(t.Nodes)),
+		Connections: []domain.MapConnection{},
+	}
+	for _, n := range t.Nodes {
+		node := domain.MapNode{ID: n.Name, Name: n.Name, Endpoint: true}
+		if n.Coordinates != nil {
+			node.Coordinates = *n.Coordinates
+		}
+		data.Nodes = append(data.Nodes, node)
+	}
+	sort.Slice(data.Nodes, func(i, j int) bool { return data.Nodes[i].ID < data.Nodes[j].ID })
+	for _, l := range t.Links {
+		data.Connections = append(data.Connections, domain.MapConnection{From: nodeOf[l.From], To: nodeOf[l.To]})
+	}
+	return data
+}
+
+// AppsFromTopology returns the app definitions of the topology's consumers,
+// without any consumption data.
+func AppsFromTopology(t domain.Topology) []domain.AppData {
+	byConsumer := nodesByConsumer(t)
+	apps := make([]domain.AppData, len(t.Consumers))
+	for i, name := range t.Consumers {
+		nodes := byConsumer[name]
+		if nodes == nil {
+			nodes = []string{}
+		}
+		apps[i] = domain.AppData{
+			Name:                  name,
+			Certificate:           name + "-cert.pem",
+			Nodes:                 nodes,
+			KeyConsumptionHistory: []domain.KeyConsumptionEntry{},
+			ErrorHistory:          []string{},
+		}
+	}
+	return apps
+}
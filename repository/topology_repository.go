@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"mondash-backend/domain"
+)
+
+// ErrNoTopology is returned by TopologyRepository.Get before a topology has
+// been saved.
+var ErrNoTopology = errors.New("no topology stored")
+
+// TopologyRepository defines persistence methods for the network topology,
+// which is stored as a whole.
+type TopologyRepository interface {
+	Get(ctx context.Context) (domain.Topology, error)
+	Save(ctx context.Context, t domain.Topology) error
+}
@@ -1,8 +1,12 @@
 package repository
 
-import "mondash-backend/domain"
+import (
+	"context"
+
+	"mondash-backend/domain"
+)
 
 // UserRepository defines persistence methods for users.
 type UserRepository interface {
-	List() ([]domain.User, error)
+	List(ctx context.Context) ([]domain.User, error)
 }
@@ -1,33 +1,49 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
-	"os"
 	"strings"
+
+	"mondash-backend/api"
+	"mondash-backend/logger"
+	"mondash-backend/services"
 )
 
-// AuthMiddleware ensures requests contain X-Auth-Token header.
-func AuthMiddleware(next http.Handler) http.Handler {
-	requiredToken := os.Getenv("AUTH_TOKEN")
-	if requiredToken == "" {
-		requiredToken = "abc"
+// authFailed answers 401 when the credentials are unknown or expired, as
+// reported by invalid, and the status given by api.StatusFor otherwise, so
+// that valid credentials are not rejected while the storage is unreachable.
+func authFailed(w http.ResponseWriter, err, invalid error) {
+	if errors.Is(err, invalid) {
+		http.Error(w, "invalid auth token", http.StatusUnauthorized)
+		return
 	}
+	status := api.StatusFor(err)
+	logger.Log.Warnw("authentication failed", "status", status, "error", err)
+	http.Error(w, "authentication unavailable", status)
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-Auth-Token")
-		if token == "" {
-			http.Error(w, "invalid auth token", http.StatusUnauthorized)
-			return
-		}
+// AuthMiddleware ensures requests carry a valid agent token in the
+// X-Auth-Token header and stores the agent in the request context.
+func AuthMiddleware(agents *services.AgentService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("X-Auth-Token")
+			if token == "" {
+				http.Error(w, "invalid auth token", http.StatusUnauthorized)
+				return
+			}
 
-		if strings.HasPrefix(strings.ToLower(token), "bearer ") {
-			token = strings.TrimSpace(token[7:])
-		}
+			if strings.HasPrefix(strings.ToLower(token), "bearer ") {
+				token = strings.TrimSpace(token[7:])
+			}
 
-		if token != requiredToken {
-			http.Error(w, "invalid auth token", http.StatusUnauthorized)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+			agent, err := agents.Authenticate(r.Context(), token)
+			if err != nil {
+				authFailed(w, err, services.ErrInvalidAgentToken)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(services.WithAgent(r.Context(), agent)))
+		})
+	}
 }
@@ -2,25 +2,26 @@ package middlewares
 
 import (
 	"net/http"
-	"os"
+
+	"mondash-backend/services"
 )
 
-// CookieAuthMiddleware ensures requests contain a valid auth_token cookie.
-func CookieAuthMiddleware(next http.Handler) http.Handler {
-	requiredToken := os.Getenv("AUTH_TOKEN")
-	if requiredToken == "" {
-		requiredToken = "abc"
+// CookieAuthMiddleware resolves the session behind the auth_token cookie and
+// stores its user in the request context.
+func CookieAuthMiddleware(auth *services.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("auth_token")
+			if err != nil || cookie.Value == "" {
+				http.Error(w, "invalid auth token", http.StatusUnauthorized)
+				return
+			}
+			user, err := auth.Authenticate(r.Context(), cookie.Value)
+			if err != nil {
+				authFailed(w, err, services.ErrInvalidSession)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(services.WithUser(r.Context(), user)))
+		})
 	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("auth_token")
-		if err != nil || cookie.Value == "" {
-			http.Error(w, "invalid auth token", http.StatusUnauthorized)
-			return
-		}
-		if cookie.Value != requiredToken {
-			http.Error(w, "invalid auth token", http.StatusUnauthorized)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
 }
@@ -14,13 +14,28 @@ type loggingResponseWriter struct {
 	body   bytes.Buffer
 }
 
+// streaming reports whether the response is an event stream, whose body is
+// not buffered for logging.
+func (lrw *loggingResponseWriter) streaming() bool {
+	return strings.HasPrefix(lrw.Header().Get("Content-Type"), "text/event-stream")
+}
+
+// Flush lets streaming handlers push data through the wrapper.
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.status = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
 func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
-	lrw.body.Write(b)
+	if !lrw.streaming() {
+		lrw.body.Write(b)
+	}
 	return lrw.ResponseWriter.Write(b)
 }
 
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"mondash-backend/services"
+)
+
+// RequirePermission rejects requests whose user is granted none of perms.
+// It must run after the user has been stored in the request context.
+func RequirePermission(authz *services.AuthzService, perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := services.UserFromContext(r.Context())
+			if !ok || !authz.Allowed(user, perms...) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,13 +2,17 @@ package routes
 
 import (
 	"context"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"mondash-backend/api"
+	"mondash-backend/config"
 	"mondash-backend/logger"
+	"mondash-backend/metrics"
 	"mondash-backend/repository"
 	"mondash-backend/repository/inmemory"
 	mongorepo "mondash-backend/repository/mongo"
@@ -22,17 +26,25 @@ func NewRouter(db *mongo.Database) *chi.Mux {
 		_ = logger.Init()
 	}
 	router := chi.NewRouter()
+	httpMetrics := metrics.NewHTTP()
 	router.Use(middlewares.CORSMiddleware)
+	router.Use(middlewares.TracingMiddleware)
 	router.Use(middlewares.LoggingMiddleware)
+	router.Use(middlewares.MetricsMiddleware(httpMetrics))
 
 	var (
-		nodeRepo   repository.NodeRepository
-		appRepo    repository.AppRepository
-		alertRepo  repository.AlertRepository
-		mapRepo    repository.MapRepository
-		deviceRepo repository.DeviceRepository
-		authRepo   repository.AuthRepository
-		userRepo   repository.UserRepository
+		nodeRepo    repository.NodeRepository
+		appRepo     repository.AppRepository
+		alertRepo   repository.AlertRepository
+		mapRepo     repository.MapRepository
+		deviceRepo  repository.DeviceRepository
+		authRepo    repository.AuthRepository
+		userRepo    repository.UserRepository
+		sessionRepo repository.SessionRepository
+		agentRepo   repository.AgentRepository
+		incidentRep repository.IncidentRepository
+		rollupRepo  repository.RollupRepository
+		topoRepo    repository.TopologyRepository
 	)
 
 	if db == nil {
@@ -44,6 +56,11 @@ func NewRouter(db *mongo.Database) *chi.Mux {
 		deviceRepo = inmemory.NewDeviceRepo(nodeRepo.(*inmemory.NodeRepo))
 		authRepo = inmemory.NewAuthRepo()
 		userRepo = inmemory.NewUserRepo(authRepo.(*inmemory.AuthRepo))
+		sessionRepo = inmemory.NewSessionRepo()
+		agentRepo = inmemory.NewAgentRepo()
+		incidentRep = inmemory.NewIncidentRepo()
+		rollupRepo = inmemory.NewRollupRepo()
+		topoRepo = inmemory.NewTopologyRepo()
 	} else {
 		logger.Log.Info("Using MongoDB repositories")
 		nodeRepo = mongorepo.NewNodeRepo(db)
@@ -53,48 +70,128 @@ func NewRouter(db *mongo.Database) *chi.Mux {
 		deviceRepo = mongorepo.NewDeviceRepo(db)
 		authRepo = mongorepo.NewAuthRepo(db)
 		userRepo = mongorepo.NewUserRepo(db)
+		sessionRepo = mongorepo.NewSessionRepo(db)
+		agentRepo = mongorepo.NewAgentRepo(db)
+		incidentRep = mongorepo.NewIncidentRepo(db)
+		rollupRepo = mongorepo.NewRollupRepo(db)
+		topoRepo = mongorepo.NewTopologyRepo(db)
 	}
 
-	nodeService := &services.NodeService{Repo: nodeRepo, DeviceRepo: deviceRepo}
-	appService := &services.AppService{Repo: appRepo}
+	configManager := services.NewConfigManager(config.PathFromEnv(), config.RolesPathFromEnv())
+	network := services.NewNetwork(configManager.Config())
+	heartbeat := services.HeartbeatTimeoutFromEnv()
+	events := services.NewEventHub()
+	rollupService := &services.RollupService{Repo: rollupRepo}
+	nodeService := &services.NodeService{Repo: nodeRepo, DeviceRepo: deviceRepo, HeartbeatTimeout: heartbeat, Events: events, Rollups: rollupService, Network: network}
+	appService := &services.AppService{Repo: appRepo, Events: events, Rollups: rollupService}
 	alertService := &services.AlertService{
-		Repo:       alertRepo,
-		DeviceRepo: deviceRepo,
+		Repo:             alertRepo,
+		DeviceRepo:       deviceRepo,
+		NodeRepo:         nodeRepo,
+		AppRepo:          appRepo,
+		Incidents:        incidentRep,
+		Events:           events,
+		Network:          network,
+		HeartbeatTimeout: heartbeat,
 	}
 	alertService.InitFromEnv()
-	mapService := &services.MapService{Repo: mapRepo}
-	deviceService := &services.DeviceService{Repo: deviceRepo}
+	mapService := &services.MapService{Repo: mapRepo, NodeRepo: nodeRepo, DeviceRepo: deviceRepo, HeartbeatTimeout: heartbeat}
+	deviceService := &services.DeviceService{Repo: deviceRepo, HeartbeatTimeout: heartbeat}
 	userService := &services.UserService{Repo: userRepo}
-	authService := &services.AuthService{Repo: authRepo}
+	authService := &services.AuthService{Repo: authRepo, Sessions: sessionRepo}
+	authService.InitFromEnv()
+	agentService := &services.AgentService{Repo: agentRepo, Network: network}
+	agentService.InitFromEnv()
 
-	_ = alertService.Load()
+	authzService := &services.AuthzService{Roles: configManager.Roles(), Network: network}
+	topologyService := &services.TopologyService{Repo: topoRepo, NodeRepo: nodeRepo, AppRepo: appRepo, MapRepo: mapRepo, Network: network}
+	if err := topologyService.Init(context.Background(), configManager.Config()); err != nil {
+		logger.Log.Warnw("failed to initialise topology", "error", err)
+	}
+	configManager.OnRoles(authzService.SetRoles)
+	configManager.OnConfig(func(cfg config.Config) error {
+		return topologyService.Reload(context.Background(), cfg)
+	})
+	configManager.Watch(context.Background(), services.ConfigReloadIntervalFromEnv())
+	can := func(perms ...string) func(http.Handler) http.Handler {
+		return middlewares.RequirePermission(authzService, perms...)
+	}
+
+	_ = alertService.Load(context.Background())
 	alertService.StartMonitoring(context.Background(), time.Second*5)
+	nodeService.StartMonitoring(context.Background(), time.Second*5)
 
 	router.Get("/healthcheck", api.HealthcheckHandler)
+	registry := metrics.NewRegistry(
+		metrics.NewCollector(nodeService, deviceService, appService, alertService),
+		httpMetrics,
+	)
+	router.With(middlewares.MetricsAuthMiddleware(os.Getenv("METRICS_TOKEN"))).Handle("/metrics", metrics.Handler(registry))
 
 	// API routes used by the frontend
 	router.Route("/api", func(r chi.Router) {
 		r.Post("/login", api.LoginHandler(authService))
-		r.Post("/register", api.RegisterHandler(authService))
 
 		r.Group(func(pr chi.Router) {
-			pr.Use(middlewares.CookieAuthMiddleware)
-			pr.Get("/apps", api.AppsHandler(appService))
-			pr.Get("/apps-timeline", api.AppsTimelineHandler(appService))
-			pr.Get("/alerts", api.AlertsHandler(deviceService, alertService))
-			pr.Post("/alert", api.RegisterAlertHandler(alertService))
-			pr.Get("/active-alerts", api.ActiveAlertsHandler(alertService))
-			pr.Get("/nodes", api.NodesHandler(nodeService))
-			pr.Get("/map", api.MapHandler(mapService))
-			pr.Get("/devices", api.DevicesHandler(deviceService))
-			pr.Get("/users", api.UsersHandler(userService))
+			pr.Use(middlewares.CookieAuthMiddleware(authService))
+			pr.Post("/logout", api.LogoutHandler(authService))
+			pr.Get("/me", api.MeHandler())
+			pr.With(can(config.PermViewApplication)).Get("/apps", api.AppsHandler(appService))
+			pr.With(can(config.PermViewApplication)).Get("/apps-timeline", api.AppsTimelineHandler(appService))
+			pr.With(can(config.PermViewDevices)).Get("/alerts", api.AlertsHandler(deviceService, alertService))
+			pr.With(can(config.PermManageAlerts)).Post("/alert", api.RegisterAlertHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Put("/alerts/{id}", api.UpdateAlertHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Delete("/alerts/{id}", api.DeleteAlertHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Put("/alerts/escalations", api.UpdateEscalationsHandler(alertService))
+			pr.With(can(config.PermViewDevices)).Get("/active-alerts", api.ActiveAlertsHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Get("/alerts/deliveries", api.AlertDeliveriesHandler(alertService))
+			pr.With(can(config.PermViewDevices)).Get("/alerts/history", api.AlertHistoryHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Post("/alerts/{id}/ack", api.AckAlertHandler(alertService))
+			pr.With(can(config.PermViewDevices)).Get("/alerts/silences", api.SilencesHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Post("/alerts/silences", api.CreateSilenceHandler(alertService))
+			pr.With(can(config.PermManageAlerts)).Delete("/alerts/silences/{id}", api.DeleteSilenceHandler(alertService))
+			pr.With(can(config.PermViewNodes, config.PermViewSpecificNode)).Get("/nodes", api.NodesHandler(nodeService, authzService))
+			pr.With(can(config.PermViewNodes, config.PermViewSpecificNode)).Get("/nodes/{id}/history", api.NodeHistoryHandler(nodeService, authzService))
+			pr.With(can(config.PermViewNodes, config.PermViewSpecificNode)).Get("/map", api.MapHandler(mapService, authzService))
+			pr.With(can(config.PermViewDevices, config.PermViewNodeDevices, config.PermViewAssociatedDevices)).Get("/devices", api.DevicesHandler(deviceService, authzService))
+			pr.With(can(
+				config.PermViewNodes, config.PermViewSpecificNode,
+				config.PermViewDevices, config.PermViewNodeDevices, config.PermViewAssociatedDevices,
+				config.PermViewApplication,
+			)).Get("/stream", api.StreamHandler(events, authzService))
+			pr.With(can(
+				config.PermViewNodes, config.PermViewSpecificNode,
+				config.PermViewDevices, config.PermViewNodeDevices, config.PermViewAssociatedDevices,
+				config.PermViewApplication,
+			)).Get("/timeline/{series}", api.TimelineHandler(rollupService, authzService))
+			pr.With(can(config.PermViewNodes, config.PermManageTopology)).Get("/topology", api.TopologyHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Get("/topology/export", api.ExportTopologyHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Post("/topology/import", api.ImportTopologyHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Post("/topology/nodes", api.AddTopologyNodeHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Put("/topology/nodes/{name}", api.UpdateTopologyNodeHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Delete("/topology/nodes/{name}", api.DeleteTopologyNodeHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Post("/topology/devices", api.AddTopologyDeviceHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Put("/topology/devices/{id}", api.UpdateTopologyDeviceHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Delete("/topology/devices/{id}", api.DeleteTopologyDeviceHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Post("/topology/links", api.AddTopologyLinkHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Put("/topology/links/{from}/{to}", api.UpdateTopologyLinkHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Delete("/topology/links/{from}/{to}", api.DeleteTopologyLinkHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Post("/topology/consumers", api.AddTopologyConsumerHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Delete("/topology/consumers/{name}", api.DeleteTopologyConsumerHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Put("/topology/paths/{device}/{consumer}", api.SetTopologyPathHandler(topologyService))
+			pr.With(can(config.PermManageTopology)).Delete("/topology/paths/{device}/{consumer}", api.DeleteTopologyPathHandler(topologyService))
+			pr.With(can(config.PermViewUsers)).Get("/users", api.UsersHandler(userService))
+			pr.With(can(config.PermManageUsers)).Post("/register", api.RegisterHandler(authService))
+			pr.With(can(config.PermManageAgents)).Get("/agents", api.AgentsHandler(agentService))
+			pr.With(can(config.PermManageAgents)).Post("/agents", api.IssueAgentHandler(agentService))
+			pr.With(can(config.PermManageAgents)).Delete("/agents/{id}", api.RevokeAgentHandler(agentService))
 		})
 	})
 
 	router.Group(func(r chi.Router) {
-		r.Use(middlewares.AuthMiddleware)
-		r.Post("/update-node", api.UpdateNodeHandler(nodeService))
-		r.Post("/update-app", api.UpdateAppHandler(appService))
+		r.Use(middlewares.AuthMiddleware(agentService))
+		r.Post("/update-node", api.UpdateNodeHandler(nodeService, agentService))
+		r.Post("/update-app", api.UpdateAppHandler(appService, agentService))
 	})
 
 	return router
@@ -1,14 +1,33 @@
 package routes
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
 )
 
+// sharedToken is the AUTH_TOKEN the tests' agents authenticate with.
+const sharedToken = "shared-test-token"
+
+func TestMain(m *testing.M) {
+	os.Setenv("ALLOW_SHARED_AUTH_TOKEN", "true")
+	os.Setenv("AUTH_TOKEN", sharedToken)
+	os.Exit(m.Run())
+}
+
 func TestHealthcheck(t *testing.T) {
 	router := NewRouter(nil)
 
@@ -44,7 +63,7 @@ func TestUpdateNodeAuthorized(t *testing.T) {
 
 	body := bytes.NewBufferString(`{"nodes":[{"name":"node","status":"up","stored_key_count":1,"current_key_rate":0.5}]}`)
 	req := httptest.NewRequest(http.MethodPost, "/update-node", body)
-	req.Header.Set("X-Auth-Token", "Bearer abc")
+	req.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
 	resp := httptest.NewRecorder()
 
 	router.ServeHTTP(resp, req)
@@ -54,6 +73,31 @@ func TestUpdateNodeAuthorized(t *testing.T) {
 	}
 }
 
+func TestSharedTokenOptIn(t *testing.T) {
+	for _, c := range []struct {
+		allow, token, bearer string
+		want                 int
+	}{
+		{"", sharedToken, sharedToken, http.StatusUnauthorized},
+		{"true", "abc", "abc", http.StatusUnauthorized},
+		{"true", "", "abc", http.StatusUnauthorized},
+		{"true", sharedToken, sharedToken, http.StatusOK},
+	} {
+		t.Setenv("ALLOW_SHARED_AUTH_TOKEN", c.allow)
+		t.Setenv("AUTH_TOKEN", c.token)
+		router := NewRouter(nil)
+
+		body := bytes.NewBufferString(`{"nodes":[{"name":"node","status":"up","stored_key_count":1,"current_key_rate":0.5}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/update-node", body)
+		req.Header.Set("X-Auth-Token", "Bearer "+c.bearer)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != c.want {
+			t.Fatalf("ALLOW_SHARED_AUTH_TOKEN=%q AUTH_TOKEN=%q: expected status %d, got %d", c.allow, c.token, c.want, resp.Code)
+		}
+	}
+}
+
 func TestCORSMiddleware(t *testing.T) {
 	router := NewRouter(nil)
 
@@ -128,8 +172,11 @@ func TestLoginSetsCookie(t *testing.T) {
 	if token == "" {
 		token = "abc"
 	}
-	if cookie[0].Value != token {
-		t.Fatalf("expected cookie value %s, got %s", token, cookie[0].Value)
+	if cookie[0].Value == "" || cookie[0].Value == token {
+		t.Fatalf("expected a per-session token, got %q", cookie[0].Value)
+	}
+	if other := login(t, router, "admin", "admin"); other[0].Value == cookie[0].Value {
+		t.Fatalf("expected a new token for every login")
 	}
 }
 
@@ -164,7 +211,9 @@ func TestAPIWithValidCookie(t *testing.T) {
 	router := NewRouter(nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/apps", nil)
-	req.AddCookie(&http.Cookie{Name: "auth_token", Value: "abc"})
+	for _, c := range login(t, router, "admin", "admin") {
+		req.AddCookie(c)
+	}
 	resp := httptest.NewRecorder()
 
 	router.ServeHTTP(resp, req)
@@ -191,12 +240,913 @@ func TestAppsTimelineWithValidCookie(t *testing.T) {
 	router := NewRouter(nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/apps-timeline?startTimestamp=2024-01-01T00:00:00Z&endTimestamp=2024-01-02T00:00:00Z", nil)
+	for _, c := range login(t, router, "admin", "admin") {
+		req.AddCookie(c)
+	}
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+}
+
+// login authenticates against the router and returns the cookies it sets.
+func login(t *testing.T, router http.Handler, username, password string) []*http.Cookie {
+	t.Helper()
+	body := bytes.NewBufferString(`{"username":"` + username + `","password":"` + password + `"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/login", body)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("login as %s: expected status 200, got %d", username, resp.Code)
+	}
+	return resp.Result().Cookies()
+}
+
+// register creates an account through the router, logged in as the admin.
+func register(t *testing.T, router http.Handler, payload string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewBufferString(payload))
+	req.AddCookie(login(t, router, "admin", "admin")[0])
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("register: expected status 201, got %d", resp.Code)
+	}
+}
+
+func TestAPIRejectsSharedToken(t *testing.T) {
+	router := NewRouter(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/apps", nil)
 	req.AddCookie(&http.Cookie{Name: "auth_token", Value: "abc"})
 	resp := httptest.NewRecorder()
 
 	router.ServeHTTP(resp, req)
 
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", resp.Code)
+	}
+}
+
+func TestMeAndLogout(t *testing.T) {
+	router := NewRouter(nil)
+	cookies := login(t, router, "admin", "admin")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(cookies[0])
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var me struct {
+		ID   string `json:"id"`
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&me); err != nil {
+		t.Fatal(err)
+	}
+	if me.ID != "1" || me.Role != "admin" {
+		t.Fatalf("unexpected user %+v", me)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
 	if resp.Code != http.StatusOK {
 		t.Fatalf("expected status 200, got %d", resp.Code)
 	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 after logout, got %d", resp.Code)
+	}
+}
+
+func TestRegisterRequiresManageUsers(t *testing.T) {
+	router := NewRouter(nil)
+	payload := `{"username":"mallory","email":"m@example.com","password":"pw","role":"admin"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewBufferString(payload))
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: expected status 401, got %d", resp.Code)
+	}
+
+	register(t, router, `{"username":"tech","email":"tech@example.com","password":"pw","role":"technician"}`)
+	req = httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewBufferString(payload))
+	req.AddCookie(login(t, router, "tech", "pw")[0])
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("technician: expected status 403, got %d", resp.Code)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	router := NewRouter(nil)
+	register(t, router, `{"username":"tech","email":"tech@example.com","password":"pw","role":"technician"}`)
+	cookies := login(t, router, "tech", "pw")
+
+	for path, want := range map[string]int{
+		"/api/nodes":   http.StatusOK,
+		"/api/devices": http.StatusOK,
+		"/api/apps":    http.StatusForbidden,
+		"/api/users":   http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != want {
+			t.Fatalf("%s: expected status %d, got %d", path, want, resp.Code)
+		}
+	}
+}
+
+func TestSpecificNodeScope(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	register(t, router, `{"username":"head","email":"head@example.com","password":"pw","role":"partner_head","affiliation":"precis"}`)
+	cookies := login(t, router, "head", "pw")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/nodes", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var nodes []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].ID != "precis" {
+		t.Fatalf("expected only node precis, got %+v", nodes)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	var devices []struct {
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected the 2 devices of precis, got %+v", devices)
+	}
+	for _, d := range devices {
+		if d.NodeID != "precis" {
+			t.Fatalf("unexpected device of node %s", d.NodeID)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/map", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	var data domain.MapData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Nodes) != 1 || data.Nodes[0].ID != "precis" || len(data.Connections) != 0 {
+		t.Fatalf("expected only node precis on the map, got %+v", data)
+	}
+}
+
+func TestAgentTokenScope(t *testing.T) {
+	router := NewRouter(nil)
+	cookies := login(t, router, "admin", "admin")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agents", bytes.NewBufferString(`{"name":"precis-agent","nodes":["precis"]}`))
+	req.AddCookie(cookies[0])
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.Code)
+	}
+	var issued struct {
+		Token string `json:"token"`
+		Agent struct {
+			ID string `json:"id"`
+		} `json:"agent"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(node string) int {
+		body := bytes.NewBufferString(`{"nodes":[{"name":"` + node + `","status":"up","stored_key_count":1,"current_key_rate":0.5}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/update-node", body)
+		req.Header.Set("X-Auth-Token", "Bearer "+issued.Token)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := update("precisA"); code != http.StatusOK {
+		t.Fatalf("expected status 200 for own device, got %d", code)
+	}
+	if code := update("rectorat"); code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for foreign node, got %d", code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/agents/"+issued.Agent.ID, nil)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if code := update("precisA"); code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 after revocation, got %d", code)
+	}
+}
+
+func TestNodeHistory(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+
+	for _, payload := range []string{
+		`{"nodes":[{"name":"precisA","status":"up","stored_key_count":10,"current_key_rate":1}]}`,
+		`{"nodes":[{"name":"precisA","status":"down","stored_key_count":30,"current_key_rate":3}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/update-node", bytes.NewBufferString(payload))
+		req.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.Code)
+		}
+	}
+
+	now := time.Now().UTC()
+	url := "/api/nodes/precis/history?start=" + now.Add(-time.Hour).Format(time.RFC3339) +
+		"&end=" + now.Add(time.Hour).Format(time.RFC3339) + "&step=2h"
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.AddCookie(login(t, router, "admin", "admin")[0])
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var history struct {
+		Points []struct {
+			Status         string  `json:"status"`
+			StoredKeyCount int     `json:"stored_key_count"`
+			CurrentKeyRate float64 `json:"current_key_rate"`
+			Samples        int     `json:"samples"`
+		} `json:"points"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Points) != 1 {
+		t.Fatalf("expected a single bucket, got %+v", history.Points)
+	}
+	p := history.Points[0]
+	if p.Samples != 2 || p.StoredKeyCount != 20 || p.CurrentKeyRate != 2 || p.Status != "down" {
+		t.Fatalf("unexpected bucket %+v", p)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/nodes/unknown/history", nil)
+	req.AddCookie(login(t, router, "admin", "admin")[0])
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.Code)
+	}
+}
+
+func TestNodeAndDeviceMetrics(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+
+	body := bytes.NewBufferString(`{"nodes":[{"name":"precisA","status":"up","stored_key_count":42,"current_key_rate":7.5}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/update-node", body)
+	req.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	cookie := login(t, router, "admin", "admin")[0]
+
+	req = httptest.NewRequest(http.MethodGet, "/api/nodes", nil)
+	req.AddCookie(cookie)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	var nodes []struct {
+		ID             string  `json:"id"`
+		StoredKeyCount int     `json:"storedKeyCount"`
+		CurrentKeyRate float64 `json:"currentKeyRate"`
+		LastSeen       string  `json:"lastSeen"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodes {
+		if n.ID != "precis" {
+			if n.LastSeen != "" {
+				t.Fatalf("node %s never reported but has lastSeen %q", n.ID, n.LastSeen)
+			}
+			continue
+		}
+		if n.StoredKeyCount != 42 || n.CurrentKeyRate != 7.5 || n.LastSeen == "" {
+			t.Fatalf("unexpected metrics for precis: %+v", n)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+	req.AddCookie(cookie)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	var devices []struct {
+		ID             string `json:"id"`
+		StoredKeyCount int    `json:"stored_key_count"`
+		LastSeen       string `json:"last_seen"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range devices {
+		if d.ID == "precisA" && (d.StoredKeyCount != 42 || d.LastSeen == "") {
+			t.Fatalf("unexpected metrics for precisA: %+v", d)
+		}
+	}
+}
+
+func TestMapConnectionStatus(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	cookie := login(t, router, "admin", "admin")[0]
+	report := func(payload string) {
+		req := httptest.NewRequest(http.MethodPost, "/update-node", bytes.NewBufferString(payload))
+		req.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	links := func() map[string]domain.MapConnection {
+		req := httptest.NewRequest(http.MethodGet, "/api/map", nil)
+		req.AddCookie(cookie)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		var data domain.MapData
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			t.Fatal(err)
+		}
+		res := map[string]domain.MapConnection{}
+		for _, c := range data.Connections {
+			res[c.From+"-"+c.To] = c
+		}
+		return res
+	}
+
+	if c := links()["campus-precis"]; c.Status != "yellow" || c.Reason == "" {
+		t.Fatalf("expected an idle link to be yellow, got %+v", c)
+	}
+
+	// The rate of the precis node is not taken for its device precisA.
+	report(`{"nodes":[{"name":"precis","status":"up","current_key_rate":3},{"name":"campus","status":"up","current_key_rate":7}]}`)
+	if c := links()["campus-precis"]; c.KeyRate != 7 {
+		t.Fatalf("expected the rate reported by the campus device, got %+v", c)
+	}
+
+	report(`{"nodes":[{"name":"precisA","status":"up","current_key_rate":5},{"name":"campus","status":"up","current_key_rate":7}]}`)
+	report(`{"nodes":[{"name":"rectorat","status":"down"}]}`)
+	got := links()
+	if c := got["campus-precis"]; c.Status != "green" || c.KeyRate != 5 {
+		t.Fatalf("expected a green link at 5 keys/s, got %+v", c)
+	}
+	if c := got["precis-rectorat"]; c.Status != "red" || c.Reason != "node rectorat is down" {
+		t.Fatalf("expected a red link, got %+v", c)
+	}
+
+	report(`{"nodes":[{"name":"precisA","status":"up","current_key_rate":0}]}`)
+	if c := links()["campus-precis"]; c.Status != "yellow" || c.KeyRate != 0 || !strings.Contains(c.Reason, "no keys exchanged") {
+		t.Fatalf("expected a yellow link at 0 keys/s, got %+v", c)
+	}
+}
+
+func TestAlertLifecycleRoutes(t *testing.T) {
+	router := NewRouter(nil)
+	cookie := login(t, router, "admin", "admin")[0]
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.AddCookie(cookie)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := do(http.MethodPost, "/api/alerts/missing/ack", ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 acknowledging an alert without incident, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/alerts/silences", `{"device":"precisA"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a silence without duration, got %d", resp.Code)
+	}
+	resp := do(http.MethodPost, "/api/alerts/silences", `{"device":"precisA","duration":"1h","reason":"maintenance"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var silence struct {
+		ID        string `json:"id"`
+		CreatedBy string `json:"createdBy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&silence); err != nil {
+		t.Fatal(err)
+	}
+	if silence.ID == "" || silence.CreatedBy == "" {
+		t.Fatalf("unexpected silence %+v", silence)
+	}
+	if resp := do(http.MethodDelete, "/api/alerts/silences/"+silence.ID, ""); resp.Code != http.StatusOK {
+		t.Fatalf("expected 200 deleting the silence, got %d", resp.Code)
+	}
+
+	if resp := do(http.MethodGet, "/api/alerts/history?start=yesterday", ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid start, got %d", resp.Code)
+	}
+	resp = do(http.MethodGet, "/api/alerts/history?device=precisA&level=high", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	var history struct {
+		Incidents []json.RawMessage `json:"incidents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history.Incidents == nil {
+		t.Fatalf("expected an empty incident list, got %s", resp.Body.String())
+	}
+
+	if resp := do(http.MethodPut, "/api/alerts/escalations", `{"escalations":[{"level":"urgent"}]}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown level, got %d", resp.Code)
+	}
+	policy := `{"level":"high","repeatEvery":"5m","contacts":["oncall@example.com"]}`
+	if resp := do(http.MethodPut, "/api/alerts/escalations", `{"escalations":[`+policy+`]}`); resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	resp = do(http.MethodGet, "/api/alerts", "")
+	var alerts struct {
+		Escalations []json.RawMessage `json:"escalations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts.Escalations) != 1 || string(alerts.Escalations[0]) != policy {
+		t.Fatalf("expected the new escalation policy, got %s", alerts.Escalations)
+	}
+}
+
+func TestAlertUpdateAndDelete(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	cookie := login(t, router, "admin", "admin")[0]
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.AddCookie(cookie)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	alerts := func() map[string]string {
+		resp := do(http.MethodGet, "/api/alerts", "")
+		var body struct {
+			Alerts []struct {
+				ID    string `json:"id"`
+				Email string `json:"email"`
+			} `json:"alerts"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		res := map[string]string{}
+		for _, a := range body.Alerts {
+			res[a.ID] = a.Email
+		}
+		return res
+	}
+
+	if resp := do(http.MethodPost, "/api/alert", `{"device":"precisA","level":"high","email":"ops@example.com"}`); resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.Code)
+	}
+	var id string
+	for k, email := range alerts() {
+		if email == "ops@example.com" {
+			id = k
+		}
+	}
+	if id == "" {
+		t.Fatal("expected the registered alert to be listed")
+	}
+	if resp := do(http.MethodPut, "/api/alerts/"+id, `{"device":"precisA","level":"low","channel":"pager"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid update, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPut, "/api/alerts/"+id, `{"device":"precisA","level":"critical"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown level, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/alert", `{"device":"precisA","email":"ops@example.com"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a missing level, got %d", resp.Code)
+	}
+	resp := do(http.MethodPut, "/api/alerts/"+id, `{"device":"precisA","level":"low","email":"noc@example.com"}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if got := alerts()[id]; got != "noc@example.com" {
+		t.Fatalf("expected updated email, got %q", got)
+	}
+
+	if resp := do(http.MethodDelete, "/api/alerts/"+id, ""); resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	if _, ok := alerts()[id]; ok {
+		t.Fatal("expected the alert to be deleted")
+	}
+	if resp := do(http.MethodDelete, "/api/alerts/"+id, ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting twice, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPut, "/api/alerts/"+id, `{"device":"precisA","level":"low"}`); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 updating a deleted alert, got %d", resp.Code)
+	}
+}
+
+func TestStreamPushesNodeEvents(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/stream?types=node.status&nodes=precis", nil)
+	req.AddCookie(login(t, router, "admin", "admin")[0])
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("expected the connected comment, got %q", line)
+	}
+
+	for _, name := range []string{"campus", "precisA"} {
+		update := httptest.NewRequest(http.MethodPost, "/update-node", bytes.NewBufferString(`{"nodes":[{"name":"`+name+`","status":"up"}]}`))
+		update.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, update)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+	}
+
+	done := make(chan []string, 1)
+	go func() {
+		var lines []string
+		for len(lines) < 2 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, ":") {
+				lines = append(lines, line)
+			}
+		}
+		done <- lines
+	}()
+	select {
+	case lines := <-done:
+		if len(lines) != 2 || lines[0] != "event: node.status" || !strings.Contains(lines[1], `"node":"precis"`) {
+			t.Fatalf("unexpected event %q", lines)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+}
+
+func TestStreamAppEventsForQKDUser(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	register(t, router, `{"username":"user","email":"user@example.com","password":"pw","role":"qkd_user","affiliation":"vpn1"}`)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/stream", nil)
+	req.AddCookie(login(t, router, "user", "pw")[0])
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("expected the connected comment, got %q", line)
+	}
+
+	// The node event is outside the user's permissions; the app event is not.
+	for path, payload := range map[string]string{
+		"/update-node": `{"nodes":[{"name":"precis","status":"up"}]}`,
+		"/update-app":  `{"nodeId":"precis","name":"vpn1","numberOfKeys":5,"keySize":256}`,
+	} {
+		update := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		update.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, update)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, rec.Code)
+		}
+	}
+
+	done := make(chan []string, 1)
+	go func() {
+		var lines []string
+		for len(lines) < 2 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, ":") {
+				lines = append(lines, line)
+			}
+		}
+		done <- lines
+	}()
+	select {
+	case lines := <-done:
+		if len(lines) != 2 || lines[0] != "event: app.consumption" || !strings.Contains(lines[1], `"app":"vpn1"`) {
+			t.Fatalf("unexpected event %q", lines)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the app event")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+
+	for path, payload := range map[string]string{
+		"/update-node": `{"nodes":[{"name":"precis","status":"up","stored_key_count":42,"current_key_rate":7}]}`,
+		"/update-app":  `{"nodeId":"precis","name":"vpn1","numberOfKeys":5,"keySize":256}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		req.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, resp.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	body := resp.Body.String()
+	for _, want := range []string{
+		`mondash_node_stored_key_count{node="precis"} 42`,
+		`mondash_node_current_key_rate{node="precis"} 7`,
+		`mondash_app_keys_consumed_total{app="vpn1"} 5`,
+		`mondash_device_key_rate{device="precisA",node="precis"} 7`,
+		`mondash_active_alerts{level="high"}`,
+		`mondash_http_requests_total{code="200",method="POST",route="/update-node"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	t.Setenv("METRICS_TOKEN", "scrape")
+	router := NewRouter(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without token, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 with token, got %d", resp.Code)
+	}
+}
+
+func TestTimelineEndpoints(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+
+	for path, payload := range map[string]string{
+		"/update-node": `{"nodes":[{"name":"precisA","status":"up","stored_key_count":42,"current_key_rate":7}]}`,
+		"/update-app":  `{"nodeId":"precis","name":"vpn1","numberOfKeys":5,"keySize":256}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		req.Header.Set("X-Auth-Token", "Bearer "+sharedToken)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, resp.Code)
+		}
+	}
+	cookies := login(t, router, "admin", "admin")
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := get("/api/timeline/node_key_count?step=1h")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var series domain.RollupSeries
+	if err := json.NewDecoder(resp.Body).Decode(&series); err != nil {
+		t.Fatal(err)
+	}
+	if series.Resolution != "1h0m0s" || len(series.Data["precisA"]) != 1 || series.Data["precisA"][0].Max != 42 {
+		t.Fatalf("unexpected node key count timeline %+v", series)
+	}
+
+	resp = get("/api/apps-timeline")
+	var apps []domain.AppData
+	if err := json.NewDecoder(resp.Body).Decode(&apps); err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps[0].Name != "vpn1" || len(apps[0].KeyConsumptionHistory) != 1 || apps[0].KeyConsumptionHistory[0].Count != 5 {
+		t.Fatalf("unexpected apps timeline %+v", apps)
+	}
+
+	for path, code := range map[string]int{
+		"/api/timeline/temperature":                                      http.StatusNotFound,
+		"/api/timeline/device_key_rate?step=soon":                        http.StatusBadRequest,
+		"/api/apps-timeline?startTimestamp=yesterday":                    http.StatusBadRequest,
+		"/api/apps-timeline?step=1s&startTimestamp=2020-01-01T00:00:00Z": http.StatusBadRequest,
+	} {
+		if resp := get(path); resp.Code != code {
+			t.Errorf("%s: expected status %d, got %d", path, code, resp.Code)
+		}
+	}
+}
+
+func TestTopologyExportRoundTrip(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	cookie := login(t, router, "admin", "admin")[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topology/export", nil)
+	req.AddCookie(cookie)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var got config.Config
+	if err := yaml.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want, err := config.Load("../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("export differs from config.yaml:\n%s", resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/topology/import", bytes.NewReader(resp.Body.Bytes()))
+	req.AddCookie(cookie)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected the export to be imported, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestTopologyCRUD(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	router := NewRouter(nil)
+	cookie := login(t, router, "admin", "admin")[0]
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.AddCookie(cookie)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := do(http.MethodPost, "/api/topology/nodes", `{"name":"lab"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a node without coordinates, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/topology/nodes", `{"name":"lab","coordinates":{"lat":44.44,"long":26.05}}`); resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPost, "/api/topology/nodes", `{"name":"lab","coordinates":{"lat":44.44,"long":26.05}}`); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate node, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/topology/devices", `{"id":"lab","node":"lab"}`); resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPost, "/api/topology/links", `{"from":"lab","to":"nowhere"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a dangling link, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/topology/links", `{"from":"lab","to":"campus","length":"2000"}`); resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPut, "/api/topology/paths/lab/vault1", `{"routes":[["campus","vault1"]]}`); resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodDelete, "/api/topology/devices/lab", ""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 deleting a linked device, got %d", resp.Code)
+	}
+
+	resp := do(http.MethodGet, "/api/nodes", "")
+	var nodes []domain.NodeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
+		t.Fatal(err)
+	}
+	var lab *domain.NodeInfo
+	for i := range nodes {
+		if nodes[i].ID == "lab" {
+			lab = &nodes[i]
+		}
+	}
+	if lab == nil || len(lab.Devices) != 1 || lab.Devices[0].ConnectedTo.ID != "campus" || len(lab.Apps) != 1 || lab.Apps[0] != "vault1" {
+		t.Fatalf("expected the new node in /api/nodes, got %+v", lab)
+	}
+
+	for _, url := range []string{"/api/topology/paths/lab/vault1", "/api/topology/links/campus/lab", "/api/topology/devices/lab", "/api/topology/nodes/lab"} {
+		if resp := do(http.MethodDelete, url, ""); resp.Code != http.StatusNoContent {
+			t.Fatalf("expected 204 deleting %s, got %d: %s", url, resp.Code, resp.Body.String())
+		}
+	}
+	if resp := do(http.MethodDelete, "/api/topology/nodes/lab", ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting a missing node, got %d", resp.Code)
+	}
+}
+
+func TestRolesHotReload(t *testing.T) {
+	rolesPath := filepath.Join(t.TempDir(), "roles.yaml")
+	if err := os.WriteFile(rolesPath, []byte("roles:\n  admin: [\"*\"]\n  technician: [view_devices]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ROLES_FILE", rolesPath)
+	t.Setenv("CONFIG_RELOAD_INTERVAL", "10ms")
+	router := NewRouter(nil)
+	register(t, router, `{"username":"tech","email":"tech@example.com","password":"pw","role":"technician"}`)
+	cookies := login(t, router, "tech", "pw")
+	nodes := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	if code := nodes(); code != http.StatusForbidden {
+		t.Fatalf("expected 403 before the reload, got %d", code)
+	}
+
+	if err := os.WriteFile(rolesPath, []byte("roles:\n  admin: [\"*\"]\n  technician: [view_devices, view_nodes]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for nodes() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the new roles to be applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
@@ -44,6 +44,15 @@ func main() {
 		"alerts_response",
 		"auth_users",
 		"device_keyrate",
+		"sessions",
+		"agent_tokens",
+		"alert_deliveries",
+		"alert_incidents",
+		"alert_silences",
+		"rollups_1m",
+		"rollups_1h",
+		"rollups_1d",
+		"topology",
 	}
 
 	for _, coll := range collections {
@@ -0,0 +1,58 @@
+// Command migrate converts the timestamps stored as RFC3339 strings by
+// earlier versions into BSON dates and builds the rollups of the reports
+// stored before rollups were kept. It is safe to run more than once.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"mondash-backend/logger"
+	mongorepo "mondash-backend/repository/mongo"
+)
+
+func main() {
+	_ = godotenv.Load()
+
+	if err := logger.Init(); err != nil {
+		log.Fatalf("failed to init logger: %v", err)
+	}
+	defer logger.Log.Sync()
+
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://mongodb:27017"
+	}
+	dbName := os.Getenv("MONGODB_DATABASE")
+	if dbName == "" {
+		dbName = "mondash"
+	}
+
+	db, err := mongorepo.Connect(uri, dbName)
+	if err != nil {
+		logger.Log.Fatalf("failed to connect to MongoDB: %v", err)
+	}
+
+	modified, err := mongorepo.MigrateTimestamps(context.Background(), db)
+	for field, n := range modified {
+		logger.Log.Infow("migrated timestamps", "field", field, "documents", n)
+	}
+	if err != nil {
+		logger.Log.Fatalf("failed to migrate timestamps: %v", err)
+	}
+
+	logger.Log.Info("Timestamps migrated successfully")
+
+	created, err := mongorepo.BackfillRollups(context.Background(), db)
+	for series, n := range created {
+		logger.Log.Infow("backfilled rollups", "series", series, "buckets", n)
+	}
+	if err != nil {
+		logger.Log.Fatalf("failed to backfill rollups: %v", err)
+	}
+
+	logger.Log.Info("Rollups backfilled successfully")
+}
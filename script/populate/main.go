@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 
 	"mondash-backend/logger"
+	"mondash-backend/password"
 	"mondash-backend/repository/inmemory"
 	mongorepo "mondash-backend/repository/mongo"
 )
@@ -44,6 +45,7 @@ func main() {
 	db.Collection("map").Drop(ctx)
 	db.Collection("alerts_response").Drop(ctx)
 	db.Collection("auth_users").Drop(ctx)
+	db.Collection("sessions").Drop(ctx)
 
 	// populate static node information
 	if nodes := inmemory.DefaultNodeData(); len(nodes) > 0 {
@@ -73,10 +75,14 @@ func main() {
 	}
 
 	// create default admin account
+	hash, err := password.Hash("admin")
+	if err != nil {
+		logger.Log.Fatal(err)
+	}
 	admin := bson.M{
 		"id":          "1",
 		"username":    "admin",
-		"password":    "admin",
+		"password":    hash,
 		"email":       "admin@ronaqci.eu",
 		"fullname":    "Administrator",
 		"affiliation": "RoNaQCI",
@@ -92,5 +98,13 @@ func main() {
 		logger.Log.Fatal(err)
 	}
 
+	retention, err := mongorepo.RetentionFromEnv()
+	if err != nil {
+		logger.Log.Fatal(err)
+	}
+	if err := mongorepo.EnsureIndexes(ctx, db, retention); err != nil {
+		logger.Log.Fatal(err)
+	}
+
 	logger.Log.Info("Database populated with default data")
 }
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+type agentKey struct{}
+
+// WithAgent returns a copy of ctx carrying the authenticated agent.
+func WithAgent(ctx context.Context, a domain.AgentToken) context.Context {
+	return context.WithValue(ctx, agentKey{}, a)
+}
+
+// AgentFromContext returns the authenticated agent stored by WithAgent.
+func AgentFromContext(ctx context.Context) (domain.AgentToken, bool) {
+	a, ok := ctx.Value(agentKey{}).(domain.AgentToken)
+	return a, ok
+}
+
+// sharedAgentID identifies the unscoped credential derived from AUTH_TOKEN.
+const sharedAgentID = "shared"
+
+// defaultSharedToken is the AUTH_TOKEN value shipped in old .env files. It is
+// public, so it is never accepted.
+const defaultSharedToken = "abc"
+
+// AgentService manages the credentials used by KME agents to post to
+// /update-node and /update-app.
+type AgentService struct {
+	Repo repository.AgentRepository
+	// Network tells which node a reported device belongs to.
+	Network *Network
+
+	sharedToken string
+}
+
+// InitFromEnv loads the legacy shared agent token from AUTH_TOKEN. It may
+// report for every node, so it is only accepted when ALLOW_SHARED_AUTH_TOKEN
+// is "true", and never when left empty or set to the old "abc" default.
+func (s *AgentService) InitFromEnv() {
+	s.sharedToken = ""
+	if strings.ToLower(os.Getenv("ALLOW_SHARED_AUTH_TOKEN")) != "true" {
+		return
+	}
+	token := os.Getenv("AUTH_TOKEN")
+	if token == "" || token == defaultSharedToken {
+		logger.Log.Error("refusing the default shared AUTH_TOKEN, set a secret value or issue per-agent tokens")
+		return
+	}
+	logger.Log.Warn("the shared AUTH_TOKEN is accepted for every node")
+	s.sharedToken = token
+}
+
+// Issue creates a credential for an agent reporting for the given nodes. The
+// plaintext token is only returned here.
+func (s *AgentService) Issue(ctx context.Context, name string, nodes []string) (string, domain.AgentToken, error) {
+	ctx, span := startSpan(ctx, "AgentService.Issue")
+	defer span.End()
+	if s.Repo == nil {
+		return "", domain.AgentToken{}, errors.New("agent registry unavailable")
+	}
+	var clean []string
+	for _, n := range nodes {
+		if n = strings.TrimSpace(n); n != "" {
+			clean = append(clean, n)
+		}
+	}
+	if len(clean) == 0 {
+		return "", domain.AgentToken{}, errors.New("at least one node is required")
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", domain.AgentToken{}, err
+	}
+	agent := domain.AgentToken{
+		ID:        fmt.Sprintf("agent-%d", time.Now().UnixNano()),
+		Name:      name,
+		Nodes:     clean,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now(),
+	}
+	if err := s.Repo.Add(ctx, agent); err != nil {
+		return "", domain.AgentToken{}, err
+	}
+	return token, agent, nil
+}
+
+// List returns all issued agent credentials.
+func (s *AgentService) List(ctx context.Context) ([]domain.AgentToken, error) {
+	ctx, span := startSpan(ctx, "AgentService.List")
+	defer span.End()
+	if s.Repo == nil {
+		return []domain.AgentToken{}, nil
+	}
+	return s.Repo.List(ctx)
+}
+
+// Revoke disables the credential with the given ID.
+func (s *AgentService) Revoke(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "AgentService.Revoke")
+	defer span.End()
+	if s.Repo == nil {
+		return errors.New("agent registry unavailable")
+	}
+	return s.Repo.Revoke(ctx, id)
+}
+
+// ErrInvalidAgentToken is returned by Authenticate for unknown or revoked
+// tokens. Other errors come from the storage.
+var ErrInvalidAgentToken = errors.New("invalid auth token")
+
+// Authenticate resolves a bearer token to the agent credential it belongs to.
+func (s *AgentService) Authenticate(ctx context.Context, token string) (domain.AgentToken, error) {
+	ctx, span := startSpan(ctx, "AgentService.Authenticate")
+	defer span.End()
+	if token == "" {
+		return domain.AgentToken{}, ErrInvalidAgentToken
+	}
+	if s.sharedToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.sharedToken)) == 1 {
+		logger.Log.Warn("agent authenticated with the shared AUTH_TOKEN, issue it a per-agent token")
+		return domain.AgentToken{ID: sharedAgentID, Name: "AUTH_TOKEN"}, nil
+	}
+	if s.Repo == nil {
+		return domain.AgentToken{}, ErrInvalidAgentToken
+	}
+	agent, err := s.Repo.ByTokenHash(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNoAgentToken) || err == nil && agent.Revoked {
+		return domain.AgentToken{}, ErrInvalidAgentToken
+	}
+	if err != nil {
+		return domain.AgentToken{}, err
+	}
+	return agent, nil
+}
+
+// Allowed reports whether the agent may report for the named node or device.
+// A device is covered by its node's scope.
+func (s *AgentService) Allowed(agent domain.AgentToken, name string) bool {
+	if agent.ID == sharedAgentID {
+		return true
+	}
+	for _, n := range agent.Nodes {
+		if n == name || n == s.Network.NodeOf(name) {
+			return true
+		}
+	}
+	return false
+}
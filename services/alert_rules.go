@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mondash-backend/domain"
+)
+
+// Metrics that threshold alert rules can watch.
+const (
+	// MetricDeviceKeyRate is the key rate last reported for a device.
+	MetricDeviceKeyRate = "device_key_rate"
+	// MetricNodeStoredKeyCount is the number of keys stored by a node's KME.
+	MetricNodeStoredKeyCount = "node_stored_key_count"
+	// MetricAppConsumptionRate is the number of keys an app consumed during
+	// the last minute.
+	MetricAppConsumptionRate = "app_consumption_rate"
+)
+
+// AlertMetrics lists the metrics alert rules may use.
+var AlertMetrics = []string{MetricDeviceKeyRate, MetricNodeStoredKeyCount, MetricAppConsumptionRate}
+
+// AlertOperators lists the comparison operators alert rules may use.
+var AlertOperators = []string{"<", "<=", ">", ">=", "==", "!="}
+
+// ErrInvalidAlert is returned when an alert registration is malformed.
+var ErrInvalidAlert = errors.New("invalid alert")
+
+// ErrAlertNotFound is returned when no alert is registered under an ID.
+var ErrAlertNotFound = errors.New("alert not found")
+
+// appRateWindow is the window over which app consumption is summed.
+const appRateWindow = time.Minute
+
+// validateRule checks the rule fields of an alert. Plain device alerts
+// without a metric only need a device.
+func validateRule(a domain.Alert) error {
+	if a.Metric == "" {
+		if a.Device == "" {
+			return fmt.Errorf("%w: device is required", ErrInvalidAlert)
+		}
+		return nil
+	}
+	known := false
+	for _, m := range AlertMetrics {
+		known = known || m == a.Metric
+	}
+	if !known {
+		return fmt.Errorf("%w: unknown metric %q", ErrInvalidAlert, a.Metric)
+	}
+	if a.Target == "" {
+		return fmt.Errorf("%w: target is required", ErrInvalidAlert)
+	}
+	if _, err := compare(a.Operator, 0, 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+	}
+	if a.Duration != "" {
+		if d, err := time.ParseDuration(a.Duration); err != nil || d < 0 {
+			return fmt.Errorf("%w: invalid duration %q", ErrInvalidAlert, a.Duration)
+		}
+	}
+	return nil
+}
+
+// compare applies the operator to value and threshold.
+func compare(op string, value, threshold float64) (bool, error) {
+	switch op {
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case ">":
+		return value > threshold, nil
+	case ">=":
+		return value >= threshold, nil
+	case "==":
+		return value == threshold, nil
+	case "!=":
+		return value != threshold, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+// ruleDuration returns how long the rule condition must hold before firing.
+func ruleDuration(a domain.Alert) time.Duration {
+	d, _ := time.ParseDuration(a.Duration)
+	return d
+}
+
+// metricSnapshot holds the current metric values used to evaluate rules,
+// keyed by metric and then by target.
+type metricSnapshot map[string]map[string]float64
+
+// snapshotMetrics collects the current values of every metric. The key rate
+// of a device is its latest device_keyrate sample, so a device that never
+// reported on its own has no value rather than its node's.
+func (s *AlertService) snapshotMetrics(ctx context.Context, devices []domain.Device) metricSnapshot {
+	snap := metricSnapshot{
+		MetricDeviceKeyRate:      {},
+		MetricNodeStoredKeyCount: {},
+		MetricAppConsumptionRate: {},
+	}
+	var ids []string
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	if rates, err := s.DeviceRepo.LatestKeyRates(ctx, ids); err == nil {
+		for id, e := range rates {
+			snap[MetricDeviceKeyRate][id] = float64(e.Rate)
+		}
+	}
+	if s.NodeRepo != nil {
+		if nodes, err := s.NodeRepo.List(ctx); err == nil {
+			for _, n := range nodes {
+				snap[MetricNodeStoredKeyCount][n.ID] = float64(n.StoredKeyCount)
+			}
+		}
+	}
+	if s.AppRepo != nil {
+		now := time.Now()
+		apps, err := s.AppRepo.Timeline(ctx, now.Add(-appRateWindow), now)
+		if err == nil {
+			for _, app := range apps {
+				sum := 0
+				for _, e := range app.KeyConsumptionHistory {
+					sum += e.Count
+				}
+				snap[MetricAppConsumptionRate][app.Name] = float64(sum)
+			}
+		}
+	}
+	return snap
+}
+
+// value returns the current value of the rule's metric. Apps that consumed
+// no keys in the window have a rate of zero; other missing targets have no
+// value.
+func (m metricSnapshot) value(a domain.Alert) (float64, bool) {
+	v, ok := m[a.Metric][a.Target]
+	if !ok && a.Metric == MetricAppConsumptionRate {
+		return 0, true
+	}
+	return v, ok
+}
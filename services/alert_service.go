@@ -3,13 +3,13 @@ package services
 import (
 	"context"
 	"fmt"
-	"net/smtp"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"mondash-backend/domain"
-	"mondash-backend/logger"
+	"mondash-backend/notifier"
 	"mondash-backend/repository"
 )
 
@@ -17,79 +17,234 @@ import (
 type AlertService struct {
 	Repo       repository.AlertRepository
 	DeviceRepo repository.DeviceRepository
+	NodeRepo   repository.NodeRepository
+	AppRepo    repository.AppRepository
+	// Incidents persists the firing history and silences. It is optional.
+	Incidents repository.IncidentRepository
+	// Events receives alert transitions. It is optional.
+	Events *EventHub
+	// Network tells which node alerted devices belong to.
+	Network *Network
+	// HeartbeatTimeout is how long a device may go without reports before it
+	// is treated as unknown and alerted on. Zero disables stale detection.
+	HeartbeatTimeout time.Duration
 
+	mu         sync.Mutex
 	registered []domain.Alert
+	// pending records since when the condition of each rule has held.
+	pending map[string]time.Time
+	// open holds the unresolved incident of each alert by alert ID.
+	open map[string]domain.Incident
+	// policies holds the escalation policy of each alert level.
+	policies map[string]escalationPolicy
+
+	// Notifiers maps each delivery channel to its implementation.
+	Notifiers map[string]notifier.Notifier
 
 	emailEnabled bool
-	smtpHost     string
-	smtpPort     string
-	smtpUser     string
-	smtpPass     string
-	smtpFrom     string
+	maxAttempts  int
+	backoff      time.Duration
 }
 
-// InitFromEnv loads email settings from environment variables.
+// InitFromEnv loads notification settings from environment variables.
 func (s *AlertService) InitFromEnv() {
 	s.emailEnabled = strings.ToLower(os.Getenv("EMAIL_ON_ALERT")) == "true"
-	s.smtpHost = os.Getenv("SMTP_HOST")
-	s.smtpPort = os.Getenv("SMTP_PORT")
-	s.smtpUser = os.Getenv("SMTP_USERNAME")
-	s.smtpPass = os.Getenv("SMTP_PASSWORD")
-	s.smtpFrom = os.Getenv("SMTP_FROM")
+	s.initNotifiers()
 }
 
 // List returns alerts from the repository.
-func (s *AlertService) List() (domain.AlertInfo, error) {
+func (s *AlertService) List(ctx context.Context) (domain.AlertInfo, error) {
+	ctx, span := startSpan(ctx, "AlertService.List")
+	defer span.End()
 	if s.Repo == nil {
 		return domain.AlertInfo{}, nil
 	}
-	return s.Repo.List()
+	return s.Repo.List(ctx)
 }
 
-// Load fetches the registered alerts from the repository.
-func (s *AlertService) Load() error {
+// Load fetches the registered alerts and open incidents from the
+// repositories.
+func (s *AlertService) Load(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "AlertService.Load")
+	defer span.End()
+	if err := s.loadIncidents(ctx); err != nil {
+		return err
+	}
 	if s.Repo == nil {
 		return nil
 	}
-	res, err := s.Repo.List()
+	res, err := s.Repo.List(ctx)
 	if err != nil {
 		return err
 	}
+	s.mu.Lock()
 	s.registered = res.Alerts
+	s.policies = parseEscalations(res.Escalations)
+	s.mu.Unlock()
 	return nil
 }
 
-// Register stores a new alert.
-func (s *AlertService) Register(a domain.Alert) error {
+// defaultAlertLevels are the alert levels used when the alert configuration
+// defines none.
+var defaultAlertLevels = []string{"low", "medium", "high"}
+
+// alertLevels returns the alert levels of the alert configuration.
+func (s *AlertService) alertLevels(ctx context.Context) ([]string, error) {
+	if s.Repo == nil {
+		return defaultAlertLevels, nil
+	}
+	res, err := s.Repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.AlertLevels) == 0 {
+		return defaultAlertLevels, nil
+	}
+	return res.AlertLevels, nil
+}
+
+// validateLevel checks that the alert uses one of the configured levels.
+func (s *AlertService) validateLevel(ctx context.Context, a domain.Alert) error {
+	levels, err := s.alertLevels(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range levels {
+		if l == a.Level {
+			return nil
+		}
+	}
+	if a.Level == "" {
+		return fmt.Errorf("%w: level is required", ErrInvalidAlert)
+	}
+	return fmt.Errorf("%w: unknown level %q", ErrInvalidAlert, a.Level)
+}
+
+// Register validates and stores a new alert.
+func (s *AlertService) Register(ctx context.Context, a domain.Alert) error {
+	ctx, span := startSpan(ctx, "AlertService.Register")
+	defer span.End()
 	if s.Repo == nil {
 		return nil
 	}
+	if err := validateRule(a); err != nil {
+		return err
+	}
+	if err := validateChannel(a); err != nil {
+		return err
+	}
+	if err := s.validateLevel(ctx, a); err != nil {
+		return err
+	}
 	if a.ID == "" {
 		a.ID = fmt.Sprintf("alert-%d", time.Now().UnixNano())
 	}
-	if err := s.Repo.Add(a); err != nil {
+	if err := s.Repo.Add(ctx, a); err != nil {
 		return err
 	}
+	s.mu.Lock()
 	s.registered = append(s.registered, a)
+	s.mu.Unlock()
 	return nil
 }
 
-// ActiveAlerts returns all alerts whose device status is offline.
-func (s *AlertService) ActiveAlerts() ([]domain.Alert, error) {
+// Update validates and replaces the registered alert with the given ID. The
+// alert is re-evaluated from scratch: an open incident is closed without a
+// recovery notification and fires again if the condition still holds.
+func (s *AlertService) Update(ctx context.Context, id string, a domain.Alert) (domain.Alert, error) {
+	ctx, span := startSpan(ctx, "AlertService.Update")
+	defer span.End()
+	if err := validateRule(a); err != nil {
+		return domain.Alert{}, err
+	}
+	if err := validateChannel(a); err != nil {
+		return domain.Alert{}, err
+	}
+	if err := s.validateLevel(ctx, a); err != nil {
+		return domain.Alert{}, err
+	}
+	a.ID, a.LastActivated = id, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(id)
+	if i < 0 {
+		return domain.Alert{}, ErrAlertNotFound
+	}
+	if s.Repo != nil {
+		if err := s.Repo.Update(ctx, a); err != nil {
+			return domain.Alert{}, err
+		}
+	}
+	s.registered[i] = a
+	s.forget(ctx, id, time.Now())
+	return a, nil
+}
+
+// Delete removes the registered alert with the given ID so that the
+// monitoring loop no longer evaluates it.
+func (s *AlertService) Delete(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "AlertService.Delete")
+	defer span.End()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(id)
+	if i < 0 {
+		return ErrAlertNotFound
+	}
+	if s.Repo != nil {
+		if err := s.Repo.Delete(ctx, id); err != nil {
+			return err
+		}
+	}
+	s.registered = append(s.registered[:i:i], s.registered[i+1:]...)
+	s.forget(ctx, id, time.Now())
+	return nil
+}
+
+// indexOf returns the position of the alert in s.registered or -1. The
+// caller must hold s.mu.
+func (s *AlertService) indexOf(id string) int {
+	for i, a := range s.registered {
+		if a.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// alerting reports whether a device status should fire its alerts.
+func alerting(status string) bool {
+	return status == "down" || status == "offline" || status == StatusUnknown
+}
+
+// ActiveAlerts returns all device alerts whose device is down, offline or has
+// stopped reporting, and all threshold rules that are currently firing.
+func (s *AlertService) ActiveAlerts(ctx context.Context) ([]domain.Alert, error) {
+	ctx, span := startSpan(ctx, "AlertService.ActiveAlerts")
+	defer span.End()
 	if s.DeviceRepo == nil {
 		return nil, nil
 	}
-	devices, err := s.DeviceRepo.List(false)
+	devices, err := s.DeviceRepo.List(ctx, false)
 	if err != nil {
 		return nil, err
 	}
+	markStaleDevices(devices, s.HeartbeatTimeout)
 	status := map[string]string{}
 	for _, d := range devices {
 		status[d.ID] = d.Status
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	var actives []domain.Alert
 	for _, a := range s.registered {
-		if st, ok := status[a.Device]; ok && (st == "down" || st == "offline") {
+		if a.Metric != "" {
+			if a.LastActivated != nil {
+				actives = append(actives, a)
+			}
+			continue
+		}
+		if st, ok := status[a.Device]; ok && alerting(st) {
 			actives = append(actives, a)
 		}
 	}
@@ -109,57 +264,91 @@ func (s *AlertService) StartMonitoring(ctx context.Context, interval time.Durati
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				s.scan()
+				s.scan(ctx)
 			}
 		}
 	}()
 }
 
-func (s *AlertService) scan() {
-	devices, err := s.DeviceRepo.List(true)
+func (s *AlertService) scan(ctx context.Context) {
+	devices, err := s.DeviceRepo.List(ctx, true)
 	if err != nil {
 		return
 	}
+	markStaleDevices(devices, s.HeartbeatTimeout)
 	status := make(map[string]string)
 	for _, d := range devices {
 		status[d.ID] = d.Status
 	}
+	metrics := s.snapshotMetrics(ctx, devices)
+	now := time.Now()
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = map[string]time.Time{}
+	}
+	if s.policies == nil {
+		s.policies = parseEscalations(nil)
+	}
 	for i, a := range s.registered {
+		if a.Metric != "" {
+			s.registered[i] = s.evaluateRule(ctx, a, metrics, now)
+			continue
+		}
 		st, ok := status[a.Device]
 		if !ok {
 			continue
 		}
-		if st == "down" || st == "offline" {
-			if a.LastActivated == "" {
-				logger.Log.Infof("device %s is down", a.Device)
-				_ = s.sendEmail(a.Email, "Device down", fmt.Sprintf("device %s is down", a.Device))
-				a.LastActivated = time.Now().Format(time.RFC3339)
+		if alerting(st) {
+			if a.LastActivated == nil {
+				subject, body := "Device down", fmt.Sprintf("device %s is down", a.Device)
+				if st == StatusUnknown {
+					subject, body = "Device not reporting", fmt.Sprintf("device %s stopped reporting", a.Device)
+				}
+				s.fire(ctx, a, subject, body, now)
+				a.LastActivated = &now
 				s.registered[i] = a
 			}
 		} else {
-			if a.LastActivated != "" {
-				a.LastActivated = ""
+			s.resolve(ctx, a, now)
+			if a.LastActivated != nil {
+				a.LastActivated = nil
 				s.registered[i] = a
 			}
 		}
 	}
+	s.escalate(ctx, now)
 }
 
-func (s *AlertService) sendEmail(to, subject, body string) error {
-	if !s.emailEnabled {
-		return nil
+// evaluateRule checks a threshold rule against the current metrics and fires
+// it once its condition has held for the rule's duration. The caller must
+// hold s.mu.
+func (s *AlertService) evaluateRule(ctx context.Context, a domain.Alert, metrics metricSnapshot, now time.Time) domain.Alert {
+	value, ok := metrics.value(a)
+	holds := false
+	if ok {
+		holds, _ = compare(a.Operator, value, a.Threshold)
+	}
+	if !holds {
+		delete(s.pending, a.ID)
+		s.resolve(ctx, a, now)
+		a.LastActivated = nil
+		return a
+	}
+	since, ok := s.pending[a.ID]
+	if !ok {
+		since = now
+		s.pending[a.ID] = since
 	}
-	if s.smtpHost == "" || s.smtpPort == "" || s.smtpFrom == "" {
-		return fmt.Errorf("smtp not configured")
+	if a.LastActivated != nil || now.Sub(since) < ruleDuration(a) {
+		return a
 	}
-	addr := s.smtpHost + ":" + s.smtpPort
-	msg := []byte("To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"\r\n" + body + "\r\n")
-	var auth smtp.Auth
-	if s.smtpUser != "" || s.smtpPass != "" {
-		auth = smtp.PlainAuth("", s.smtpUser, s.smtpPass, s.smtpHost)
+	body := fmt.Sprintf("%s of %s is %g (%s %g)", a.Metric, a.Target, value, a.Operator, a.Threshold)
+	if a.Duration != "" {
+		body += " for " + a.Duration
 	}
-	return smtp.SendMail(addr, auth, s.smtpFrom, []string{to}, msg)
+	s.fire(ctx, a, "Threshold alert", body, now)
+	a.LastActivated = &now
+	return a
 }
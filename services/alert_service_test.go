@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository/inmemory"
+)
+
+func newAlertService(t *testing.T) (*AlertService, *NodeService) {
+	t.Helper()
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	nodeRepo := inmemory.NewNodeRepo()
+	deviceRepo := inmemory.NewDeviceRepo(nodeRepo)
+	alerts := &AlertService{
+		Repo:       inmemory.NewAlertRepo(),
+		DeviceRepo: deviceRepo,
+		NodeRepo:   nodeRepo,
+		AppRepo:    inmemory.NewAppRepo(),
+		Incidents:  inmemory.NewIncidentRepo(),
+	}
+	return alerts, &NodeService{Repo: nodeRepo, DeviceRepo: deviceRepo}
+}
+
+func TestThresholdRules(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+
+	rules := []domain.Alert{
+		{ID: "rate", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100},
+		{ID: "keys", Level: "high", Metric: MetricNodeStoredKeyCount, Target: "precis", Operator: "<=", Threshold: 5},
+		{ID: "slow", Level: "low", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100, Duration: "1h"},
+		{ID: "ok", Level: "low", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: ">", Threshold: 100},
+	}
+	for _, r := range rules {
+		if err := alerts.Register(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", StoredKeyCount: 3, CurrentKeyRate: 50}}); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts.scan(ctx)
+	active, err := alerts.ActiveAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired := map[string]bool{}
+	for _, a := range active {
+		fired[a.ID] = true
+	}
+	if !fired["rate"] || !fired["keys"] {
+		t.Fatalf("expected rate and keys rules to fire, got %+v", active)
+	}
+	if fired["slow"] {
+		t.Fatalf("rule with a pending duration must not fire yet")
+	}
+	if fired["ok"] {
+		t.Fatalf("rule whose condition does not hold must not fire")
+	}
+
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", StoredKeyCount: 50, CurrentKeyRate: 500}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	active, _ = alerts.ActiveAlerts(ctx)
+	for _, a := range active {
+		if a.ID == "rate" || a.ID == "keys" {
+			t.Fatalf("expected rule %s to clear", a.ID)
+		}
+	}
+}
+
+func TestDeviceKeyRateRulesUseDeviceReports(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+
+	for _, r := range []domain.Alert{
+		{ID: "sibling", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100},
+		{ID: "low", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisB", Operator: "<", Threshold: 100},
+		{ID: "high", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisB", Operator: ">", Threshold: 100},
+	} {
+		if err := alerts.Register(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The node reports a low rate, but only precisB reports on its own.
+	err := nodes.Update(ctx, []domain.Node{
+		{Name: "precis", Status: "up", CurrentKeyRate: 50},
+		{Name: "precisB", Status: "up", CurrentKeyRate: 500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	active, err := alerts.ActiveAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != "high" {
+		t.Fatalf("expected only the rule on precisB's own rate to fire, got %+v", active)
+	}
+}
+
+func TestRegisterRejectsInvalidRules(t *testing.T) {
+	alerts, _ := newAlertService(t)
+
+	for _, a := range []domain.Alert{
+		{Level: "high", Metric: "temperature", Target: "precisA", Operator: "<"},
+		{Level: "high", Metric: MetricDeviceKeyRate, Operator: "<"},
+		{Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "~"},
+		{Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Duration: "soon"},
+		{Device: "precisA"},
+		{Device: "precisA", Level: "critical"},
+	} {
+		if err := alerts.Register(context.Background(), a); !errors.Is(err, ErrInvalidAlert) {
+			t.Fatalf("expected ErrInvalidAlert for %+v, got %v", a, err)
+		}
+	}
+
+	if err := alerts.Register(context.Background(), domain.Alert{ID: "down", Device: "precisA", Level: "low"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []string{"", "critical"} {
+		if _, err := alerts.Update(context.Background(), "down", domain.Alert{Device: "precisA", Level: level}); !errors.Is(err, ErrInvalidAlert) {
+			t.Fatalf("expected ErrInvalidAlert updating to level %q, got %v", level, err)
+		}
+	}
+}
+
+func TestIncidentLifecycle(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+	if err := alerts.Register(ctx, domain.Alert{ID: "rate", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := alerts.Register(ctx, domain.Alert{ID: "keys", Level: "low", Metric: MetricNodeStoredKeyCount, Target: "precis", Operator: "<", Threshold: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alerts.Silence(ctx, domain.Silence{Device: "precis", Until: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alerts.Acknowledge(ctx, "rate", "ops@example.com"); !errors.Is(err, ErrIncidentNotFound) {
+		t.Fatalf("expected ErrIncidentNotFound before firing, got %v", err)
+	}
+
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", StoredKeyCount: 3, CurrentKeyRate: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	alerts.scan(ctx)
+
+	inc, err := alerts.Acknowledge(ctx, "rate", "ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inc.State != domain.IncidentAcknowledged || inc.AcknowledgedBy != "ops@example.com" || inc.AcknowledgedAt == nil {
+		t.Fatalf("unexpected acknowledged incident %+v", inc)
+	}
+
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", StoredKeyCount: 50, CurrentKeyRate: 500}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+
+	all, err := alerts.History(ctx, domain.IncidentFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected one incident per alert, got %+v", all)
+	}
+	for _, i := range all {
+		if i.State != domain.IncidentResolved || i.ResolvedAt == nil {
+			t.Fatalf("expected incident to be resolved, got %+v", i)
+		}
+		if i.Silenced != (i.AlertID == "keys") {
+			t.Fatalf("expected only the keys incident to be silenced, got %+v", i)
+		}
+	}
+
+	high, _ := alerts.History(ctx, domain.IncidentFilter{Level: "high", Device: "precisA"})
+	if len(high) != 1 || high[0].AlertID != "rate" || high[0].AcknowledgedBy != "ops@example.com" {
+		t.Fatalf("unexpected filtered history %+v", high)
+	}
+	future, _ := alerts.History(ctx, domain.IncidentFilter{Start: time.Now().Add(time.Hour)})
+	if len(future) != 0 {
+		t.Fatalf("expected no incidents after the range start, got %+v", future)
+	}
+}
+
+func TestUpdateAndDeleteKeepRegisteredInSync(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+	if err := alerts.Register(ctx, domain.Alert{ID: "rate", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", CurrentKeyRate: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+
+	if _, err := alerts.Update(ctx, "rate", domain.Alert{Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 10}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	if active, _ := alerts.ActiveAlerts(ctx); len(active) != 0 {
+		t.Fatalf("expected the updated rule not to fire, got %+v", active)
+	}
+	stored, _ := alerts.Repo.List(ctx)
+	var found bool
+	for _, a := range stored.Alerts {
+		found = found || (a.ID == "rate" && a.Threshold == 10)
+	}
+	if !found {
+		t.Fatalf("expected the repository to hold the updated rule, got %+v", stored.Alerts)
+	}
+
+	if err := alerts.Delete(ctx, "rate"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alerts.Delete(ctx, "rate"); !errors.Is(err, ErrAlertNotFound) {
+		t.Fatalf("expected ErrAlertNotFound, got %v", err)
+	}
+	if _, err := alerts.Update(ctx, "rate", domain.Alert{Device: "precisA", Level: "low"}); !errors.Is(err, ErrAlertNotFound) {
+		t.Fatalf("expected ErrAlertNotFound, got %v", err)
+	}
+	for _, a := range alerts.registered {
+		if a.ID == "rate" {
+			t.Fatal("deleted alert is still monitored")
+		}
+	}
+}
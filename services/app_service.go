@@ -1,6 +1,9 @@
 package services
 
 import (
+	"context"
+	"sort"
+	"sync"
 	"time"
 
 	"mondash-backend/domain"
@@ -10,31 +13,109 @@ import (
 // AppService contains business logic for apps.
 type AppService struct {
 	Repo repository.AppRepository
+	// Events receives consumption updates. It is optional.
+	Events *EventHub
+	// Rollups aggregates key consumption for timelines. Without it timelines
+	// are read from the repository.
+	Rollups *RollupService
+
+	mu       sync.Mutex
+	consumed map[string]int64
 }
 
 // Update updates an app using the repository.
-func (s *AppService) Update(a *domain.App) error {
+func (s *AppService) Update(ctx context.Context, a *domain.App) error {
+	ctx, span := startSpan(ctx, "AppService.Update")
+	defer span.End()
 	if s.Repo == nil {
 		return nil
 	}
-	if a.Timestamp == "" {
-		a.Timestamp = time.Now().Format(time.RFC3339)
+	if a.Timestamp.IsZero() {
+		a.Timestamp = time.Now().UTC()
+	}
+	if err := s.Repo.Update(ctx, a); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.consumed == nil {
+		s.consumed = map[string]int64{}
 	}
-	return s.Repo.Update(a)
+	s.consumed[a.Name] += int64(a.KeysConsumed())
+	s.mu.Unlock()
+	s.Rollups.Record(ctx, domain.SeriesAppConsumption, a.Name, a.Timestamp, float64(a.KeysConsumed()))
+	s.Events.Publish(domain.Event{Type: domain.EventAppConsumption, Node: a.NodeID, App: a.Name, Data: a})
+	return nil
 }
 
 // List returns apps from the repository.
-func (s *AppService) List() ([]domain.AppData, error) {
+func (s *AppService) List(ctx context.Context) ([]domain.AppData, error) {
+	ctx, span := startSpan(ctx, "AppService.List")
+	defer span.End()
 	if s.Repo == nil {
 		return nil, nil
 	}
-	return s.Repo.List()
+	return s.Repo.List(ctx)
 }
 
 // Timeline returns key consumption history for all apps within a time range.
-func (s *AppService) Timeline(start, end string) ([]domain.AppData, error) {
+// With rollups, each entry counts the keys consumed during one step, picked
+// as described by RollupService.Timeline; apps without consumption in the
+// range are left out.
+func (s *AppService) Timeline(ctx context.Context, start, end time.Time, step time.Duration) ([]domain.AppData, error) {
+	ctx, span := startSpan(ctx, "AppService.Timeline")
+	defer span.End()
 	if s.Repo == nil {
 		return nil, nil
 	}
-	return s.Repo.Timeline(start, end)
+	if s.Rollups == nil {
+		return s.Repo.Timeline(ctx, start, end)
+	}
+	series, err := s.Rollups.Timeline(ctx, domain.SeriesAppConsumption, nil, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := s.Repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]domain.AppData, len(apps))
+	for _, a := range apps {
+		known[a.Name] = a
+	}
+	names := make([]string, 0, len(series.Data))
+	for name := range series.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]domain.AppData, 0, len(names))
+	for _, name := range names {
+		history := make([]domain.KeyConsumptionEntry, 0, len(series.Data[name]))
+		for _, p := range series.Data[name] {
+			history = append(history, domain.KeyConsumptionEntry{Timestamp: p.Timestamp, Count: int(p.Sum)})
+		}
+		app := domain.AppData{
+			Name:                  name,
+			Nodes:                 known[name].Nodes,
+			KeyConsumptionHistory: history,
+			ErrorHistory:          []string{},
+			KeySize:               known[name].KeySize,
+		}
+		if app.Nodes == nil {
+			app.Nodes = []string{}
+		}
+		result = append(result, app)
+	}
+	return result, nil
+}
+
+// Consumed returns the number of keys each app reported consuming since the
+// service started.
+func (s *AppService) Consumed() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string]int64, len(s.consumed))
+	for k, v := range s.consumed {
+		res[k] = v
+	}
+	return res
 }
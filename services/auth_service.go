@@ -1,24 +1,166 @@
 package services
 
-import "mondash-backend/repository"
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/password"
+	"mondash-backend/repository"
+)
+
+const defaultSessionTTL = 24 * time.Hour
 
 // AuthService contains authentication business logic.
 type AuthService struct {
-	Repo repository.AuthRepository
+	Repo     repository.AuthRepository
+	Sessions repository.SessionRepository
+
+	sessionTTL time.Duration
 }
 
-// Login delegates to the repository.
-func (s *AuthService) Login(username, password string) (string, error) {
-	if s.Repo == nil {
-		return "", nil
+// InitFromEnv loads the session lifetime from SESSION_TTL (a Go duration such
+// as "8h"). It defaults to 24 hours.
+func (s *AuthService) InitFromEnv() {
+	s.sessionTTL = defaultSessionTTL
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logger.Log.Warnw("invalid SESSION_TTL, using default", "value", v)
+			return
+		}
+		s.sessionTTL = d
 	}
-	return s.Repo.Login(username, password)
 }
 
-// Register delegates to the repository.
-func (s *AuthService) Register(username, email, password, role string) error {
+// Login checks the credentials and opens a new session for the user. It
+// returns the session token and its expiry.
+func (s *AuthService) Login(ctx context.Context, username, plain string) (string, time.Time, error) {
+	ctx, span := startSpan(ctx, "AuthService.Login")
+	defer span.End()
+	if s.Repo == nil || s.Sessions == nil {
+		return "", time.Time{}, errors.New("authentication unavailable")
+	}
+	if username == "" || plain == "" {
+		return "", time.Time{}, errors.New("missing credentials")
+	}
+	user, stored, err := s.Repo.Credentials(ctx, username)
+	if err != nil {
+		return "", time.Time{}, errors.New("invalid credentials")
+	}
+	ok, upgrade := password.Verify(stored, plain)
+	if !ok {
+		return "", time.Time{}, errors.New("invalid credentials")
+	}
+	if upgrade {
+		s.upgradePassword(ctx, username, plain)
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	ttl := s.sessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	now := time.Now()
+	session := domain.Session{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.Sessions.Create(ctx, session); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// ErrInvalidSession is returned by Authenticate for unknown or expired
+// sessions. Other errors come from the storage.
+var ErrInvalidSession = errors.New("invalid session")
+
+// Authenticate resolves a session token to the user that owns it.
+func (s *AuthService) Authenticate(ctx context.Context, token string) (domain.User, error) {
+	ctx, span := startSpan(ctx, "AuthService.Authenticate")
+	defer span.End()
+	if s.Repo == nil || s.Sessions == nil || token == "" {
+		return domain.User{}, ErrInvalidSession
+	}
+	session, err := s.Sessions.Get(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNoSession) {
+		return domain.User{}, ErrInvalidSession
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	user, err := s.Repo.UserByID(ctx, session.UserID)
+	if errors.Is(err, repository.ErrNoUser) {
+		return domain.User{}, ErrInvalidSession
+	}
+	return user, err
+}
+
+// Logout ends the session identified by the token.
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	ctx, span := startSpan(ctx, "AuthService.Logout")
+	defer span.End()
+	if s.Sessions == nil {
+		return nil
+	}
+	return s.Sessions.Delete(ctx, hashToken(token))
+}
+
+// Register hashes the password and stores the new account.
+func (s *AuthService) Register(ctx context.Context, username, email, plain, role, affiliation string) error {
+	ctx, span := startSpan(ctx, "AuthService.Register")
+	defer span.End()
 	if s.Repo == nil {
 		return nil
 	}
-	return s.Repo.Register(username, email, password, role)
+	if plain == "" {
+		return errors.New("invalid registration")
+	}
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+	return s.Repo.Register(ctx, username, email, hash, role, affiliation)
+}
+
+// upgradePassword replaces a legacy plaintext password with its hash. A
+// failure is logged but does not fail the login; the upgrade is retried on
+// the next one.
+func (s *AuthService) upgradePassword(ctx context.Context, username, plain string) {
+	hash, err := password.Hash(plain)
+	if err == nil {
+		err = s.Repo.SetPassword(ctx, username, hash)
+	}
+	if err != nil {
+		logger.Log.Warnw("failed to upgrade plaintext password", "username", username, "error", err)
+		return
+	}
+	logger.Log.Infow("upgraded plaintext password to hash", "username", username)
+}
+
+// newToken returns a random 256-bit token encoded as hex.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 digest of a token. Tokens are random, so a
+// plain digest is enough to keep them out of the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/password"
+	"mondash-backend/repository/inmemory"
+)
+
+func newAuthService(t *testing.T) (*AuthService, *inmemory.AuthRepo) {
+	t.Helper()
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	repo := inmemory.NewAuthRepo()
+	s := &AuthService{Repo: repo, Sessions: inmemory.NewSessionRepo()}
+	s.InitFromEnv()
+	return s, repo
+}
+
+func TestSeededAdminIsHashed(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newAuthService(t)
+
+	_, stored, err := repo.Credentials(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !password.IsHash(stored) {
+		t.Fatalf("expected seeded admin password to be hashed, got %q", stored)
+	}
+	if _, _, err := s.Login(ctx, "admin", "admin"); err != nil {
+		t.Fatalf("expected admin login to succeed: %v", err)
+	}
+}
+
+func TestRegisterStoresHash(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newAuthService(t)
+
+	if err := s.Register(ctx, "alice", "alice@example.com", "secret", "technician", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, stored, err := repo.Credentials(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == "secret" || !password.IsHash(stored) {
+		t.Fatalf("expected hashed password, got %q", stored)
+	}
+	if _, _, err := s.Login(ctx, "alice", "wrong"); err == nil {
+		t.Fatalf("expected wrong password to be rejected")
+	}
+	if _, _, err := s.Login(ctx, "alice", "secret"); err != nil {
+		t.Fatalf("expected login to succeed: %v", err)
+	}
+}
+
+func TestLoginUpgradesPlaintextPassword(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newAuthService(t)
+
+	// simulate a document written before passwords were hashed
+	if err := repo.SetPassword(ctx, "admin", "legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Login(ctx, "admin", "wrong"); err == nil {
+		t.Fatalf("expected wrong password to be rejected")
+	}
+	if _, stored, _ := repo.Credentials(ctx, "admin"); stored != "legacy" {
+		t.Fatalf("failed login must not upgrade the password")
+	}
+	if _, _, err := s.Login(ctx, "admin", "legacy"); err != nil {
+		t.Fatalf("expected legacy login to succeed: %v", err)
+	}
+	_, stored, _ := repo.Credentials(ctx, "admin")
+	if !password.IsHash(stored) {
+		t.Fatalf("expected password to be upgraded to a hash, got %q", stored)
+	}
+	if _, _, err := s.Login(ctx, "admin", "legacy"); err != nil {
+		t.Fatalf("expected login with upgraded hash to succeed: %v", err)
+	}
+}
+
+// unreachableSessions fails every lookup as a storage outage would.
+type unreachableSessions struct {
+	*inmemory.SessionRepo
+}
+
+func (unreachableSessions) Get(context.Context, string) (domain.Session, error) {
+	return domain.Session{}, context.DeadlineExceeded
+}
+
+func TestAuthenticateSeparatesStorageErrors(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newAuthService(t)
+
+	if _, err := s.Authenticate(ctx, "unknown"); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("expected an unknown token to be invalid, got %v", err)
+	}
+	token, _, err := s.Login(ctx, "admin", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Sessions = unreachableSessions{}
+	_, err = s.Authenticate(ctx, token)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("expected the storage error, got %v", err)
+	}
+}
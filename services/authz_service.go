@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+)
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, u domain.User) context.Context {
+	return context.WithValue(ctx, userKey{}, u)
+}
+
+// UserFromContext returns the authenticated user stored by WithUser.
+func UserFromContext(ctx context.Context) (domain.User, bool) {
+	u, ok := ctx.Value(userKey{}).(domain.User)
+	return u, ok
+}
+
+// AuthzService decides what a user may access based on the role definitions
+// from roles.yaml and the network configuration.
+type AuthzService struct {
+	Roles   config.Roles
+	Network *Network
+
+	mu sync.RWMutex
+}
+
+// SetRoles replaces the role definitions, for instance when roles.yaml is
+// reloaded.
+func (s *AuthzService) SetRoles(r config.Roles) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Roles = r
+}
+
+func (s *AuthzService) roles() config.Roles {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Roles
+}
+
+// Allowed reports whether the user's role grants at least one of perms.
+func (s *AuthzService) Allowed(u domain.User, perms ...string) bool {
+	roles := s.roles()
+	for _, p := range perms {
+		if roles.Has(u.Role, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeScope returns the IDs of the nodes whose data the user may see for a
+// resource guarded by the unscoped permission `all` (view_nodes or
+// view_devices). A nil result means the user is not restricted. Scoped
+// permissions narrow the result to the nodes tied to the user's affiliation:
+// the affiliated node itself for view_specific_node and view_node_devices, and
+// the nodes serving the affiliated application for view_associated_devices.
+func (s *AuthzService) NodeScope(u domain.User, all string) map[string]struct{} {
+	roles := s.roles()
+	if roles.Has(u.Role, all) {
+		return nil
+	}
+	scope := map[string]struct{}{}
+	affiliation := strings.ToLower(u.Affiliation)
+	if affiliation == "" {
+		return scope
+	}
+	switch all {
+	case config.PermViewNodes:
+		if roles.Has(u.Role, config.PermViewSpecificNode) {
+			scope[affiliation] = struct{}{}
+		}
+	case config.PermViewDevices:
+		if roles.Has(u.Role, config.PermViewNodeDevices) {
+			scope[affiliation] = struct{}{}
+		}
+		if roles.Has(u.Role, config.PermViewAssociatedDevices) {
+			for cons, nodes := range s.Network.Config().NodesByConsumer() {
+				if strings.ToLower(cons) != affiliation {
+					continue
+				}
+				for _, n := range nodes {
+					scope[strings.ToLower(n)] = struct{}{}
+				}
+			}
+		}
+	}
+	return scope
+}
+
+// InScope reports whether nodeID is visible within scope.
+func InScope(scope map[string]struct{}, nodeID string) bool {
+	if scope == nil {
+		return true
+	}
+	_, ok := scope[strings.ToLower(nodeID)]
+	return ok
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+const defaultConfigReloadInterval = 5 * time.Second
+
+// ConfigReloadIntervalFromEnv returns how often the configuration files are
+// checked for changes. It is read from CONFIG_RELOAD_INTERVAL (a Go duration)
+// and defaults to five seconds; "0" only reloads on SIGHUP.
+func ConfigReloadIntervalFromEnv() time.Duration {
+	v := os.Getenv("CONFIG_RELOAD_INTERVAL")
+	if v == "" {
+		return defaultConfigReloadInterval
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		logger.Log.Warnw("invalid CONFIG_RELOAD_INTERVAL, using default", "value", v)
+		return defaultConfigReloadInterval
+	}
+	return d
+}
+
+// configFiles is a version of the configuration and roles files.
+type configFiles struct {
+	config config.Config
+	roles  config.Roles
+}
+
+// fileStamp identifies a version of a file on disk.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// ConfigManager holds the current configuration and role definitions and
+// reloads them when their files change or on SIGHUP. A new version of a file
+// is only swapped in once it loads and validates; otherwise the previous one
+// is kept. Subscribers are notified of every swap.
+type ConfigManager struct {
+	ConfigPath string
+	RolesPath  string
+
+	current atomic.Pointer[configFiles]
+
+	// reloading serializes reloads, so that subscribers see the versions in
+	// order. It is held while they run, unlike mu.
+	reloading sync.Mutex
+
+	mu       sync.Mutex
+	onConfig []func(config.Config) error
+	onRoles  []func(config.Roles)
+	stamps   map[string]fileStamp
+}
+
+// NewConfigManager loads the configuration and roles files. Problems with the
+// configuration are reported at startup, so an unreadable file only gives an
+// empty configuration here, and unreadable roles the built-in defaults.
+func NewConfigManager(configPath, rolesPath string) *ConfigManager {
+	m := &ConfigManager{ConfigPath: configPath, RolesPath: rolesPath, stamps: map[string]fileStamp{}}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		logger.Log.Warnw("failed to load configuration", "file", configPath, "error", err)
+	}
+	roles, err := config.LoadRoles(rolesPath)
+	if err == nil {
+		err = roles.Validate()
+	}
+	if err != nil {
+		logger.Log.Warnw("failed to load roles, using built-in defaults", "file", rolesPath, "error", err)
+		roles = config.DefaultRoles()
+	}
+	m.current.Store(&configFiles{config: cfg, roles: roles})
+	m.changed()
+	return m
+}
+
+// Config returns the current configuration.
+func (m *ConfigManager) Config() config.Config {
+	return m.current.Load().config
+}
+
+// Roles returns the current role definitions.
+func (m *ConfigManager) Roles() config.Roles {
+	return m.current.Load().roles
+}
+
+// OnConfig registers fn to be called with every new configuration. Errors
+// are logged.
+func (m *ConfigManager) OnConfig(fn func(config.Config) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onConfig = append(m.onConfig, fn)
+}
+
+// OnRoles registers fn to be called with every new set of role definitions.
+func (m *ConfigManager) OnRoles(fn func(config.Roles)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onRoles = append(m.onRoles, fn)
+}
+
+// Watch reloads the files when they change on disk, as checked every
+// interval, and whenever the process receives SIGHUP, until ctx is done. A
+// zero interval only reloads on SIGHUP.
+func (m *ConfigManager) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	go func() {
+		defer signal.Stop(hup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				logger.Log.Info("received SIGHUP, reloading configuration")
+				m.changed()
+				_ = m.Reload()
+			case <-tick:
+				if m.changed() {
+					_ = m.Reload()
+				}
+			}
+		}
+	}()
+}
+
+// changed records the current version of both files and reports whether
+// either differs from the last one seen.
+func (m *ConfigManager) changed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for _, path := range []string{m.ConfigPath, m.RolesPath} {
+		var stamp fileStamp
+		if info, err := os.Stat(path); err == nil {
+			stamp = fileStamp{mod: info.ModTime(), size: info.Size()}
+		}
+		if prev, ok := m.stamps[path]; !ok || prev != stamp {
+			changed = true
+		}
+		m.stamps[path] = stamp
+	}
+	return changed
+}
+
+// Reload reads both files and swaps in those that load, validate and differ
+// from the current version, logging a summary of the changes and notifying
+// the subscribers. It returns the problems of the rejected files.
+func (m *ConfigManager) Reload() error {
+	m.reloading.Lock()
+	defer m.reloading.Unlock()
+	m.mu.Lock()
+	onConfig := append([]func(config.Config) error{}, m.onConfig...)
+	onRoles := append([]func(config.Roles){}, m.onRoles...)
+	m.mu.Unlock()
+
+	cur := m.current.Load()
+	next := *cur
+	var errs []error
+
+	cfg, err := config.Load(m.ConfigPath)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		logger.Log.Errorw("rejected configuration, keeping the previous version", "file", m.ConfigPath, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", m.ConfigPath, err))
+	} else {
+		next.config = cfg
+	}
+
+	roles, err := config.LoadRoles(m.RolesPath)
+	if err == nil {
+		err = roles.Validate()
+	}
+	if err != nil {
+		logger.Log.Errorw("rejected roles, keeping the previous version", "file", m.RolesPath, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", m.RolesPath, err))
+	} else {
+		next.roles = roles
+	}
+
+	configChanged := !reflect.DeepEqual(cur.config, next.config)
+	rolesChanged := !reflect.DeepEqual(cur.roles, next.roles)
+	if configChanged || rolesChanged {
+		m.current.Store(&next)
+	}
+	if configChanged {
+		logger.Log.Infow("reloaded configuration", "file", m.ConfigPath, "changes", diffConfig(cur.config, next.config))
+		for _, fn := range onConfig {
+			if err := fn(next.config); err != nil {
+				logger.Log.Errorw("failed to apply configuration", "file", m.ConfigPath, "error", err)
+			}
+		}
+	}
+	if rolesChanged {
+		logger.Log.Infow("reloaded roles", "file", m.RolesPath, "changes", diffRoles(cur.roles, next.roles))
+		for _, fn := range onRoles {
+			fn(next.roles)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// diffConfig summarises the differences between two configurations as
+// "+kind name" for additions, "-kind name" for removals and "~kind name" for
+// modifications.
+func diffConfig(prev, next config.Config) []string {
+	return diffTopology(repository.TopologyFromConfig(prev), repository.TopologyFromConfig(next))
+}
+
+// diffTopology summarises the differences between two topologies like
+// diffConfig.
+func diffTopology(prev, next domain.Topology) []string {
+	a, b := topologyKeys(prev), topologyKeys(next)
+	var changes []string
+	for _, kind := range []string{"node", "device", "link", "consumer", "path", "setting"} {
+		changes = append(changes, diffKeys(kind, a[kind], b[kind])...)
+	}
+	return changes
+}
+
+// topologyKeys describes the elements of a topology by kind and name so that
+// two versions can be compared.
+func topologyKeys(t domain.Topology) map[string]map[string]string {
+	m := map[string]map[string]string{
+		"node": {}, "device": {}, "link": {}, "consumer": {}, "path": {}, "setting": {},
+	}
+	for _, n := range t.Nodes {
+		m["node"][n.Name] = fmt.Sprint(n.Coordinates, n.KME, n.Type)
+	}
+	for _, d := range t.Devices {
+		m["device"][d.ID] = d.Node + " " + d.URL
+	}
+	for _, l := range t.Links {
+		m["link"][l.From+"-"+l.To] = l.Length
+	}
+	for _, c := range t.Consumers {
+		m["consumer"][c] = ""
+	}
+	for _, p := range t.Paths {
+		m["path"][p.Device+"/"+p.Consumer] = fmt.Sprint(p.Routes)
+	}
+	for k, v := range t.Settings {
+		m["setting"][k] = fmt.Sprint(v)
+	}
+	return m
+}
+
+// withoutSettings returns the network of a topology, leaving out its other
+// settings.
+func withoutSettings(t domain.Topology) domain.Topology {
+	t.Settings = nil
+	return t
+}
+
+// diffRoles summarises the roles added, removed or granted other
+// permissions.
+func diffRoles(prev, next config.Roles) []string {
+	a, b := map[string]string{}, map[string]string{}
+	for name, perms := range prev.Roles {
+		a[name] = fmt.Sprint(perms)
+	}
+	for name, perms := range next.Roles {
+		b[name] = fmt.Sprint(perms)
+	}
+	return diffKeys("role", a, b)
+}
+
+func diffKeys(kind string, prev, next map[string]string) []string {
+	var changes []string
+	for k, v := range next {
+		old, ok := prev[k]
+		switch {
+		case !ok:
+			changes = append(changes, "+"+kind+" "+k)
+		case old != v:
+			changes = append(changes, "~"+kind+" "+k)
+		}
+	}
+	for k := range prev {
+		if _, ok := next[k]; !ok {
+			changes = append(changes, "-"+kind+" "+k)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
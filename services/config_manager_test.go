@@ -0,0 +1,75 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mondash-backend/config"
+	"mondash-backend/logger"
+)
+
+func TestConfigManagerReload(t *testing.T) {
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	dir := t.TempDir()
+	shipped, err := os.ReadFile("../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgPath, rolesPath := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "roles.yaml")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(cfgPath, string(shipped))
+	write(rolesPath, "roles:\n  admin: [\"*\"]\n")
+
+	m := NewConfigManager(cfgPath, rolesPath)
+	var configs []config.Config
+	var roles []config.Roles
+	m.OnConfig(func(c config.Config) error {
+		configs = append(configs, c)
+		return nil
+	})
+	m.OnRoles(func(r config.Roles) {
+		roles = append(roles, r)
+		// Subscribers may register others without deadlocking.
+		m.OnRoles(func(config.Roles) {})
+	})
+
+	// Unchanged files notify nobody.
+	if err := m.Reload(); err != nil || len(configs) != 0 || len(roles) != 0 {
+		t.Fatalf("expected no notification, got %v, %d configs, %d roles", err, len(configs), len(roles))
+	}
+
+	write(rolesPath, "roles:\n  admin: [\"*\"]\n  technician: [view_nodes]\n")
+	write(cfgPath, strings.Replace(string(shipped), "[campus, precisA, 14000]", "[campus, precisA, 15000]", 1))
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Links[0][2] != "15000" || m.Config().Links[0][2] != "15000" {
+		t.Fatalf("expected the new configuration, got %+v", configs)
+	}
+	if len(roles) != 1 || !m.Roles().Has("technician", config.PermViewNodes) {
+		t.Fatalf("expected the new roles, got %+v", roles)
+	}
+	if got := diffConfig(config.Config{}, m.Config()); len(got) == 0 {
+		t.Fatal("expected a diff summary")
+	}
+
+	// Invalid versions are rejected and the previous ones kept.
+	write(cfgPath, strings.Replace(string(shipped), "[campus, precisA, 14000]", "[campus, precisC, 14000]", 1))
+	write(rolesPath, "roles:\n  admin: [\"*\"]\n  technician: [view_nodez]\n")
+	err = m.Reload()
+	if err == nil || !strings.Contains(err.Error(), "unknown device precisC") || !strings.Contains(err.Error(), `unknown permission "view_nodez"`) {
+		t.Fatalf("expected both files to be rejected, got %v", err)
+	}
+	if len(configs) != 1 || len(roles) != 1 || m.Config().Links[0][1] != "precisA" || !m.Roles().Has("technician", config.PermViewNodes) {
+		t.Fatal("expected the previous versions to be kept")
+	}
+}
@@ -1,33 +1,46 @@
 package services
 
-import "mondash-backend/domain"
-import "mondash-backend/repository"
+import (
+	"context"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
 
 // DeviceService contains business logic for devices.
 type DeviceService struct {
 	Repo repository.DeviceRepository
+	// HeartbeatTimeout is how long a device may go without reports before
+	// its status is shown as unknown. Zero disables stale detection.
+	HeartbeatTimeout time.Duration
 }
 
 // List returns devices from the repository.
-func (s *DeviceService) List() ([]domain.Device, error) {
+func (s *DeviceService) List(ctx context.Context) ([]domain.Device, error) {
+	ctx, span := startSpan(ctx, "DeviceService.List")
+	defer span.End()
 	if s.Repo == nil {
 		return []domain.Device{}, nil
 	}
-	devices, err := s.Repo.List(false)
+	devices, err := s.Repo.List(ctx, false)
 	if devices == nil && err == nil {
 		devices = []domain.Device{}
 	}
+	markStaleDevices(devices, s.HeartbeatTimeout)
 	return devices, err
 }
 
 // ListWithHistory returns devices and augments each with key rate history.
-func (s *DeviceService) ListWithHistory(limit int) ([]domain.Device, error) {
-	devices, err := s.List()
+func (s *DeviceService) ListWithHistory(ctx context.Context, limit int) ([]domain.Device, error) {
+	ctx, span := startSpan(ctx, "DeviceService.ListWithHistory")
+	defer span.End()
+	devices, err := s.List(ctx)
 	if err != nil || s.Repo == nil {
 		return devices, err
 	}
 	for i := range devices {
-		history, errHist := s.Repo.KeyRateHistory(devices[i].ID, limit)
+		history, errHist := s.Repo.KeyRateHistory(ctx, devices[i].ID, limit)
 		if errHist != nil {
 			devices[i].SelfReporting.KeyRateHistory = []domain.KeyRateEntry{}
 			continue
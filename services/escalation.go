@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/notifier"
+)
+
+// ErrInvalidEscalation is returned when escalation policies are malformed.
+var ErrInvalidEscalation = errors.New("invalid escalation policy")
+
+// DefaultEscalations are used when the alert configuration defines no
+// escalation policies: high incidents are repeated every 15 minutes until
+// acknowledged, medium ones every hour, and low ones are sent once.
+func DefaultEscalations() []domain.EscalationPolicy {
+	return []domain.EscalationPolicy{
+		{Level: "high", RepeatEvery: "15m", EscalateAfter: "30m"},
+		{Level: "medium", RepeatEvery: "1h"},
+		{Level: "low"},
+	}
+}
+
+// escalationPolicy is a parsed domain.EscalationPolicy.
+type escalationPolicy struct {
+	repeatEvery   time.Duration
+	escalateAfter time.Duration
+	contacts      []string
+}
+
+// parseEscalations indexes the policies by level. Invalid durations disable
+// the respective step and are logged.
+func parseEscalations(policies []domain.EscalationPolicy) map[string]escalationPolicy {
+	if len(policies) == 0 {
+		policies = DefaultEscalations()
+	}
+	res := map[string]escalationPolicy{}
+	for _, p := range policies {
+		res[p.Level] = escalationPolicy{
+			repeatEvery:   parsePolicyDuration(p.Level, "repeatEvery", p.RepeatEvery),
+			escalateAfter: parsePolicyDuration(p.Level, "escalateAfter", p.EscalateAfter),
+			contacts:      p.Contacts,
+		}
+	}
+	return res
+}
+
+func parsePolicyDuration(level, field, v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		logger.Log.Warnw("ignoring invalid escalation duration", "level", level, "field", field, "value", v)
+		return 0
+	}
+	return d
+}
+
+// Escalations returns the escalation policies in effect.
+func (s *AlertService) Escalations(ctx context.Context) []domain.EscalationPolicy {
+	ctx, span := startSpan(ctx, "AlertService.Escalations")
+	defer span.End()
+	if s.Repo != nil {
+		if res, err := s.Repo.List(ctx); err == nil && len(res.Escalations) > 0 {
+			return res.Escalations
+		}
+	}
+	return DefaultEscalations()
+}
+
+// SetEscalations validates and stores the escalation policies, which apply
+// to open incidents from the next scan on. Every level may have at most one
+// policy; an empty list restores DefaultEscalations. The policies in effect
+// are returned.
+func (s *AlertService) SetEscalations(ctx context.Context, policies []domain.EscalationPolicy) ([]domain.EscalationPolicy, error) {
+	ctx, span := startSpan(ctx, "AlertService.SetEscalations")
+	defer span.End()
+	levels, err := s.alertLevels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, p := range policies {
+		known := false
+		for _, l := range levels {
+			known = known || l == p.Level
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown level %q", ErrInvalidEscalation, p.Level)
+		}
+		if seen[p.Level] {
+			return nil, fmt.Errorf("%w: duplicate level %q", ErrInvalidEscalation, p.Level)
+		}
+		seen[p.Level] = true
+		for field, v := range map[string]string{"repeatEvery": p.RepeatEvery, "escalateAfter": p.EscalateAfter} {
+			if d, err := time.ParseDuration(v); v != "" && (err != nil || d < 0) {
+				return nil, fmt.Errorf("%w: invalid %s %q for level %s", ErrInvalidEscalation, field, v, p.Level)
+			}
+		}
+		for _, c := range p.Contacts {
+			if strings.TrimSpace(c) == "" {
+				return nil, fmt.Errorf("%w: empty contact for level %s", ErrInvalidEscalation, p.Level)
+			}
+		}
+	}
+	if s.Repo != nil {
+		if err := s.Repo.SetEscalations(ctx, policies); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	s.policies = parseEscalations(policies)
+	s.mu.Unlock()
+	if len(policies) == 0 {
+		return DefaultEscalations(), nil
+	}
+	return policies, nil
+}
+
+// escalate re-sends and escalates the open incidents that have not been
+// acknowledged, following the policy of their level. Incidents are skipped
+// while a silence covers them; one that fired silenced is notified once its
+// silence has expired or been lifted. The caller must hold s.mu.
+func (s *AlertService) escalate(ctx context.Context, now time.Time) {
+	if len(s.open) == 0 {
+		return
+	}
+	alerts := map[string]domain.Alert{}
+	for _, a := range s.registered {
+		alerts[a.ID] = a
+	}
+	silences := s.activeSilences(ctx)
+	for id, inc := range s.open {
+		a, ok := alerts[id]
+		if !ok || inc.State != domain.IncidentFiring || covered(silences, a, now) {
+			continue
+		}
+		p := s.policies[inc.Level]
+		changed := false
+		if inc.NotifiedAt == nil {
+			s.notify(a, inc.Subject, fmt.Sprintf("%s (firing for %s, silence ended)", inc.Message, since(inc.StartedAt, now)))
+			inc.NotifiedAt = &now
+			changed = true
+		}
+		if p.repeatEvery > 0 && inc.NotifiedAt != nil && now.Sub(*inc.NotifiedAt) >= p.repeatEvery {
+			s.notify(a, "Reminder: "+inc.Subject, fmt.Sprintf("%s (firing for %s, not acknowledged)", inc.Message, since(inc.StartedAt, now)))
+			inc.NotifiedAt = &now
+			changed = true
+		}
+		if p.escalateAfter > 0 && !inc.Escalated && now.Sub(inc.StartedAt) >= p.escalateAfter {
+			body := fmt.Sprintf("%s (firing for %s, not acknowledged)", inc.Message, since(inc.StartedAt, now))
+			s.notifyContacts(a, p.contacts, "Escalated: "+inc.Subject, body)
+			inc.Escalated = true
+			changed = true
+		}
+		if changed {
+			s.open[id] = inc
+			s.saveIncident(ctx, inc)
+		}
+	}
+}
+
+// notifyContacts emails each escalation contact about the alert.
+func (s *AlertService) notifyContacts(a domain.Alert, contacts []string, subject, body string) {
+	for _, c := range contacts {
+		to := a
+		to.Channel, to.Email = notifier.ChannelEmail, c
+		s.notify(to, subject, body)
+	}
+}
+
+// since formats how long ago t was, rounded to minutes once it exceeds one.
+func since(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/notifier"
+)
+
+type sent struct {
+	to      string
+	subject string
+	body    string
+}
+
+// recorder is a notifier that hands every message to a channel.
+type recorder chan sent
+
+func (r recorder) Notify(_ context.Context, to string, msg notifier.Message) error {
+	r <- sent{to: to, subject: msg.Subject, body: msg.Body}
+	return nil
+}
+
+// expect waits for n notifications and returns them sorted by recipient.
+func (r recorder) expect(t *testing.T, n int) []sent {
+	t.Helper()
+	var res []sent
+	for len(res) < n {
+		select {
+		case m := <-r:
+			res = append(res, m)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d notifications, got %+v", n, res)
+		}
+	}
+	select {
+	case m := <-r:
+		t.Fatalf("unexpected notification %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].to < res[j].to })
+	return res
+}
+
+func TestEscalationAndRecovery(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+	rec := make(recorder, 10)
+	alerts.Notifiers = map[string]notifier.Notifier{notifier.ChannelEmail: rec}
+	alerts.emailEnabled = true
+	alerts.maxAttempts = 1
+	alerts.policies = parseEscalations([]domain.EscalationPolicy{
+		{Level: "high", RepeatEvery: "1m", EscalateAfter: "2m", Contacts: []string{"oncall@example.com"}},
+	})
+	if err := alerts.Register(ctx, domain.Alert{ID: "rate", Level: "high", Email: "ops@example.com", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", CurrentKeyRate: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	if got := rec.expect(t, 1); got[0].to != "ops@example.com" || got[0].subject != "Threshold alert" {
+		t.Fatalf("unexpected notification %+v", got)
+	}
+	start := alerts.open["rate"].StartedAt
+
+	escalate := func(after time.Duration) {
+		alerts.mu.Lock()
+		alerts.escalate(ctx, start.Add(after))
+		alerts.mu.Unlock()
+	}
+	escalate(30 * time.Second)
+	rec.expect(t, 0)
+
+	escalate(90 * time.Second)
+	if got := rec.expect(t, 1); !strings.HasPrefix(got[0].subject, "Reminder:") {
+		t.Fatalf("expected a reminder, got %+v", got)
+	}
+
+	escalate(3 * time.Minute)
+	got := rec.expect(t, 2)
+	if got[0].to != "oncall@example.com" || !strings.HasPrefix(got[0].subject, "Escalated:") {
+		t.Fatalf("expected escalation to the contact list, got %+v", got)
+	}
+	if got[1].to != "ops@example.com" || !strings.HasPrefix(got[1].subject, "Reminder:") {
+		t.Fatalf("expected a second reminder, got %+v", got)
+	}
+
+	if _, err := alerts.Acknowledge(ctx, "rate", "ops@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	escalate(time.Hour)
+	rec.expect(t, 0)
+
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", CurrentKeyRate: 500}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	got = rec.expect(t, 2)
+	for _, m := range got {
+		if m.subject != "Threshold alert resolved" || !strings.Contains(m.body, "back to normal after") {
+			t.Fatalf("expected recovery notifications, got %+v", got)
+		}
+	}
+}
+
+func TestSetEscalations(t *testing.T) {
+	ctx := context.Background()
+	alerts, _ := newAlertService(t)
+
+	for _, policies := range [][]domain.EscalationPolicy{
+		{{Level: "urgent"}},
+		{{Level: "high"}, {Level: "high"}},
+		{{Level: "high", RepeatEvery: "soon"}},
+		{{Level: "high", Contacts: []string{" "}}},
+	} {
+		if _, err := alerts.SetEscalations(ctx, policies); !errors.Is(err, ErrInvalidEscalation) {
+			t.Fatalf("expected %+v to be rejected, got %v", policies, err)
+		}
+	}
+	policies := []domain.EscalationPolicy{{Level: "low", RepeatEvery: "10m", Contacts: []string{"oncall@example.com"}}}
+	if _, err := alerts.SetEscalations(ctx, policies); err != nil {
+		t.Fatal(err)
+	}
+	if got := alerts.Escalations(ctx); len(got) != 1 || got[0].Level != "low" {
+		t.Fatalf("expected the stored policies, got %+v", got)
+	}
+	if p := alerts.policies["low"]; p.repeatEvery != 10*time.Minute || len(p.contacts) != 1 {
+		t.Fatalf("expected the policies to apply, got %+v", alerts.policies)
+	}
+	if got, err := alerts.SetEscalations(ctx, nil); err != nil || len(got) != len(DefaultEscalations()) {
+		t.Fatalf("expected the defaults to be restored, got %+v, %v", got, err)
+	}
+}
+
+func TestNotifyAfterSilenceExpires(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+	rec := make(recorder, 10)
+	alerts.Notifiers = map[string]notifier.Notifier{notifier.ChannelEmail: rec}
+	alerts.emailEnabled = true
+	alerts.maxAttempts = 1
+	alerts.policies = parseEscalations([]domain.EscalationPolicy{{Level: "low"}})
+	if err := alerts.Register(ctx, domain.Alert{ID: "rate", Level: "low", Email: "ops@example.com", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100}); err != nil {
+		t.Fatal(err)
+	}
+	sl, err := alerts.Silence(ctx, domain.Silence{AlertID: "rate", Until: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nodes.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", CurrentKeyRate: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	rec.expect(t, 0)
+	if inc := alerts.open["rate"]; !inc.Silenced || inc.NotifiedAt != nil {
+		t.Fatalf("expected a silenced incident, got %+v", inc)
+	}
+
+	if err := alerts.Unsilence(ctx, sl.ID); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+	if got := rec.expect(t, 1); got[0].subject != "Threshold alert" || !strings.Contains(got[0].body, "silence ended") {
+		t.Fatalf("expected the incident to be notified, got %+v", got)
+	}
+	alerts.scan(ctx)
+	rec.expect(t, 0)
+}
+
+func TestSince(t *testing.T) {
+	now := time.Now()
+	for d, want := range map[time.Duration]string{
+		14*time.Minute + 10*time.Second: "14m",
+		90 * time.Minute:                "1h30m",
+		30 * time.Second:                "30s",
+	} {
+		if got := since(now.Add(-d), now); got != want {
+			t.Fatalf("since(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
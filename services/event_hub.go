@@ -0,0 +1,114 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+)
+
+// subscriberBuffer is the number of events queued per subscriber before new
+// events are dropped for it.
+const subscriberBuffer = 64
+
+// EventHub fans out events to stream subscribers. A nil hub discards
+// everything published to it.
+type EventHub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// NewEventHub returns an empty hub.
+func NewEventHub() *EventHub {
+	return &EventHub{subs: map[*Subscription]struct{}{}}
+}
+
+// EventFilter selects the events a subscriber receives. Types match an event
+// type or its prefix ("node" matches "node.status"). Nodes and Apps are
+// topics: when either is set, an event passes if it is about one of the
+// listed nodes or apps. Scope restricts node, device and alert events to the
+// nodes a user may see; app events are not scoped by node, access to them
+// follows the view_application permission. Nil or empty fields match
+// everything; names are lowercase.
+type EventFilter struct {
+	Types []string
+	Nodes map[string]struct{}
+	Apps  map[string]struct{}
+	Scope map[string]struct{}
+}
+
+// Matches reports whether the event passes the filter.
+func (f EventFilter) Matches(e domain.Event) bool {
+	if len(f.Types) > 0 {
+		ok := false
+		for _, t := range f.Types {
+			ok = ok || t == e.Type || strings.HasPrefix(e.Type, t+".")
+		}
+		if !ok {
+			return false
+		}
+	}
+	if e.App == "" && e.Node != "" && !InScope(f.Scope, e.Node) {
+		return false
+	}
+	if f.Nodes == nil && f.Apps == nil {
+		return true
+	}
+	if _, ok := f.Nodes[strings.ToLower(e.Node)]; ok && e.Node != "" {
+		return true
+	}
+	_, ok := f.Apps[strings.ToLower(e.App)]
+	return ok && e.App != ""
+}
+
+// Subscription receives the events matching its filter on C.
+type Subscription struct {
+	C      <-chan domain.Event
+	c      chan domain.Event
+	filter EventFilter
+}
+
+// Subscribe registers a subscriber. Call Unsubscribe once done.
+func (h *EventHub) Subscribe(f EventFilter) *Subscription {
+	c := make(chan domain.Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, filter: f}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes the subscriber and closes its channel.
+func (h *EventHub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Publish delivers the event to all matching subscribers without blocking.
+// Subscribers that fall behind miss events.
+func (h *EventHub) Publish(e domain.Event) {
+	if h == nil {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			logger.Log.Debugw("dropping event for slow subscriber", "type", e.Type)
+		}
+	}
+}
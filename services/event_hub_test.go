@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"mondash-backend/domain"
+)
+
+func TestEventFilter(t *testing.T) {
+	set := func(names ...string) map[string]struct{} {
+		res := map[string]struct{}{}
+		for _, n := range names {
+			res[n] = struct{}{}
+		}
+		return res
+	}
+	nodeStatus := domain.Event{Type: domain.EventNodeStatus, Node: "precis"}
+	appEvent := domain.Event{Type: domain.EventAppConsumption, Node: "lyon", App: "vpn"}
+
+	cases := []struct {
+		name   string
+		filter EventFilter
+		event  domain.Event
+		want   bool
+	}{
+		{"empty filter", EventFilter{}, nodeStatus, true},
+		{"type prefix", EventFilter{Types: []string{"node"}}, nodeStatus, true},
+		{"other type", EventFilter{Types: []string{"alert"}}, nodeStatus, false},
+		{"node topic", EventFilter{Nodes: set("precis")}, nodeStatus, true},
+		{"other node", EventFilter{Nodes: set("lyon")}, nodeStatus, false},
+		{"app topic", EventFilter{Nodes: set("precis"), Apps: set("vpn")}, appEvent, true},
+		{"out of scope", EventFilter{Scope: set("lyon")}, nodeStatus, false},
+		{"app outside node scope", EventFilter{Scope: set()}, appEvent, true},
+	}
+	for _, c := range cases {
+		if got := c.filter.Matches(c.event); got != c.want {
+			t.Errorf("%s: Matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNodeUpdatePublishesEvents(t *testing.T) {
+	ctx := context.Background()
+	alerts, nodes := newAlertService(t)
+	hub := NewEventHub()
+	nodes.Events, alerts.Events = hub, hub
+	sub := hub.Subscribe(EventFilter{Nodes: map[string]struct{}{"precis": {}}})
+	defer hub.Unsubscribe(sub)
+
+	if err := alerts.Register(ctx, domain.Alert{ID: "rate", Level: "high", Metric: MetricDeviceKeyRate, Target: "precisA", Operator: "<", Threshold: 100}); err != nil {
+		t.Fatal(err)
+	}
+	report := []domain.Node{{Name: "precisA", Status: "up", CurrentKeyRate: 50}}
+	if err := nodes.Update(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes.Update(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	alerts.scan(ctx)
+
+	var types []string
+	for len(sub.C) > 0 {
+		e := <-sub.C
+		if e.Node != "precis" {
+			t.Fatalf("unexpected node in %+v", e)
+		}
+		types = append(types, e.Type)
+	}
+	want := []string{domain.EventNodeStatus, domain.EventNodeSample, domain.EventNodeSample, domain.EventAlertFiring}
+	if len(types) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, types)
+		}
+	}
+}
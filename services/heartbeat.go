@@ -0,0 +1,71 @@
+package services
+
+import (
+	"os"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+)
+
+const (
+	// StatusStale marks a node whose agent stopped reporting.
+	StatusStale = "stale"
+	// StatusUnknown marks a device whose agent stopped reporting.
+	StatusUnknown = "unknown"
+
+	defaultHeartbeatTimeout = 5 * time.Minute
+
+	staleEventMessage   = "node stopped reporting"
+	resumedEventMessage = "node resumed reporting"
+)
+
+// HeartbeatTimeoutFromEnv returns how long an agent may stay silent before
+// its node is considered stale. It is read from HEARTBEAT_TIMEOUT (a Go
+// duration such as "90s") and defaults to five minutes; "0" disables stale
+// detection.
+func HeartbeatTimeoutFromEnv() time.Duration {
+	v := os.Getenv("HEARTBEAT_TIMEOUT")
+	if v == "" {
+		return defaultHeartbeatTimeout
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		logger.Log.Warnw("invalid HEARTBEAT_TIMEOUT, using default", "value", v)
+		return defaultHeartbeatTimeout
+	}
+	return d
+}
+
+// isStale reports whether data last seen `age` seconds ago is older than the
+// timeout. Entities that never reported are not stale.
+func isStale(lastSeen *time.Time, age int64, timeout time.Duration) bool {
+	return timeout > 0 && lastSeen != nil && time.Duration(age)*time.Second > timeout
+}
+
+// markStaleDevices sets the status of devices whose data is older than the
+// timeout to unknown.
+func markStaleDevices(devices []domain.Device, timeout time.Duration) {
+	for i := range devices {
+		if isStale(devices[i].LastSeen, devices[i].DataAge, timeout) {
+			devices[i].Status = StatusUnknown
+		}
+	}
+}
+
+// markStaleNode sets a node to stale and its devices to unknown when its data
+// is older than the timeout. It reports whether the node is stale.
+func markStaleNode(n *domain.NodeInfo, timeout time.Duration) bool {
+	if !isStale(n.LastSeen, n.DataAge, timeout) {
+		markStaleDevices(n.Devices, timeout)
+		return false
+	}
+	n.Status = StatusStale
+	for i := range n.Devices {
+		n.Devices[i].Status = StatusUnknown
+	}
+	return true
+}
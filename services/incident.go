@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+)
+
+// ErrIncidentNotFound is returned when an alert has no open incident.
+var ErrIncidentNotFound = errors.New("no open incident")
+
+// ErrInvalidSilence is returned when a silence request is malformed.
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// loadIncidents restores the open incidents so that a restart neither
+// duplicates them nor re-sends their notifications.
+func (s *AlertService) loadIncidents(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open = map[string]domain.Incident{}
+	if s.Incidents == nil {
+		return nil
+	}
+	open, err := s.Incidents.Open(ctx)
+	if err != nil {
+		return err
+	}
+	for _, i := range open {
+		s.open[i.AlertID] = i
+	}
+	return nil
+}
+
+// incidentDevice returns the device an incident of the alert refers to.
+func incidentDevice(a domain.Alert) string {
+	if a.Device != "" {
+		return a.Device
+	}
+	return a.Target
+}
+
+// fire opens an incident for the alert and notifies its contacts unless the
+// alert is silenced. An already open incident is kept as is. The caller must
+// hold s.mu.
+func (s *AlertService) fire(ctx context.Context, a domain.Alert, subject, body string, now time.Time) {
+	if s.open == nil {
+		s.open = map[string]domain.Incident{}
+	}
+	if _, ok := s.open[a.ID]; ok {
+		return
+	}
+	inc := domain.Incident{
+		ID:        fmt.Sprintf("%s-%d", a.ID, now.UnixNano()),
+		AlertID:   a.ID,
+		Device:    incidentDevice(a),
+		Level:     a.Level,
+		State:     domain.IncidentFiring,
+		Subject:   subject,
+		Message:   body,
+		Silenced:  s.silenced(ctx, a, now),
+		StartedAt: now,
+	}
+	logger.Log.Info(body)
+	if !inc.Silenced {
+		s.notify(a, subject, body)
+		inc.NotifiedAt = &now
+	}
+	s.open[a.ID] = inc
+	s.saveIncident(ctx, inc)
+	s.publishIncident(a, domain.EventAlertFiring, inc)
+}
+
+// resolve closes the open incident of the alert, if any, and tells everyone
+// who was notified about it that it recovered. The caller must hold s.mu.
+func (s *AlertService) resolve(ctx context.Context, a domain.Alert, now time.Time) {
+	inc, ok := s.open[a.ID]
+	if !ok {
+		return
+	}
+	delete(s.open, a.ID)
+	inc.State = domain.IncidentResolved
+	inc.ResolvedAt = &now
+	s.saveIncident(ctx, inc)
+	s.publishIncident(a, domain.EventAlertResolved, inc)
+
+	subject := "Device recovered"
+	body := fmt.Sprintf("device %s is back up after %s", inc.Device, since(inc.StartedAt, now))
+	if a.Metric != "" {
+		subject = "Threshold alert resolved"
+		body = fmt.Sprintf("%s of %s is back to normal after %s", a.Metric, a.Target, since(inc.StartedAt, now))
+	}
+	logger.Log.Info(body)
+	if inc.NotifiedAt == nil || s.silenced(ctx, a, now) {
+		return
+	}
+	s.notify(a, subject, body)
+	if inc.Escalated {
+		s.notifyContacts(a, s.policies[inc.Level].contacts, subject, body)
+	}
+}
+
+// forget drops the runtime state of an alert that was changed or removed,
+// closing its open incident without notifying anyone. The caller must hold
+// s.mu.
+func (s *AlertService) forget(ctx context.Context, alertID string, now time.Time) {
+	delete(s.pending, alertID)
+	inc, ok := s.open[alertID]
+	if !ok {
+		return
+	}
+	delete(s.open, alertID)
+	inc.State = domain.IncidentResolved
+	inc.ResolvedAt = &now
+	s.saveIncident(ctx, inc)
+}
+
+// publishIncident announces an incident transition, tagged with the node or
+// app the alert is about.
+func (s *AlertService) publishIncident(a domain.Alert, typ string, inc domain.Incident) {
+	e := domain.Event{Type: typ, Device: a.Device, Data: inc}
+	switch {
+	case a.Device != "":
+		e.Node = s.Network.NodeOf(a.Device)
+	case a.Metric == MetricDeviceKeyRate:
+		e.Node, e.Device = s.Network.NodeOf(a.Target), a.Target
+	case a.Metric == MetricNodeStoredKeyCount:
+		e.Node = a.Target
+	case a.Metric == MetricAppConsumptionRate:
+		e.App = a.Target
+	}
+	s.Events.Publish(e)
+}
+
+func (s *AlertService) saveIncident(ctx context.Context, inc domain.Incident) {
+	if s.Incidents == nil {
+		return
+	}
+	if err := s.Incidents.Save(ctx, inc); err != nil {
+		logger.Log.Errorw("failed to save incident", "incident", inc.ID, "error", err)
+	}
+}
+
+// silenced reports whether an active silence covers the alert.
+func (s *AlertService) silenced(ctx context.Context, a domain.Alert, now time.Time) bool {
+	return covered(s.activeSilences(ctx), a, now)
+}
+
+// activeSilences returns the silences that have not yet expired. Failures
+// are logged and give none.
+func (s *AlertService) activeSilences(ctx context.Context) []domain.Silence {
+	if s.Incidents == nil {
+		return nil
+	}
+	silences, err := s.Incidents.Silences(ctx)
+	if err != nil {
+		logger.Log.Errorw("failed to load silences", "error", err)
+		return nil
+	}
+	return silences
+}
+
+// covered reports whether one of the silences applies to the alert at now.
+func covered(silences []domain.Silence, a domain.Alert, now time.Time) bool {
+	for _, sl := range silences {
+		if sl.Covers(a.ID, incidentDevice(a), now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Acknowledge marks the open incident of the alert as acknowledged by the
+// given user.
+func (s *AlertService) Acknowledge(ctx context.Context, alertID, username string) (domain.Incident, error) {
+	ctx, span := startSpan(ctx, "AlertService.Acknowledge")
+	defer span.End()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inc, ok := s.open[alertID]
+	if !ok {
+		return domain.Incident{}, ErrIncidentNotFound
+	}
+	if inc.State == domain.IncidentFiring {
+		now := time.Now()
+		inc.State = domain.IncidentAcknowledged
+		inc.AcknowledgedBy = username
+		inc.AcknowledgedAt = &now
+		s.open[alertID] = inc
+		s.saveIncident(ctx, inc)
+		if i := s.indexOf(alertID); i >= 0 {
+			s.publishIncident(s.registered[i], domain.EventAlertAcknowledged, inc)
+		}
+	}
+	return inc, nil
+}
+
+// History returns recorded incidents matching the filter, newest first.
+func (s *AlertService) History(ctx context.Context, f domain.IncidentFilter) ([]domain.Incident, error) {
+	ctx, span := startSpan(ctx, "AlertService.History")
+	defer span.End()
+	if s.Incidents == nil {
+		return []domain.Incident{}, nil
+	}
+	return s.Incidents.History(ctx, f)
+}
+
+// Silence stores a silence for an alert or a device. Until must lie in the
+// future.
+func (s *AlertService) Silence(ctx context.Context, sl domain.Silence) (domain.Silence, error) {
+	ctx, span := startSpan(ctx, "AlertService.Silence")
+	defer span.End()
+	if s.Incidents == nil {
+		return domain.Silence{}, errors.New("silences are not available")
+	}
+	if sl.AlertID == "" && sl.Device == "" {
+		return domain.Silence{}, fmt.Errorf("%w: alertId or device is required", ErrInvalidSilence)
+	}
+	now := time.Now()
+	if !sl.Until.After(now) {
+		return domain.Silence{}, fmt.Errorf("%w: until must be in the future", ErrInvalidSilence)
+	}
+	sl.ID = fmt.Sprintf("silence-%d", now.UnixNano())
+	sl.CreatedAt = now
+	if err := s.Incidents.AddSilence(ctx, sl); err != nil {
+		return domain.Silence{}, err
+	}
+	return sl, nil
+}
+
+// Silences returns the silences that have not yet expired.
+func (s *AlertService) Silences(ctx context.Context) ([]domain.Silence, error) {
+	ctx, span := startSpan(ctx, "AlertService.Silences")
+	defer span.End()
+	if s.Incidents == nil {
+		return []domain.Silence{}, nil
+	}
+	return s.Incidents.Silences(ctx)
+}
+
+// Unsilence removes a silence before it expires.
+func (s *AlertService) Unsilence(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "AlertService.Unsilence")
+	defer span.End()
+	if s.Incidents == nil {
+		return errors.New("silence not found")
+	}
+	return s.Incidents.DeleteSilence(ctx, id)
+}
@@ -1,17 +1,162 @@
 package services
 
-import "mondash-backend/repository"
-import "mondash-backend/domain"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
+
+// Link statuses shown on the map.
+const (
+	LinkGreen  = "green"
+	LinkYellow = "yellow"
+	LinkRed    = "red"
+)
 
 // MapService contains business logic for map data.
 type MapService struct {
 	Repo repository.MapRepository
+	// NodeRepo provides the health and latest reports of the nodes and
+	// devices at both ends of a connection. Without it connections are
+	// returned as stored.
+	NodeRepo repository.NodeRepository
+	// DeviceRepo provides the key rates reported by the devices carrying a
+	// connection. Without it no keys count as exchanged.
+	DeviceRepo repository.DeviceRepository
+	// HeartbeatTimeout is how long nodes and devices may go without reports
+	// before they are considered stale. It is also how recent a key rate
+	// sample must be to count as current; zero uses five minutes for the
+	// latter.
+	HeartbeatTimeout time.Duration
 }
 
-// Get returns map data from the repository.
-func (s *MapService) Get() (domain.MapData, error) {
+// Get returns map data from the repository with the status of every
+// connection derived from the health of its endpoints.
+func (s *MapService) Get(ctx context.Context) (domain.MapData, error) {
+	ctx, span := startSpan(ctx, "MapService.Get")
+	defer span.End()
 	if s.Repo == nil {
 		return domain.MapData{}, nil
 	}
-	return s.Repo.Get()
+	data, err := s.Repo.Get(ctx)
+	if err != nil || s.NodeRepo == nil {
+		return data, err
+	}
+	nodes, err := s.NodeRepo.List(ctx)
+	if err != nil {
+		return domain.MapData{}, err
+	}
+	byName := make(map[string]*domain.NodeInfo, len(nodes))
+	var devices []string
+	for i := range nodes {
+		markStaleNode(&nodes[i], s.HeartbeatTimeout)
+		byName[nodes[i].Name] = &nodes[i]
+		for _, d := range nodes[i].Devices {
+			devices = append(devices, d.ID)
+		}
+	}
+	rates := map[string]domain.KeyRateEntry{}
+	if s.DeviceRepo != nil {
+		if rates, err = s.DeviceRepo.LatestKeyRates(ctx, devices); err != nil {
+			return domain.MapData{}, err
+		}
+	}
+	connections := make([]domain.MapConnection, len(data.Connections))
+	for i, c := range data.Connections {
+		connections[i] = s.linkStatus(c, byName, rates)
+	}
+	data.Connections = connections
+	return data, nil
+}
+
+// linkStatus rates a connection between two nodes. It is red when either node
+// or a device carrying the link is down or silent, yellow when the devices
+// are up but no keys were exchanged recently, including when their latest
+// key rate is zero, and green otherwise. The key rate is the lower of the
+// recent device_keyrate samples, given by rates, of the devices at both ends.
+func (s *MapService) linkStatus(c domain.MapConnection, nodes map[string]*domain.NodeInfo, rates map[string]domain.KeyRateEntry) domain.MapConnection {
+	c.KeyRate = 0
+	for _, name := range []string{c.From, c.To} {
+		n, ok := nodes[name]
+		switch {
+		case !ok:
+			return withStatus(c, LinkRed, fmt.Sprintf("node %s is unknown", name))
+		case n.Status == "down":
+			return withStatus(c, LinkRed, fmt.Sprintf("node %s is down", name))
+		case n.Status == StatusStale:
+			return withStatus(c, LinkRed, fmt.Sprintf("node %s stopped reporting", name))
+		}
+	}
+
+	from, to, ok := linkDevices(nodes[c.From], nodes[c.To])
+	if !ok {
+		return withStatus(c, LinkRed, fmt.Sprintf("no device of %s is connected to %s", c.From, c.To))
+	}
+	for _, d := range []domain.Device{from, to} {
+		if alerting(d.Status) {
+			reason := fmt.Sprintf("device %s is %s", d.ID, d.Status)
+			if d.Status == StatusUnknown {
+				reason = fmt.Sprintf("device %s stopped reporting", d.ID)
+			}
+			return withStatus(c, LinkRed, reason)
+		}
+	}
+
+	window := s.HeartbeatTimeout
+	if window <= 0 {
+		window = defaultHeartbeatTimeout
+	}
+	reported := false
+	for _, d := range []domain.Device{from, to} {
+		rate, ok := recentKeyRate(rates[d.ID], window)
+		if !ok {
+			continue
+		}
+		if !reported || rate < c.KeyRate {
+			c.KeyRate = rate
+		}
+		reported = true
+	}
+	if !reported {
+		return withStatus(c, LinkYellow, fmt.Sprintf("no keys exchanged between %s and %s in the last %s", from.ID, to.ID, window))
+	}
+	if c.KeyRate == 0 {
+		return withStatus(c, LinkYellow, fmt.Sprintf("no keys exchanged between %s and %s", from.ID, to.ID))
+	}
+	if to.ConnectedTo.ID != from.ID {
+		return withStatus(c, LinkYellow, fmt.Sprintf("device %s is not connected back to %s", to.ID, from.ID))
+	}
+	return withStatus(c, LinkGreen, "keys are being exchanged")
+}
+
+func withStatus(c domain.MapConnection, status, reason string) domain.MapConnection {
+	c.Status, c.Reason = status, reason
+	return c
+}
+
+// linkDevices returns the device of `from` connected to `to` and its peer.
+func linkDevices(from, to *domain.NodeInfo) (domain.Device, domain.Device, bool) {
+	for _, d := range from.Devices {
+		if d.ConnectedTo.NodeID != to.Name {
+			continue
+		}
+		for _, peer := range to.Devices {
+			if peer.ID == d.ConnectedTo.ID {
+				return d, peer, true
+			}
+		}
+	}
+	return domain.Device{}, domain.Device{}, false
+}
+
+// recentKeyRate returns the rate of a device's latest key rate sample if it
+// is more recent than the window. A zero rate counts as reported.
+func recentKeyRate(e domain.KeyRateEntry, window time.Duration) (float64, bool) {
+	if e.Timestamp.IsZero() || time.Since(e.Timestamp) > window {
+		return 0, false
+	}
+	return float64(e.Rate), true
 }
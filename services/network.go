@@ -0,0 +1,44 @@
+package services
+
+import (
+	"sync"
+
+	"mondash-backend/config"
+)
+
+// Network holds the current network configuration, which tells the node a
+// device belongs to and the nodes serving a consumer. It is replaced when the
+// topology changes and is safe for concurrent use. A nil Network behaves as
+// an empty legacy configuration.
+type Network struct {
+	mu  sync.RWMutex
+	cfg config.Config
+}
+
+// NewNetwork returns a Network holding cfg.
+func NewNetwork(cfg config.Config) *Network {
+	return &Network{cfg: cfg}
+}
+
+// Config returns the current network configuration.
+func (n *Network) Config() config.Config {
+	if n == nil {
+		return config.Config{}
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.cfg
+}
+
+// Set replaces the network configuration.
+func (n *Network) Set(cfg config.Config) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.cfg = cfg
+}
+
+// NodeOf returns the node hosting the named device, or the name itself when
+// it is a node.
+func (n *Network) NodeOf(name string) string {
+	return n.Config().NodeOf(name)
+}
@@ -1,9 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"mondash-backend/domain"
+	"mondash-backend/logger"
 	"mondash-backend/repository"
 )
 
@@ -11,32 +16,92 @@ import (
 type NodeService struct {
 	Repo       repository.NodeRepository
 	DeviceRepo repository.DeviceRepository
+	// HeartbeatTimeout is how long a node may go without reports before it
+	// is shown as stale. Zero disables stale detection.
+	HeartbeatTimeout time.Duration
+	// Events receives status changes and key rate samples. It is optional.
+	Events *EventHub
+	// Rollups aggregates device key rates and node key counts. It is
+	// optional.
+	Rollups *RollupService
+	// Network tells which node reporting devices belong to.
+	Network *Network
+
+	mu         sync.Mutex
+	lastStatus map[string]string
 }
 
 // Update updates a node using the repository.
-func (s *NodeService) Update(nodes []domain.Node) error {
-	now := time.Now().Format(time.RFC3339)
+func (s *NodeService) Update(ctx context.Context, nodes []domain.Node) error {
+	ctx, span := startSpan(ctx, "NodeService.Update")
+	defer span.End()
+	now := time.Now().UTC()
 	for i := range nodes {
-		if nodes[i].Timestamp == "" {
+		if nodes[i].Timestamp.IsZero() {
 			nodes[i].Timestamp = now
 		}
 		if s.DeviceRepo != nil {
 			entry := domain.KeyRateEntry{Timestamp: nodes[i].Timestamp, Rate: int(nodes[i].CurrentKeyRate)}
-			_ = s.DeviceRepo.AddKeyRate(nodes[i].Name, entry)
+			_ = s.DeviceRepo.AddKeyRate(ctx, nodes[i].Name, entry)
 		}
 	}
 	if s.Repo == nil {
 		return nil
 	}
-	return s.Repo.Update(nodes)
+	if err := s.Repo.Update(ctx, nodes); err != nil {
+		return err
+	}
+	s.publish(nodes)
+	s.rollup(ctx, nodes)
+	return nil
+}
+
+// rollup records the key rate and the stored key count of every report under
+// its name, so that the devices of a node keep separate series.
+func (s *NodeService) rollup(ctx context.Context, nodes []domain.Node) {
+	if s.Rollups == nil {
+		return
+	}
+	for _, n := range nodes {
+		s.Rollups.Record(ctx, domain.SeriesDeviceKeyRate, n.Name, n.Timestamp, n.CurrentKeyRate)
+		s.Rollups.Record(ctx, domain.SeriesNodeKeyCount, n.Name, n.Timestamp, float64(n.StoredKeyCount))
+	}
+}
+
+// publish announces every report as a sample and status changes separately.
+// Reports may come from a node or one of its devices.
+func (s *NodeService) publish(nodes []domain.Node) {
+	if s.Events == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastStatus == nil {
+		s.lastStatus = map[string]string{}
+	}
+	for _, n := range nodes {
+		e := domain.Event{Node: s.Network.NodeOf(n.Name), Timestamp: n.Timestamp, Data: n}
+		if e.Node != n.Name {
+			e.Device = n.Name
+		}
+		if prev, ok := s.lastStatus[n.Name]; !ok || prev != n.Status {
+			s.lastStatus[n.Name] = n.Status
+			e.Type = domain.EventNodeStatus
+			s.Events.Publish(e)
+		}
+		e.Type = domain.EventNodeSample
+		s.Events.Publish(e)
+	}
 }
 
 // List returns nodes from the repository.
-func (s *NodeService) List() ([]domain.NodeInfo, error) {
+func (s *NodeService) List(ctx context.Context) ([]domain.NodeInfo, error) {
+	ctx, span := startSpan(ctx, "NodeService.List")
+	defer span.End()
 	if s.Repo == nil {
 		return nil, nil
 	}
-	nodes, err := s.Repo.List()
+	nodes, err := s.Repo.List(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -44,6 +109,7 @@ func (s *NodeService) List() ([]domain.NodeInfo, error) {
 		if nodes[i].Status == "up" {
 			nodes[i].Status = "active"
 		}
+		markStaleNode(&nodes[i], s.HeartbeatTimeout)
 		if nodes[i].Type == "trusted node" {
 			seen := make(map[string]struct{})
 			apps := nodes[i].Apps[:0]
@@ -59,3 +125,176 @@ func (s *NodeService) List() ([]domain.NodeInfo, error) {
 	}
 	return nodes, nil
 }
+
+// StartMonitoring periodically checks the nodes for missing heartbeats and
+// records an event whenever a node crosses the timeout in either direction.
+func (s *NodeService) StartMonitoring(ctx context.Context, interval time.Duration) {
+	if s.Repo == nil || s.HeartbeatTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.checkHeartbeats(ctx)
+			}
+		}
+	}()
+}
+
+func (s *NodeService) checkHeartbeats(ctx context.Context) {
+	nodes, err := s.Repo.List(ctx)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for i := range nodes {
+		stale := markStaleNode(&nodes[i], s.HeartbeatTimeout)
+		last := ""
+		if n := len(nodes[i].Events); n > 0 {
+			last = nodes[i].Events[n-1].Message
+		}
+		var msg string
+		switch {
+		case stale && last != staleEventMessage:
+			msg = staleEventMessage
+		case !stale && last == staleEventMessage:
+			msg = resumedEventMessage
+		}
+		if msg == "" {
+			continue
+		}
+		logger.Log.Infow(msg, "node", nodes[i].Name, "lastSeen", nodes[i].LastSeen)
+		if err := s.Repo.AddEvent(ctx, nodes[i].Name, domain.NodeEvent{Timestamp: now, Message: msg}); err != nil {
+			logger.Log.Warnw("failed to record node event", "node", nodes[i].Name, "error", err)
+		}
+	}
+}
+
+var (
+	// ErrNodeNotFound is returned when a node ID does not match any known node.
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrInvalidRange is returned for history queries with an unusable range
+	// or step.
+	ErrInvalidRange = errors.New("invalid time range")
+)
+
+const (
+	defaultHistoryRange   = 24 * time.Hour
+	defaultHistoryBuckets = 120
+	maxHistoryBuckets     = 10000
+)
+
+// History returns the status timeline of a node between start and end,
+// downsampled into buckets of the given step. Reports made under the node's
+// device names are included. Empty start, end or step default to the last 24
+// hours split into 120 buckets.
+func (s *NodeService) History(ctx context.Context, id string, start, end time.Time, step time.Duration) (domain.NodeHistory, error) {
+	ctx, span := startSpan(ctx, "NodeService.History")
+	defer span.End()
+	if s.Repo == nil {
+		return domain.NodeHistory{}, ErrNodeNotFound
+	}
+	nodes, err := s.Repo.List(ctx)
+	if err != nil {
+		return domain.NodeHistory{}, err
+	}
+	var names []string
+	for _, n := range nodes {
+		if n.ID != id {
+			continue
+		}
+		names = append(names, n.ID)
+		if n.Name != n.ID {
+			names = append(names, n.Name)
+		}
+		for _, d := range n.Devices {
+			names = append(names, d.ID)
+		}
+	}
+	if names == nil {
+		return domain.NodeHistory{}, ErrNodeNotFound
+	}
+
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultHistoryRange)
+	}
+	if !start.Before(end) {
+		return domain.NodeHistory{}, fmt.Errorf("%w: start must be before end", ErrInvalidRange)
+	}
+	if step <= 0 {
+		step = end.Sub(start) / defaultHistoryBuckets
+		if step < time.Second {
+			step = time.Second
+		}
+	}
+	if end.Sub(start)/step > maxHistoryBuckets {
+		return domain.NodeHistory{}, fmt.Errorf("%w: step too small for the requested range", ErrInvalidRange)
+	}
+
+	recs, err := s.Repo.History(ctx, names, start, end)
+	if err != nil {
+		return domain.NodeHistory{}, err
+	}
+	return domain.NodeHistory{
+		Node:   id,
+		Start:  start,
+		End:    end,
+		Step:   step.String(),
+		Points: downsampleNodes(recs, start, step),
+	}, nil
+}
+
+// downsampleNodes groups chronologically ordered reports into buckets of the
+// given step starting at start. Empty buckets are omitted.
+func downsampleNodes(recs []domain.Node, start time.Time, step time.Duration) []domain.NodeHistoryPoint {
+	points := []domain.NodeHistoryPoint{}
+	var (
+		cur      *domain.NodeHistoryPoint
+		curIdx   int64 = -1
+		keySum   int
+		rateSum  float64
+		wentDown bool
+	)
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.StoredKeyCount = keySum / cur.Samples
+		cur.CurrentKeyRate = rateSum / float64(cur.Samples)
+		if wentDown {
+			cur.Status = "down"
+		}
+		points = append(points, *cur)
+		cur = nil
+	}
+	for _, rec := range recs {
+		ts := rec.Timestamp
+		if ts.IsZero() || ts.Before(start) {
+			continue
+		}
+		idx := int64(ts.Sub(start) / step)
+		if idx != curIdx {
+			flush()
+			curIdx = idx
+			cur = &domain.NodeHistoryPoint{Timestamp: start.Add(time.Duration(idx) * step)}
+			keySum, rateSum, wentDown = 0, 0, false
+		}
+		cur.Samples++
+		cur.Status = rec.Status
+		keySum += rec.StoredKeyCount
+		rateSum += rec.CurrentKeyRate
+		if rec.Status == "down" {
+			wentDown = true
+		}
+	}
+	flush()
+	return points
+}
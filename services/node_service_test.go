@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository/inmemory"
+)
+
+func TestStaleNodeDetection(t *testing.T) {
+	ctx := context.Background()
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	t.Setenv("CONFIG_FILE", "../config.yaml")
+	repo := inmemory.NewNodeRepo()
+	s := &NodeService{Repo: repo, HeartbeatTimeout: time.Minute}
+
+	old := time.Now().Add(-time.Hour)
+	if err := s.Update(ctx, []domain.Node{{Name: "precisA", Status: "up", Timestamp: old}}); err != nil {
+		t.Fatal(err)
+	}
+
+	precis := func() domain.NodeInfo {
+		t.Helper()
+		nodes, err := s.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range nodes {
+			if n.ID == "precis" {
+				return n
+			}
+		}
+		t.Fatal("node precis not found")
+		return domain.NodeInfo{}
+	}
+
+	n := precis()
+	if n.Status != StatusStale {
+		t.Fatalf("expected status %q, got %q", StatusStale, n.Status)
+	}
+	for _, d := range n.Devices {
+		if d.Status != StatusUnknown {
+			t.Fatalf("expected device %s to be %q, got %q", d.ID, StatusUnknown, d.Status)
+		}
+	}
+
+	s.checkHeartbeats(ctx)
+	s.checkHeartbeats(ctx)
+	if events := precis().Events; len(events) != 1 || events[0].Message != staleEventMessage {
+		t.Fatalf("expected a single stale event, got %+v", events)
+	}
+
+	alerts := &AlertService{
+		DeviceRepo:       inmemory.NewDeviceRepo(repo),
+		HeartbeatTimeout: time.Minute,
+		registered:       []domain.Alert{{ID: "a", Device: "precisA", Level: "high"}},
+	}
+	active, err := alerts.ActiveAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 {
+		t.Fatalf("expected the stale device to raise an alert, got %+v", active)
+	}
+
+	if err := s.Update(ctx, []domain.Node{{Name: "precisA", Status: "up"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.checkHeartbeats(ctx)
+	n = precis()
+	if n.Status == StatusStale {
+		t.Fatalf("expected node to recover after a fresh report")
+	}
+	if last := n.Events[len(n.Events)-1]; last.Message != resumedEventMessage {
+		t.Fatalf("expected a resumed event, got %+v", n.Events)
+	}
+}
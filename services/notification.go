@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/notifier"
+)
+
+const (
+	defaultNotifyAttempts = 3
+	defaultNotifyBackoff  = 2 * time.Second
+)
+
+// initNotifiers configures the delivery channels and retry policy from the
+// environment. Existing entries in s.Notifiers are kept.
+func (s *AlertService) initNotifiers() {
+	defaults := map[string]notifier.Notifier{
+		notifier.ChannelEmail: notifier.SMTP{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		},
+		notifier.ChannelWebhook: notifier.Webhook{},
+		notifier.ChannelSlack:   notifier.Slack{},
+		notifier.ChannelSyslog: notifier.Syslog{
+			Network: os.Getenv("SYSLOG_NETWORK"),
+			Addr:    os.Getenv("SYSLOG_ADDR"),
+			Tag:     os.Getenv("SYSLOG_TAG"),
+		},
+	}
+	if s.Notifiers == nil {
+		s.Notifiers = map[string]notifier.Notifier{}
+	}
+	for ch, n := range defaults {
+		if _, ok := s.Notifiers[ch]; !ok {
+			s.Notifiers[ch] = n
+		}
+	}
+
+	s.maxAttempts = defaultNotifyAttempts
+	if v := os.Getenv("NOTIFY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			s.maxAttempts = n
+		}
+	}
+	s.backoff = defaultNotifyBackoff
+	if v := os.Getenv("NOTIFY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			s.backoff = d
+		}
+	}
+}
+
+// channelOf returns the delivery channel of an alert, defaulting to email.
+func channelOf(a domain.Alert) string {
+	if a.Channel == "" {
+		return notifier.ChannelEmail
+	}
+	return a.Channel
+}
+
+// destinationOf returns where the alert's notifications are sent.
+func destinationOf(a domain.Alert) string {
+	switch channelOf(a) {
+	case notifier.ChannelEmail:
+		return a.Email
+	case notifier.ChannelWebhook, notifier.ChannelSlack:
+		return a.Webhook
+	}
+	return ""
+}
+
+// validateChannel checks the delivery settings of an alert.
+func validateChannel(a domain.Alert) error {
+	switch channelOf(a) {
+	case notifier.ChannelEmail, notifier.ChannelSyslog:
+		return nil
+	case notifier.ChannelWebhook, notifier.ChannelSlack:
+		u, err := url.Parse(a.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: webhook must be an http(s) URL", ErrInvalidAlert)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown channel %q", ErrInvalidAlert, a.Channel)
+}
+
+// notify delivers a notification for the alert in the background.
+func (s *AlertService) notify(a domain.Alert, subject, body string) {
+	if channelOf(a) == notifier.ChannelEmail && !s.emailEnabled {
+		return
+	}
+	msg := notifier.Message{
+		AlertID:   a.ID,
+		Level:     a.Level,
+		Subject:   subject,
+		Body:      body,
+		Timestamp: time.Now(),
+	}
+	go s.deliver(context.Background(), a, msg)
+}
+
+// deliver sends the message through the alert's channel, retrying with
+// exponential backoff, and records the outcome.
+func (s *AlertService) deliver(ctx context.Context, a domain.Alert, msg notifier.Message) domain.AlertDelivery {
+	channel, to := channelOf(a), destinationOf(a)
+	rec := domain.AlertDelivery{
+		AlertID:     a.ID,
+		Channel:     channel,
+		Destination: to,
+		Subject:     msg.Subject,
+	}
+	n, ok := s.Notifiers[channel]
+	if !ok {
+		rec.Error = "no notifier for channel " + channel
+	} else {
+		attempts := s.maxAttempts
+		if attempts <= 0 {
+			attempts = 1
+		}
+		wait := s.backoff
+		for rec.Attempts < attempts {
+			rec.Attempts++
+			err := n.Notify(ctx, to, msg)
+			if err == nil {
+				rec.Delivered, rec.Error = true, ""
+				break
+			}
+			rec.Error = err.Error()
+			if rec.Attempts == attempts {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				rec.Error = ctx.Err().Error()
+				attempts = rec.Attempts
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+	}
+	rec.Timestamp = time.Now().UTC()
+	if !rec.Delivered {
+		logger.Log.Warnw("alert notification failed", "alert", a.ID, "channel", channel, "attempts", rec.Attempts, "error", rec.Error)
+	}
+	if s.Repo != nil {
+		if err := s.Repo.RecordDelivery(ctx, rec); err != nil {
+			logger.Log.Errorw("failed to record alert delivery", "alert", a.ID, "error", err)
+		}
+	}
+	return rec
+}
+
+// Deliveries returns up to `limit` recorded notification deliveries, newest
+// first. When failedOnly is set only undelivered notifications are returned.
+func (s *AlertService) Deliveries(ctx context.Context, limit int, failedOnly bool) ([]domain.AlertDelivery, error) {
+	ctx, span := startSpan(ctx, "AlertService.Deliveries")
+	defer span.End()
+	if s.Repo == nil {
+		return []domain.AlertDelivery{}, nil
+	}
+	all, err := s.Repo.Deliveries(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	res := []domain.AlertDelivery{}
+	for _, d := range all {
+		if failedOnly && d.Delivered {
+			continue
+		}
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"mondash-backend/domain"
+	"mondash-backend/notifier"
+)
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	ctx := context.Background()
+	alerts, _ := newAlertService(t)
+	alerts.initNotifiers()
+	alerts.backoff = 0
+
+	var calls int32
+	var got notifier.Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	a := domain.Alert{ID: "hook", Device: "precisA", Level: "high", Channel: notifier.ChannelWebhook, Webhook: srv.URL}
+	rec := alerts.deliver(ctx, a, notifier.Message{AlertID: a.ID, Level: a.Level, Subject: "Device down", Body: "device precisA is down"})
+	if !rec.Delivered || rec.Attempts != 3 {
+		t.Fatalf("expected delivery on the third attempt, got %+v", rec)
+	}
+	if got.AlertID != "hook" || got.Subject != "Device down" {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+
+	srv.Close()
+	rec = alerts.deliver(ctx, a, notifier.Message{AlertID: a.ID, Subject: "Device down"})
+	if rec.Delivered || rec.Error == "" || rec.Attempts != defaultNotifyAttempts {
+		t.Fatalf("expected recorded failure, got %+v", rec)
+	}
+
+	failed, err := alerts.Deliveries(ctx, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].AlertID != "hook" {
+		t.Fatalf("expected one failed delivery, got %+v", failed)
+	}
+}
+
+func TestRegisterValidatesChannel(t *testing.T) {
+	ctx := context.Background()
+	alerts, _ := newAlertService(t)
+	bad := []domain.Alert{
+		{Device: "precisA", Level: "high", Channel: "pager"},
+		{Device: "precisA", Level: "high", Channel: notifier.ChannelSlack},
+		{Device: "precisA", Level: "high", Channel: notifier.ChannelWebhook, Webhook: "ftp://example.com"},
+	}
+	for _, a := range bad {
+		if err := alerts.Register(ctx, a); !errors.Is(err, ErrInvalidAlert) {
+			t.Fatalf("expected ErrInvalidAlert for %+v, got %v", a, err)
+		}
+	}
+	ok := domain.Alert{Device: "precisA", Level: "high", Channel: notifier.ChannelSlack, Webhook: "https://hooks.example.com/x"}
+	if err := alerts.Register(ctx, ok); err != nil {
+		t.Fatal(err)
+	}
+}
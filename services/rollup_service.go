@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+// maxTimelinePoints bounds the number of buckets per key when the resolution
+// of a timeline is picked automatically.
+const maxTimelinePoints = 500
+
+// RollupService records report samples into rollups and serves long-range
+// timelines from them.
+type RollupService struct {
+	Repo repository.RollupRepository
+}
+
+// Record folds a sample into the rollups of series. Failures are only logged
+// so that a report is never rejected because of its rollups. Record does
+// nothing on a nil service.
+func (s *RollupService) Record(ctx context.Context, series, key string, at time.Time, value float64) {
+	ctx, span := startSpan(ctx, "RollupService.Record")
+	defer span.End()
+	if s == nil || s.Repo == nil {
+		return
+	}
+	if err := s.Repo.Add(ctx, series, key, at, value); err != nil {
+		logger.Log.Warnw("failed to update rollup", "series", series, "key", key, "error", err)
+	}
+}
+
+// Timeline returns the points of series between start and end for the given
+// keys, or every key when none are given. Empty start and end default to the
+// last 24 hours. Without a step the finest resolution yielding at most
+// maxTimelinePoints buckets is used; with one, buckets of the coarsest
+// resolution not exceeding the step are merged into steps. Steps finer than
+// the finest resolution are rounded up to it.
+func (s *RollupService) Timeline(ctx context.Context, series string, keys []string, start, end time.Time, step time.Duration) (domain.RollupSeries, error) {
+	ctx, span := startSpan(ctx, "RollupService.Timeline")
+	defer span.End()
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultHistoryRange)
+	}
+	if !start.Before(end) {
+		return domain.RollupSeries{}, fmt.Errorf("%w: start must be before end", ErrInvalidRange)
+	}
+	if step < 0 {
+		return domain.RollupSeries{}, fmt.Errorf("%w: step must be positive", ErrInvalidRange)
+	}
+
+	resolutions := domain.RollupResolutions
+	res := resolutions[len(resolutions)-1]
+	if step == 0 {
+		for _, r := range resolutions {
+			if end.Sub(start)/r <= maxTimelinePoints {
+				res = r
+				break
+			}
+		}
+		step = res
+	} else {
+		res = resolutions[0]
+		for _, r := range resolutions {
+			if r <= step {
+				res = r
+			}
+		}
+		if step < res {
+			step = res
+		}
+	}
+	if end.Sub(start)/step > maxHistoryBuckets {
+		return domain.RollupSeries{}, fmt.Errorf("%w: step too small for the requested range", ErrInvalidRange)
+	}
+
+	out := domain.RollupSeries{
+		Series:     series,
+		Start:      start,
+		End:        end,
+		Step:       step.String(),
+		Resolution: res.String(),
+		Data:       map[string][]domain.RollupPoint{},
+	}
+	if s == nil || s.Repo == nil {
+		return out, nil
+	}
+	buckets, err := s.Repo.Range(ctx, series, res, keys, start.Truncate(res), end)
+	if err != nil {
+		return domain.RollupSeries{}, err
+	}
+	for key, points := range buckets {
+		out.Data[key] = mergeRollups(points, step)
+	}
+	return out, nil
+}
+
+// mergeRollups merges chronologically ordered buckets into buckets of step.
+func mergeRollups(points []domain.RollupPoint, step time.Duration) []domain.RollupPoint {
+	merged := []domain.RollupPoint{}
+	for _, p := range points {
+		bucket := p.Timestamp.Truncate(step)
+		if n := len(merged); n > 0 && merged[n-1].Timestamp.Equal(bucket) {
+			merged[n-1].Merge(p)
+			continue
+		}
+		m := domain.RollupPoint{Timestamp: bucket}
+		m.Merge(p)
+		merged = append(merged, m)
+	}
+	return merged
+}
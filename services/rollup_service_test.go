@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository/inmemory"
+)
+
+func TestRollupTimelineResolution(t *testing.T) {
+	ctx := context.Background()
+	s := &RollupService{Repo: inmemory.NewRollupRepo()}
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, v := range []float64{10, 30, 20, 40} {
+		s.Record(ctx, domain.SeriesDeviceKeyRate, "precisA", base.Add(time.Duration(i)*50*time.Minute), v)
+	}
+
+	// Six hours fit into minute buckets.
+	fine, err := s.Timeline(ctx, domain.SeriesDeviceKeyRate, nil, base, base.Add(6*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fine.Resolution != "1m0s" || len(fine.Data["precisA"]) != 4 {
+		t.Fatalf("expected four minute buckets, got %+v", fine)
+	}
+
+	// A month is served from day buckets.
+	month, _ := s.Timeline(ctx, domain.SeriesDeviceKeyRate, nil, base, base.Add(30*24*time.Hour), 0)
+	day := month.Data["precisA"]
+	if month.Resolution != "24h0m0s" || len(day) != 1 {
+		t.Fatalf("expected a single day bucket, got %+v", month)
+	}
+	if p := day[0]; p.Count != 4 || p.Sum != 100 || p.Avg != 25 || p.Min != 10 || p.Max != 40 {
+		t.Fatalf("unexpected day aggregate %+v", p)
+	}
+
+	// A two hour step merges hour buckets.
+	stepped, _ := s.Timeline(ctx, domain.SeriesDeviceKeyRate, []string{"precisA"}, base, base.Add(6*time.Hour), 2*time.Hour)
+	points := stepped.Data["precisA"]
+	if stepped.Resolution != "1h0m0s" || stepped.Step != "2h0m0s" || len(points) != 2 {
+		t.Fatalf("expected two 2h buckets from hour rollups, got %+v", stepped)
+	}
+	if points[0].Count != 3 || points[0].Max != 30 || points[1].Count != 1 || points[1].Sum != 40 {
+		t.Fatalf("unexpected merged buckets %+v", points)
+	}
+
+	if _, err := s.Timeline(ctx, domain.SeriesDeviceKeyRate, nil, base, base.Add(365*24*time.Hour), time.Second); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("expected ErrInvalidRange for too many buckets, got %v", err)
+	}
+	if other, _ := s.Timeline(ctx, domain.SeriesDeviceKeyRate, []string{"campus"}, base, base.Add(time.Hour), 0); len(other.Data) != 0 {
+		t.Fatalf("expected no data for an unknown key, got %+v", other.Data)
+	}
+}
+
+func TestReportsFeedRollups(t *testing.T) {
+	ctx := context.Background()
+	rollups := &RollupService{Repo: inmemory.NewRollupRepo()}
+	nodes := &NodeService{Repo: inmemory.NewNodeRepo(), Rollups: rollups}
+	apps := &AppService{Repo: inmemory.NewAppRepo(), Rollups: rollups}
+	now := time.Now().UTC()
+
+	err := nodes.Update(ctx, []domain.Node{
+		{Name: "precisA", Status: "up", StoredKeyCount: 7, CurrentKeyRate: 120},
+		{Name: "precisB", Status: "up", StoredKeyCount: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apps.Update(ctx, &domain.App{NodeID: "precis", Name: "vpn1", NumberOfKeys: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apps.Update(ctx, &domain.App{NodeID: "precis", Name: "vpn1", NumberOfKeys: 3}); err != nil {
+		t.Fatal(err)
+	}
+	// Reports without a key count count as one key, as in the raw history.
+	if err := apps.Update(ctx, &domain.App{NodeID: "precis", Name: "vpn1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+	keys, _ := rollups.Timeline(ctx, domain.SeriesNodeKeyCount, nil, start, end, 0)
+	if a, b := keys.Data["precisA"], keys.Data["precisB"]; len(a) != 1 || a[0].Max != 7 || len(b) != 1 || b[0].Max != 2 {
+		t.Fatalf("expected a key count per device, got %+v", keys.Data)
+	}
+	rates, _ := rollups.Timeline(ctx, domain.SeriesDeviceKeyRate, nil, start, end, 0)
+	if p := rates.Data["precisA"]; len(p) != 1 || p[0].Avg != 120 {
+		t.Fatalf("expected the key rate under the device, got %+v", rates.Data)
+	}
+	timeline, err := apps.Timeline(ctx, start, end, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	for _, a := range timeline {
+		if a.Name == "vpn1" {
+			for _, e := range a.KeyConsumptionHistory {
+				total += e.Count
+			}
+		}
+	}
+	if total != 9 {
+		t.Fatalf("expected 9 consumed keys in the timeline, got %+v", timeline)
+	}
+}
@@ -0,0 +1,552 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+)
+
+var (
+	// ErrInvalidTopology is returned when a change would leave the topology
+	// inconsistent, such as a link to an unknown device.
+	ErrInvalidTopology = errors.New("invalid topology")
+	// ErrTopologyNotFound is returned when the element to change is not part
+	// of the topology.
+	ErrTopologyNotFound = errors.New("not found in topology")
+	// ErrTopologyConflict is returned when adding an element that already
+	// exists.
+	ErrTopologyConflict = errors.New("already exists in topology")
+	// ErrTopologyNotApplied is returned when a change was stored but the
+	// node, app and map definitions could not be derived from it. They
+	// disagree with the stored topology until it is applied again, by the
+	// next change or at startup.
+	ErrTopologyNotApplied = errors.New("topology stored but not applied")
+)
+
+// TopologyService manages the network topology. Every change is validated
+// and stored, then applied to the node, app and map repositories and to the
+// authorization rules, so that the dashboard reflects it without re-seeding.
+// Reports and history are kept.
+type TopologyService struct {
+	Repo     repository.TopologyRepository
+	NodeRepo repository.NodeRepository
+	AppRepo  repository.AppRepository
+	MapRepo  repository.MapRepository
+	Network  *Network
+
+	mu sync.Mutex
+}
+
+// Init applies the stored topology. When none is stored yet, the network
+// defined by cfg is imported.
+func (s *TopologyService) Init(ctx context.Context, cfg config.Config) error {
+	ctx, span := startSpan(ctx, "TopologyService.Init")
+	defer span.End()
+	if s.Repo == nil {
+		return nil
+	}
+	t, err := s.Repo.Get(ctx)
+	if errors.Is(err, repository.ErrNoTopology) {
+		_, err = s.importFile(ctx, cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return s.apply(ctx, t)
+}
+
+// Reload applies a new version of config.yaml. The topology is replaced when
+// the stored one was loaded from the file or describes the same network.
+// Otherwise it was edited through the API and is kept: only the other
+// settings are taken from the file, and the differences are logged.
+func (s *TopologyService) Reload(ctx context.Context, cfg config.Config) error {
+	ctx, span := startSpan(ctx, "TopologyService.Reload")
+	defer span.End()
+	if s.Repo == nil {
+		return nil
+	}
+	t, err := s.Repo.Get(ctx)
+	if err != nil && !errors.Is(err, repository.ErrNoTopology) {
+		return err
+	}
+	file := repository.TopologyFromConfig(cfg)
+	changes := diffTopology(withoutSettings(t), withoutSettings(file))
+	if err != nil || t.Source == domain.TopologySourceFile || len(changes) == 0 {
+		_, err = s.importFile(ctx, cfg)
+		return err
+	}
+	logger.Log.Warnw("config.yaml differs from the topology edited through the API, keeping the latter", "changes", changes)
+	if reflect.DeepEqual(t.Settings, file.Settings) {
+		return nil
+	}
+	_, err = s.modify(ctx, func(t *domain.Topology) error {
+		t.Settings = file.Settings
+		return nil
+	})
+	return err
+}
+
+// Get returns the current topology.
+func (s *TopologyService) Get(ctx context.Context) (domain.Topology, error) {
+	ctx, span := startSpan(ctx, "TopologyService.Get")
+	defer span.End()
+	if s.Repo == nil {
+		return domain.Topology{}, nil
+	}
+	t, err := s.Repo.Get(ctx)
+	if errors.Is(err, repository.ErrNoTopology) {
+		return repository.TopologyFromConfig(config.Config{}), nil
+	}
+	return t, err
+}
+
+// Export returns the topology in the config.yaml format.
+func (s *TopologyService) Export(ctx context.Context) (config.Config, error) {
+	ctx, span := startSpan(ctx, "TopologyService.Export")
+	defer span.End()
+	t, err := s.Get(ctx)
+	if err != nil {
+		return config.Config{}, err
+	}
+	return repository.ConfigFromTopology(t), nil
+}
+
+// Import replaces the topology with the network defined in cfg, which must
+// pass config.Validate. The result counts as edited through the API.
+func (s *TopologyService) Import(ctx context.Context, cfg config.Config) (domain.Topology, error) {
+	ctx, span := startSpan(ctx, "TopologyService.Import")
+	defer span.End()
+	return s.importConfig(ctx, cfg, domain.TopologySourceAPI)
+}
+
+// importFile replaces the topology with the one of config.yaml.
+func (s *TopologyService) importFile(ctx context.Context, cfg config.Config) (domain.Topology, error) {
+	return s.importConfig(ctx, cfg, domain.TopologySourceFile)
+}
+
+func (s *TopologyService) importConfig(ctx context.Context, cfg config.Config, source string) (domain.Topology, error) {
+	if err := cfg.Validate(); err != nil {
+		return domain.Topology{}, fmt.Errorf("%w: %v", ErrInvalidTopology, err)
+	}
+	return s.modify(ctx, func(t *domain.Topology) error {
+		*t = repository.TopologyFromConfig(cfg)
+		t.Source = source
+		return nil
+	})
+}
+
+// AddNode adds a node to the topology.
+func (s *TopologyService) AddNode(ctx context.Context, n domain.TopologyNode) (domain.TopologyNode, error) {
+	ctx, span := startSpan(ctx, "TopologyService.AddNode")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		if indexOfNode(*t, n.Name) >= 0 {
+			return fmt.Errorf("node %s %w", n.Name, ErrTopologyConflict)
+		}
+		t.Nodes = append(t.Nodes, n)
+		return nil
+	})
+	return n, err
+}
+
+// UpdateNode replaces the coordinates, KME URL and type of a node. Nodes
+// cannot be renamed.
+func (s *TopologyService) UpdateNode(ctx context.Context, name string, n domain.TopologyNode) (domain.TopologyNode, error) {
+	ctx, span := startSpan(ctx, "TopologyService.UpdateNode")
+	defer span.End()
+	n.Name = name
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfNode(*t, name)
+		if i < 0 {
+			return fmt.Errorf("node %s %w", name, ErrTopologyNotFound)
+		}
+		t.Nodes[i] = n
+		return nil
+	})
+	return n, err
+}
+
+// DeleteNode removes a node. It fails while devices are assigned to it.
+func (s *TopologyService) DeleteNode(ctx context.Context, name string) error {
+	ctx, span := startSpan(ctx, "TopologyService.DeleteNode")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfNode(*t, name)
+		if i < 0 {
+			return fmt.Errorf("node %s %w", name, ErrTopologyNotFound)
+		}
+		t.Nodes = append(t.Nodes[:i], t.Nodes[i+1:]...)
+		return nil
+	})
+	return err
+}
+
+// AddDevice adds a device to the topology.
+func (s *TopologyService) AddDevice(ctx context.Context, d domain.TopologyDevice) (domain.TopologyDevice, error) {
+	ctx, span := startSpan(ctx, "TopologyService.AddDevice")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		if indexOfDevice(*t, d.ID) >= 0 {
+			return fmt.Errorf("device %s %w", d.ID, ErrTopologyConflict)
+		}
+		t.Devices = append(t.Devices, d)
+		return nil
+	})
+	return d, err
+}
+
+// UpdateDevice replaces the node and KME URL of a device. Devices cannot be
+// renamed.
+func (s *TopologyService) UpdateDevice(ctx context.Context, id string, d domain.TopologyDevice) (domain.TopologyDevice, error) {
+	ctx, span := startSpan(ctx, "TopologyService.UpdateDevice")
+	defer span.End()
+	d.ID = id
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfDevice(*t, id)
+		if i < 0 {
+			return fmt.Errorf("device %s %w", id, ErrTopologyNotFound)
+		}
+		t.Devices[i] = d
+		return nil
+	})
+	return d, err
+}
+
+// DeleteDevice removes a device. It fails while links or paths use it.
+func (s *TopologyService) DeleteDevice(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "TopologyService.DeleteDevice")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfDevice(*t, id)
+		if i < 0 {
+			return fmt.Errorf("device %s %w", id, ErrTopologyNotFound)
+		}
+		t.Devices = append(t.Devices[:i], t.Devices[i+1:]...)
+		return nil
+	})
+	return err
+}
+
+// AddLink adds a link between two devices.
+func (s *TopologyService) AddLink(ctx context.Context, l domain.TopologyLink) (domain.TopologyLink, error) {
+	ctx, span := startSpan(ctx, "TopologyService.AddLink")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		if indexOfLink(*t, l.From, l.To) >= 0 {
+			return fmt.Errorf("link %s-%s %w", l.From, l.To, ErrTopologyConflict)
+		}
+		t.Links = append(t.Links, l)
+		return nil
+	})
+	return l, err
+}
+
+// UpdateLink replaces the length of the link between two devices, given in
+// either order.
+func (s *TopologyService) UpdateLink(ctx context.Context, from, to string, l domain.TopologyLink) (domain.TopologyLink, error) {
+	ctx, span := startSpan(ctx, "TopologyService.UpdateLink")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfLink(*t, from, to)
+		if i < 0 {
+			return fmt.Errorf("link %s-%s %w", from, to, ErrTopologyNotFound)
+		}
+		t.Links[i].Length = l.Length
+		l = t.Links[i]
+		return nil
+	})
+	return l, err
+}
+
+// DeleteLink removes the link between two devices, given in either order.
+func (s *TopologyService) DeleteLink(ctx context.Context, from, to string) error {
+	ctx, span := startSpan(ctx, "TopologyService.DeleteLink")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfLink(*t, from, to)
+		if i < 0 {
+			return fmt.Errorf("link %s-%s %w", from, to, ErrTopologyNotFound)
+		}
+		t.Links = append(t.Links[:i], t.Links[i+1:]...)
+		return nil
+	})
+	return err
+}
+
+// AddConsumer declares a consumer.
+func (s *TopologyService) AddConsumer(ctx context.Context, name string) error {
+	ctx, span := startSpan(ctx, "TopologyService.AddConsumer")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		for _, c := range t.Consumers {
+			if c == name {
+				return fmt.Errorf("consumer %s %w", name, ErrTopologyConflict)
+			}
+		}
+		t.Consumers = append(t.Consumers, name)
+		return nil
+	})
+	return err
+}
+
+// DeleteConsumer removes a consumer. It fails while paths use it.
+func (s *TopologyService) DeleteConsumer(ctx context.Context, name string) error {
+	ctx, span := startSpan(ctx, "TopologyService.DeleteConsumer")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		for i, c := range t.Consumers {
+			if c == name {
+				t.Consumers = append(t.Consumers[:i], t.Consumers[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("consumer %s %w", name, ErrTopologyNotFound)
+	})
+	return err
+}
+
+// SetPath creates or replaces the routes a consumer uses from a device.
+func (s *TopologyService) SetPath(ctx context.Context, p domain.ConsumerPath) (domain.ConsumerPath, error) {
+	ctx, span := startSpan(ctx, "TopologyService.SetPath")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		if i := indexOfPath(*t, p.Device, p.Consumer); i >= 0 {
+			t.Paths[i] = p
+			return nil
+		}
+		t.Paths = append(t.Paths, p)
+		return nil
+	})
+	return p, err
+}
+
+// DeletePath removes the routes a consumer uses from a device.
+func (s *TopologyService) DeletePath(ctx context.Context, device, consumer string) error {
+	ctx, span := startSpan(ctx, "TopologyService.DeletePath")
+	defer span.End()
+	_, err := s.modify(ctx, func(t *domain.Topology) error {
+		i := indexOfPath(*t, device, consumer)
+		if i < 0 {
+			return fmt.Errorf("path of %s from %s %w", consumer, device, ErrTopologyNotFound)
+		}
+		t.Paths = append(t.Paths[:i], t.Paths[i+1:]...)
+		return nil
+	})
+	return err
+}
+
+// modify applies change to a copy of the current topology, then validates,
+// stores and applies the result. Changes count as made through the API unless
+// change sets another source.
+func (s *TopologyService) modify(ctx context.Context, change func(*domain.Topology) error) (domain.Topology, error) {
+	if s.Repo == nil {
+		return domain.Topology{}, errors.New("topology unavailable")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.Get(ctx)
+	if err != nil {
+		return domain.Topology{}, err
+	}
+	t = cloneTopology(t)
+	t.Source = domain.TopologySourceAPI
+	if err := change(&t); err != nil {
+		return domain.Topology{}, err
+	}
+	if err := ValidateTopology(t); err != nil {
+		return domain.Topology{}, err
+	}
+	if err := s.Repo.Save(ctx, t); err != nil {
+		return domain.Topology{}, err
+	}
+	if err := s.apply(ctx, t); err != nil {
+		logger.Log.Errorw("stored topology but failed to apply it, nodes, apps and the map are out of date", "error", err)
+		return t, fmt.Errorf("%w: %w", ErrTopologyNotApplied, err)
+	}
+	return t, nil
+}
+
+// apply derives the node, app and map definitions and the network
+// configuration shared by the services from the topology.
+func (s *TopologyService) apply(ctx context.Context, t domain.Topology) error {
+	if s.NodeRepo != nil {
+		if err := s.NodeRepo.Sync(ctx, repository.NodesFromTopology(t)); err != nil {
+			return err
+		}
+	}
+	if s.AppRepo != nil {
+		if err := s.AppRepo.Sync(ctx, repository.AppsFromTopology(t)); err != nil {
+			return err
+		}
+	}
+	if s.MapRepo != nil {
+		if err := s.MapRepo.Save(ctx, repository.MapFromTopology(t)); err != nil {
+			return err
+		}
+	}
+	if s.Network != nil {
+		s.Network.Set(repository.ConfigFromTopology(t))
+	}
+	logger.Log.Infow("applied topology", "nodes", len(t.Nodes), "devices", len(t.Devices), "links", len(t.Links), "paths", len(t.Paths))
+	return nil
+}
+
+// ValidateTopology checks that every node has a name and valid coordinates,
+// that names are unique, that devices belong to known nodes and that links
+// and paths only reference known devices and declared consumers. All
+// problems are reported in a single ErrInvalidTopology error.
+func ValidateTopology(t domain.Topology) error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	nodes := map[string]struct{}{}
+	for _, n := range t.Nodes {
+		switch {
+		case n.Name == "":
+			report("node without a name")
+			continue
+		case n.Coordinates == nil:
+			report("node %s has no coordinates", n.Name)
+		case n.Coordinates.Lat < -90 || n.Coordinates.Lat > 90 || n.Coordinates.Long < -180 || n.Coordinates.Long > 180:
+			report("node %s has invalid coordinates", n.Name)
+		}
+		if _, ok := nodes[n.Name]; ok {
+			report("duplicate node %s", n.Name)
+		}
+		nodes[n.Name] = struct{}{}
+	}
+
+	devices := map[string]struct{}{}
+	for _, d := range t.Devices {
+		if d.ID == "" {
+			report("device without an id")
+			continue
+		}
+		if _, ok := devices[d.ID]; ok {
+			report("duplicate device %s", d.ID)
+		}
+		devices[d.ID] = struct{}{}
+		if _, ok := nodes[d.Node]; !ok {
+			report("device %s belongs to unknown node %q", d.ID, d.Node)
+		}
+	}
+
+	links := map[[2]string]struct{}{}
+	for _, l := range t.Links {
+		for _, end := range []string{l.From, l.To} {
+			if _, ok := devices[end]; !ok {
+				report("link %s-%s references unknown device %q", l.From, l.To, end)
+			}
+		}
+		if l.From == l.To {
+			report("link %s-%s connects a device to itself", l.From, l.To)
+		}
+		key := [2]string{l.From, l.To}
+		if l.To < l.From {
+			key = [2]string{l.To, l.From}
+		}
+		if _, ok := links[key]; ok {
+			report("duplicate link %s-%s", l.From, l.To)
+		}
+		links[key] = struct{}{}
+	}
+
+	consumers := map[string]struct{}{}
+	for _, c := range t.Consumers {
+		if c == "" {
+			report("consumer without a name")
+			continue
+		}
+		if _, ok := consumers[c]; ok {
+			report("duplicate consumer %s", c)
+		}
+		consumers[c] = struct{}{}
+	}
+
+	paths := map[[2]string]struct{}{}
+	for _, p := range t.Paths {
+		if _, ok := devices[p.Device]; !ok {
+			report("path of %s references unknown device %q", p.Consumer, p.Device)
+		}
+		if _, ok := consumers[p.Consumer]; !ok {
+			report("path from %s references undeclared consumer %q", p.Device, p.Consumer)
+		}
+		if _, ok := paths[[2]string{p.Device, p.Consumer}]; ok {
+			report("duplicate path of %s from %s", p.Consumer, p.Device)
+		}
+		paths[[2]string{p.Device, p.Consumer}] = struct{}{}
+		for _, route := range p.Routes {
+			if len(route) != 2 {
+				report("path of %s from %s has a route %v that is not a device and a consumer", p.Consumer, p.Device, route)
+				continue
+			}
+			if _, ok := devices[route[0]]; !ok {
+				report("path of %s from %s routes to unknown device %q", p.Consumer, p.Device, route[0])
+			}
+			if _, ok := consumers[route[1]]; !ok {
+				report("path of %s from %s routes to undeclared consumer %q", p.Consumer, p.Device, route[1])
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTopology, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func cloneTopology(t domain.Topology) domain.Topology {
+	t.Nodes = append([]domain.TopologyNode{}, t.Nodes...)
+	t.Devices = append([]domain.TopologyDevice{}, t.Devices...)
+	t.Links = append([]domain.TopologyLink{}, t.Links...)
+	t.Consumers = append([]string{}, t.Consumers...)
+	t.Paths = append([]domain.ConsumerPath{}, t.Paths...)
+	return t
+}
+
+func indexOfNode(t domain.Topology, name string) int {
+	for i, n := range t.Nodes {
+		if n.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfDevice(t domain.Topology, id string) int {
+	for i, d := range t.Devices {
+		if d.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfLink(t domain.Topology, from, to string) int {
+	for i, l := range t.Links {
+		if (l.From == from && l.To == to) || (l.From == to && l.To == from) {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfPath(t domain.Topology, device, consumer string) int {
+	for i, p := range t.Paths {
+		if p.Device == device && p.Consumer == consumer {
+			return i
+		}
+	}
+	return -1
+}
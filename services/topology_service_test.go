@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"mondash-backend/config"
+	"mondash-backend/domain"
+	"mondash-backend/logger"
+	"mondash-backend/repository"
+	"mondash-backend/repository/inmemory"
+)
+
+func TestTopologyExplicitNodes(t *testing.T) {
+	ctx := context.Background()
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	var cfg config.Config
+	err := yaml.Unmarshal([]byte(`
+nodes:
+  headquarters:
+    type: trusted node
+    kme: https://hq.example:6600
+    devices: [HQ]
+  nodeX:
+    devices: [nodeXA, nodeXB]
+geolocation:
+  headquarters: {lat: 44.43, long: 26.04}
+  nodeX: {lat: 44.44, long: 26.05}
+links:
+  - [HQ, nodeXA]
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := inmemory.NewNodeRepo()
+	network := NewNetwork(config.Config{})
+	s := &TopologyService{Repo: inmemory.NewTopologyRepo(), NodeRepo: nodes, Network: network}
+	if _, err := s.Import(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := nodes.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 nodes, got %+v", list)
+	}
+	hq, x := list[0], list[1]
+	if hq.ID != "headquarters" || hq.Type != "trusted node" || hq.KME != "https://hq.example:6600" || len(hq.Devices) != 1 {
+		t.Fatalf("unexpected node %+v", hq)
+	}
+	if hq.Devices[0].ConnectedTo.NodeID != "nodeX" {
+		t.Fatalf("expected HQ to be connected to nodeX, got %+v", hq.Devices[0].ConnectedTo)
+	}
+	if x.ID != "nodeX" || x.Type != "trusted node" || len(x.Devices) != 2 {
+		t.Fatalf("unexpected node %+v", x)
+	}
+	for name, want := range map[string]string{"HQ": "headquarters", "nodeXA": "nodeX", "nodeX": "nodeX", "other": "other"} {
+		if got := network.NodeOf(name); got != want {
+			t.Errorf("NodeOf(%s) = %s, want %s", name, got, want)
+		}
+	}
+
+	// Devices must belong to a declared node.
+	cfg.Nodes["nodeX"] = config.Node{Devices: []string{"nodeXA"}}
+	cfg.Names = []string{"nodeXB"}
+	if _, err := s.Import(ctx, cfg); !errors.Is(err, ErrInvalidTopology) {
+		t.Fatalf("expected an undeclared device to be rejected, got %v", err)
+	}
+}
+
+func TestTopologyLegacyFallback(t *testing.T) {
+	cfg, err := config.Load("../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Nodes = nil
+	cfg.Names = []string{"precisA", "precisB", "rectorat", "campus"}
+	if got := cfg.NodesByConsumer()["vpn1"]; len(got) != 2 || got[0] != "precis" || got[1] != "rectorat" {
+		t.Fatalf("unexpected nodes for vpn1: %v", got)
+	}
+	if err := ValidateTopology(repository.TopologyFromConfig(cfg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopologyReloadKeepsAPIChanges(t *testing.T) {
+	ctx := context.Background()
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	load := func(length string, keySize int) config.Config {
+		t.Helper()
+		cfg, err := config.Load("../config.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range cfg.Links {
+			if l[0] == "campus" && l[1] == "precisA" {
+				l[2] = length
+			}
+		}
+		cfg.Extra["key_parameters"].(map[string]interface{})["default_key_size"] = keySize
+		return cfg
+	}
+	lengthOf := func(top domain.Topology) string {
+		for _, l := range top.Links {
+			if l.From == "campus" && l.To == "precisA" {
+				return l.Length
+			}
+		}
+		return ""
+	}
+	s := &TopologyService{Repo: inmemory.NewTopologyRepo(), NodeRepo: inmemory.NewNodeRepo(), Network: NewNetwork(config.Config{})}
+	if err := s.Init(ctx, load("14000", 256)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A topology loaded from the file follows it.
+	if err := s.Reload(ctx, load("15000", 256)); err != nil {
+		t.Fatal(err)
+	}
+	top, err := s.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Source != domain.TopologySourceFile || lengthOf(top) != "15000" {
+		t.Fatalf("expected the file to be re-imported, got %s %q", top.Source, lengthOf(top))
+	}
+
+	// Once edited through the API, only the other settings follow the file.
+	if err := s.AddConsumer(ctx, "vault9"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(ctx, load("16000", 128)); err != nil {
+		t.Fatal(err)
+	}
+	top, err = s.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Source != domain.TopologySourceAPI || lengthOf(top) != "15000" || top.Consumers[len(top.Consumers)-1] != "vault9" {
+		t.Fatalf("expected the API changes to be kept, got %+v", top)
+	}
+	if got := top.Settings["key_parameters"].(map[string]interface{})["default_key_size"]; got != 128 {
+		t.Fatalf("expected the new key parameters, got %v", got)
+	}
+}
+
+// failingSync is a node repository whose definitions cannot be replaced.
+type failingSync struct {
+	*inmemory.NodeRepo
+}
+
+func (failingSync) Sync(context.Context, []domain.NodeInfo) error {
+	return errors.New("sync failed")
+}
+
+func TestTopologyStoredButNotApplied(t *testing.T) {
+	ctx := context.Background()
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	cfg, err := config.Load("../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &TopologyService{Repo: inmemory.NewTopologyRepo(), NodeRepo: inmemory.NewNodeRepo(), Network: NewNetwork(config.Config{})}
+	if err := s.Init(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	s.NodeRepo = failingSync{inmemory.NewNodeRepo()}
+	if err := s.AddConsumer(ctx, "vault9"); !errors.Is(err, ErrTopologyNotApplied) {
+		t.Fatalf("expected ErrTopologyNotApplied, got %v", err)
+	}
+	top, err := s.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Consumers[len(top.Consumers)-1] != "vault9" {
+		t.Fatalf("expected the change to be stored, got %+v", top.Consumers)
+	}
+}
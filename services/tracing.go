@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("mondash-backend/services")
+
+// startSpan starts the span of a service method, below the request span and
+// above the spans of the repositories it calls.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"mondash-backend/logger"
+	"mondash-backend/repository/inmemory"
+)
+
+func TestServiceSpans(t *testing.T) {
+	if logger.Log == nil {
+		_ = logger.Init()
+	}
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "GET /api/nodes")
+	s := &NodeService{Repo: inmemory.NewNodeRepo()}
+	if _, err := s.List(ctx); err != nil {
+		t.Fatal(err)
+	}
+	request.End()
+
+	for _, span := range recorder.Ended() {
+		if span.Name() == "NodeService.List" {
+			if span.Parent().SpanID() != request.SpanContext().SpanID() {
+				t.Fatal("expected the service span below the request span")
+			}
+			return
+		}
+	}
+	t.Fatal("expected a NodeService.List span")
+}
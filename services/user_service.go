@@ -1,7 +1,11 @@
 package services
 
-import "mondash-backend/domain"
-import "mondash-backend/repository"
+import (
+	"context"
+
+	"mondash-backend/domain"
+	"mondash-backend/repository"
+)
 
 // UserService contains business logic for users.
 type UserService struct {
@@ -9,9 +13,11 @@ type UserService struct {
 }
 
 // List returns users from the repository.
-func (s *UserService) List() ([]domain.User, error) {
+func (s *UserService) List(ctx context.Context) ([]domain.User, error) {
+	ctx, span := startSpan(ctx, "UserService.List")
+	defer span.End()
 	if s.Repo == nil {
 		return nil, nil
 	}
-	return s.Repo.List()
+	return s.Repo.List(ctx)
 }